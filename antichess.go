@@ -0,0 +1,47 @@
+package main
+
+// getTakingBehavior returns whether the side to move may take the other side's pieces, or in
+// antichess, must take one whenever it can.
+func (p position) getTakingBehavior() takingBehavior {
+	if p.variant == antichess {
+		return mustTake
+	}
+
+	return canTake
+}
+
+// getCapturesIfAny returns the moves that capture, if there are any, as they're the only ones
+// that can be made when taking is compulsory, or otherwise all the moves.
+func getCapturesIfAny(moves []move) []move {
+	var captures []move
+	for _, m := range moves {
+		if m.isCapture() {
+			captures = append(captures, m)
+		}
+	}
+
+	if len(captures) == 0 {
+		return moves
+	}
+
+	return captures
+}
+
+// isCaptureCompulsory returns whether the side to move has to capture, given its legal moves: in
+// antichess, when any of them is a capture, as then they all are.
+func (p position) isCaptureCompulsory(moves []move) bool {
+	return p.getTakingBehavior() == mustTake && len(moves) > 0 && moves[0].isCapture()
+}
+
+// hasPieces returns whether the side has any pieces left on the board.
+func (b board) hasPieces(color string) bool {
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if !b.isRowColEmpty(i, j) && b[i][j].color == color {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAntichessPerft(t *testing.T) {
+	p := newVariantPosition(antichess)
+	for i, expected := range []int{20, 400, 8067, 153299} {
+		if testing.Short() && expected > perftShortMaxNodes {
+			continue
+		}
+
+		if res := perft(p, i+1); res != expected {
+			t.Errorf("Expected antichess perft(%d) to be %d, but got: %d", i+1, expected, res)
+		}
+	}
+}
+
+func TestAntichessCapturesAreCompulsory(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected []string
+	}{
+		// Test: a capture anywhere on the board rules out every other move
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w - - 0 2", []string{"e4d5"}},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPPKPPP/RNBQ1BNR w - - 0 2", []string{"e4d5"}},
+		// Test: any capture can be chosen, including taking en passant and with the king
+		{"4k3/8/8/3pP3/8/8/8/8 w - d6 0 1", []string{"e5d6"}},
+		{"8/8/8/8/8/8/3p4/2K1r3 w - - 0 1", []string{"c1d2"}},
+		{"8/8/8/8/8/2n5/3p4/2K1r3 w - - 0 1", []string{"c1d2"}},
+		{"8/8/8/8/8/8/1r1p4/2K5 w - - 0 1", []string{"c1d2", "c1b2"}},
+	}
+
+	for _, test := range tests {
+		p, err := parseVariantFEN(test.fen, antichess)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		var moves []string
+		for _, m := range generateLegalMoves(p) {
+			moves = append(moves, m.String())
+		}
+
+		if strings.Join(moves, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("Expected the legal moves in %s to be %v, but got: %v", test.fen, test.expected, moves)
+		}
+	}
+}
+
+func TestAntichessMoves(t *testing.T) {
+	tests := []struct {
+		fen      string
+		input    string
+		expected string
+		err      string
+	}{
+		// Test: there's no check, so a king can be left attacked, and captured
+		{"4k3/8/8/8/8/8/8/r3K3 w - - 0 1", "Kf1", "4k3/8/8/8/8/8/8/r4K2 b - - 1 1", ""},
+		{"4k3/8/8/8/8/8/8/r3K3 b - - 0 1", "Rxe1", "4k3/8/8/8/8/8/8/4r3 w - - 0 2", ""},
+		// Test: a pawn can be promoted to a king
+		{"8/4P3/8/8/8/8/8/k7 w - - 0 1", "e8=K", "4K3/8/8/8/8/8/8/k7 b - - 0 1", ""},
+		{"8/4P3/8/8/8/8/8/k7 w - - 0 1", "e7e8k", "4K3/8/8/8/8/8/8/k7 b - - 0 1", ""},
+		{"8/4P3/8/8/8/8/8/k7 w - - 0 1", "e8=P", "", "can only promote to Q, R, B, N or K"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w - - 0 2", "e5", "", "a capture can be made, so one must be"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w - - 0 2", "g1f3", "", "a capture can be made, so one must be"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseVariantFEN(test.fen, antichess)
+		m, err := getMoveFromInput(p, test.input)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expected an error containing \"%s\" for %s in %s, but got: %v", test.err, test.input, test.fen, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Expected %s to be legal in %s, but got: %s", test.input, test.fen, err)
+			continue
+		}
+
+		p.makeMove(m)
+		if p.toFEN() != test.expected || p.hash != p.getHash() {
+			t.Errorf("Expected %s in %s to give %s, but got: %s", test.input, test.fen, test.expected, p.toFEN())
+		}
+	}
+}
+
+func TestAntichessWin(t *testing.T) {
+	tests := []struct {
+		fen    string
+		san    string
+		winner string
+	}{
+		// Test: losing the last piece wins, and the move that loses it isn't written as mate
+		{"8/8/8/8/8/8/3p4/4K3 w - - 0 1", "Kxd2", "B"},
+		// Test: being stalemated wins
+		{"8/8/8/8/8/p7/P7/8 b - - 0 1", "", "B"},
+		{"8/8/8/8/p7/8/P7/8 w - - 0 1", "a3", "B"},
+		{"8/8/8/8/8/8/3p4/4K3 b - - 0 1", "dxe1=Q", "W"},
+		{"8/8/8/8/8/8/3p4/7K b - - 0 1", "d1=Q", ""},
+	}
+
+	for _, test := range tests {
+		p, _ := parseVariantFEN(test.fen, antichess)
+		if test.san != "" {
+			m, err := resolveSAN(p, test.san)
+			if err != nil {
+				t.Errorf("Expected %s to be legal in %s, but got: %s", test.san, test.fen, err)
+				continue
+			}
+
+			if san := getSAN(p, m); san != test.san {
+				t.Errorf("Expected the move in %s to be written as %s, but got: %s", test.fen, test.san, san)
+			}
+			p.makeMove(m)
+		}
+
+		if winner, reason := p.getVariantWin(); winner != test.winner {
+			t.Errorf("Expected the winner in %s after '%s' to be '%s', but got: '%s' (%s)", test.fen, test.san, test.winner, winner, reason)
+		}
+
+		if p.isCheckMate() {
+			t.Errorf("Expected no checkmate in antichess in %s after '%s'", test.fen, test.san)
+		}
+	}
+}
+
+func TestAntichessFEN(t *testing.T) {
+	p, err := parseVariantFEN("8/8/8/3k4/8/2K1K3/8/8 w - - 0 1", antichess)
+	if err != nil || p.variant != antichess {
+		t.Errorf("Expected any number of kings to be allowed in antichess, but got: %v", err)
+	}
+
+	if _, err := parseVariantFEN("8/8/8/8/8/8/8/1R6 b - - 0 1", antichess); err != nil {
+		t.Errorf("Expected a side with no pieces to be allowed in antichess, but got: %v", err)
+	}
+
+	if _, err := parseVariantFEN(StartingFEN, antichess); err == nil || !strings.Contains(err.Error(), "no castling") {
+		t.Errorf("Expected an error for castling rights in antichess, but got: %v", err)
+	}
+
+	if _, err := parseFEN("8/8/8/8/8/8/8/1R6 b - - 0 1"); err == nil {
+		t.Errorf("Expected an error for a position with no kings in standard chess, but got none")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+// getExplosionSquares returns the squares a capture on sq explodes in atomic: sq itself and the
+// squares around it.
+func getExplosionSquares(sq square) []square {
+	row, col := getRowColForSquare(sq)
+	var squares []square
+	for r := row - 1; r <= row+1; r++ {
+		for c := col - 1; c <= col+1; c++ {
+			if r >= 0 && r < BoardSize && c >= 0 && c < BoardSize {
+				squares = append(squares, getSquareForRowCol(r, c))
+			}
+		}
+	}
+
+	return squares
+}
+
+// explode removes the pieces a capture on sq blows up in atomic, once the capture has been played:
+// the capturing piece, which is on sq, and every piece on the squares around it but pawns.
+func (b *board) explode(sq square) {
+	for _, s := range getExplosionSquares(sq) {
+		row, col := getRowColForSquare(s)
+		if areSquaresEqual(s, sq) || !b.isRowColEmpty(row, col) && b[row][col].getName() != "P" {
+			b.setSquareEmpty(row, col)
+		}
+	}
+}
+
+// isKingInAtomicCheck returns whether the side's king is in check in atomic. Kings can't capture,
+// so a king never gives check, and while the kings are next to each other, neither is in check,
+// as capturing one would blow up the other.
+func (b board) isKingInAtomicCheck(color string) bool {
+	kingSquare, err := b.getSquareForPiece(color, "K")
+	otherKingSquare, otherErr := b.getSquareForPiece(switchColor(color), "K")
+	if err != nil || otherErr != nil || areSquaresAdjacent(kingSquare, otherKingSquare) {
+		return false
+	}
+
+	inCheck, _ := isSquareEnPrise(b, kingSquare, color)
+	return inCheck
+}
+
+// isAtomicMoveLegal returns whether a move is legal in atomic: a king can't capture, and a move
+// can't blow up the mover's own king, or leave it in check, unless it blows up the other king,
+// which wins the game.
+func (p position) isAtomicMoveLegal(m move) bool {
+	if m.piece.getName() == "K" && m.isCapture() {
+		return false
+	}
+
+	b := p.board
+	b.playMove(m)
+	if m.isCapture() {
+		b.explode(m.toSquare)
+	}
+
+	color := m.piece.color
+	if _, err := b.getSquareForPiece(color, "K"); err != nil {
+		return false
+	}
+
+	if _, err := b.getSquareForPiece(switchColor(color), "K"); err != nil {
+		return true
+	}
+
+	return !b.isKingInAtomicCheck(color)
+}
+
+// hasAtomicInsufficientMaterial returns whether neither side can win in atomic, whatever moves are
+// played. A single knight or bishop can neither checkmate a bare king nor capture next to it.
+func (b board) hasAtomicInsufficientMaterial() bool {
+	var pieces []string
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if !b.isRowColEmpty(i, j) && b[i][j].getName() != "K" {
+				pieces = append(pieces, b[i][j].getName())
+			}
+		}
+	}
+
+	return len(pieces) == 0 || len(pieces) == 1 && (pieces[0] == "N" || pieces[0] == "B")
+}
@@ -0,0 +1,160 @@
+package main
+
+import "testing"
+
+func TestAtomicPerft(t *testing.T) {
+	p := newVariantPosition(atomicChess)
+	for i, expected := range []int{20, 400, 8902, 197326} {
+		if testing.Short() && expected > perftShortMaxNodes {
+			continue
+		}
+
+		if res := perft(p, i+1); res != expected {
+			t.Errorf("Expected atomic perft(%d) to be %d, but got: %d", i+1, expected, res)
+		}
+	}
+}
+
+// The positions and counts are programfox's, as used to test other atomic move generators.
+func TestAtomicPerftPositions(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected []int
+	}{
+		{"rn2kb1r/1pp1p2p/p2q1pp1/3P4/2P3b1/4PN2/PP3PPP/R2QKB1R b KQkq - 0 1", []int{40, 1238, 45237}},
+		{"rn1qkb1r/p5pp/2p5/3p4/N3P3/5P2/PPP4P/R1BQK3 w Qkq - 0 1", []int{28, 833, 23353}},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		p.variant = atomicChess
+		for i, expected := range test.expected {
+			if testing.Short() && expected > perftShortMaxNodes {
+				continue
+			}
+
+			if res := perft(p, i+1); res != expected {
+				t.Errorf("Expected atomic perft(%d) of %s to be %d, but got: %d", i+1, test.fen, expected, res)
+			}
+		}
+	}
+}
+
+func TestAtomicExplosions(t *testing.T) {
+	tests := []struct {
+		fen      string
+		san      string
+		expected string
+	}{
+		// Test: the knight raid on f7 blows up the black king, and with it black's castling rights
+		{"rnbqkbnr/1ppppppp/8/p5N1/8/8/PPPPPPPP/RNBQKB1R w KQkq - 0 3", "Nxf7#", "rnbq3r/1pppp1pp/8/p7/8/8/PPPPPPPP/RNBQKB1R b KQ - 0 3"},
+		// Test: pawns around the capture survive the explosion
+		{"4k3/8/2pbp3/R2n4/2p1p3/8/8/4K3 w - - 0 1", "Rxd5", "4k3/8/2p1p3/8/2p1p3/8/8/4K3 b - - 0 1"},
+		// Test: taking en passant explodes around the square the pawn moves to
+		{"4k3/2n5/8/3pP3/2N5/8/8/4K3 w - d6 0 2", "exd6", "4k3/8/8/8/2N5/8/8/4K3 b - - 0 2"},
+		// Test: a rook blown up loses its castling right
+		{"r3k2r/8/8/8/8/8/6p1/R3KB1R w KQkq - 0 1", "Bxg2", "r3k2r/8/8/8/8/8/8/R3K3 b Qkq - 0 1"},
+		// Test: blowing up the other king is allowed while in check
+		{"7k/6p1/8/8/8/8/8/r3K1R1 w - - 0 1", "Rxg7#", "8/8/8/8/8/8/8/r3K3 b - - 0 1"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		p.variant = atomicChess
+		m, err := resolveSAN(p, test.san)
+		if err != nil {
+			t.Errorf("Expected %s to be legal in %s, but got: %s", test.san, test.fen, err)
+			continue
+		}
+
+		if san := getSAN(p, m); san != test.san {
+			t.Errorf("Expected %s in %s to be written as %s, but got: %s", test.san, test.fen, test.san, san)
+		}
+
+		start := p
+		u := p.makeMove(m)
+		if p.toFEN() != test.expected || p.hash != p.getHash() {
+			t.Errorf("Expected %s in %s to give %s, but got: %s", test.san, test.fen, test.expected, p.toFEN())
+		}
+
+		p.unmakeMove(m, u)
+		if p != start {
+			t.Errorf("Expected taking back %s to restore %s, but got: %s", test.san, test.fen, p.toFEN())
+		}
+	}
+}
+
+func TestAtomicIllegalMoves(t *testing.T) {
+	tests := []struct {
+		fen         string
+		move        string
+		description string
+	}{
+		{"4k3/8/8/8/8/8/3p4/4K3 w - - 0 1", "e1d2", "a king capturing"},
+		{"4k3/8/8/8/8/8/3p4/3QK3 w - - 0 1", "d1d2", "a capture blowing up the mover's own king"},
+		{"4k3/8/8/8/8/8/3p4/3QK2r w - - 0 1", "d1d2", "a capture blowing up both kings"},
+		{"4k3/8/8/8/8/8/r7/4K3 w - - 0 1", "e1e2", "a king moving into check"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		p.variant = atomicChess
+		if m, err := getUCIMove(p, test.move); err == nil {
+			t.Errorf("Expected %s to be illegal in atomic, but got: %+v", test.description, m)
+		}
+	}
+}
+
+func TestAtomicCheck(t *testing.T) {
+	tests := []struct {
+		fen       string
+		check     bool
+		checkmate bool
+	}{
+		// Test: kings next to each other can't be in check
+		{"8/8/8/8/8/3kK3/8/4r3 w - - 0 1", false, false},
+		{"8/8/8/8/2k5/4K3/8/4r3 w - - 0 1", true, false},
+		// Test: a check can be escaped by moving the king next to the other king
+		{"8/8/8/8/8/2k5/8/r3K3 w - - 0 1", true, false},
+		{"7k/6pp/8/8/8/8/8/R5K1 b - - 0 1", false, false},
+		{"R6k/6pp/8/8/8/8/8/6K1 b - - 0 1", true, true},
+		// Test: a check can be escaped by blowing up the other king
+		{"R6k/6pp/8/8/8/8/4rP2/6K1 b - - 0 1", true, false},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		p.variant = atomicChess
+		if check, checkmate := p.isKingInCheck(), p.isCheckMate(); check != test.check || checkmate != test.checkmate {
+			t.Errorf("Expected check and checkmate in %s to be %t and %t, but got: %t and %t", test.fen, test.check, test.checkmate, check, checkmate)
+		}
+	}
+}
+
+func TestAtomicGameEnd(t *testing.T) {
+	p, _ := parseFEN("rnbqkbnr/1ppppppp/8/p5N1/8/8/PPPPPPPP/RNBQKB1R w KQkq - 0 3")
+	p.variant = atomicChess
+	m, _ := resolveSAN(p, "Nxf7")
+	p.makeMove(m)
+	if winner, reason := p.getVariantWin(); winner != "W" || reason != "The B king has exploded" {
+		t.Errorf("Expected white to win by exploding the black king, but got: %s (%s)", winner, reason)
+	}
+
+	tests := []struct {
+		fen      string
+		expected bool
+	}{
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/3NK3 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/2BNK3 w - - 0 1", false},
+		{"3nk3/8/8/8/8/8/8/3NK3 w - - 0 1", false},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		p.variant = atomicChess
+		if res := p.hasInsufficientMaterial(); res != test.expected {
+			t.Errorf("Expected insufficient material in atomic in %s to be %t, but got: %t", test.fen, test.expected, res)
+		}
+	}
+}
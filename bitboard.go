@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// bitboard is a set of squares, one bit for each, with a1 as bit 0, b1 as bit 1, and so on up to
+// h8 as bit 63. Bitboards let the moves and attacks of pieces be worked out for many squares at
+// once with bitwise operations, rather than a square at a time.
+type bitboard uint64
+
+const (
+	rank1 bitboard = 0xff
+	rank2 bitboard = rank1 << 8
+	rank7 bitboard = rank1 << 48
+	rank8 bitboard = rank1 << 56
+)
+
+// Directions pieces move in, as rank and file offsets.
+var (
+	rookRays   = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	bishopRays = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+var (
+	knightAttacks [64]bitboard
+	kingAttacks   [64]bitboard
+	pawnAttacks   [2][64]bitboard
+	rookMagics    [64]magic
+	bishopMagics  [64]magic
+
+	// The squares strictly between two squares on the same rank, file or diagonal, or none if
+	// they're not on one.
+	squaresBetween [64][64]bitboard
+)
+
+// magic holds what's needed to look up the squares a rook or bishop on a square attacks, given
+// the squares that are occupied. Only the occupied squares that can block it matter, those in its
+// mask. Multiplying them by the magic number gathers them into the top bits of the product, which
+// index the table of attacks without two arrangements of blockers that give different attacks
+// ever sharing an entry.
+type magic struct {
+	mask    bitboard
+	number  uint64
+	shift   uint
+	attacks []bitboard
+}
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		knightAttacks[sq] = getLeaperAttacks(sq, [][2]int{{2, 1}, {2, -1}, {-2, 1}, {-2, -1}, {1, 2}, {1, -2}, {-1, 2}, {-1, -2}})
+		kingAttacks[sq] = getLeaperAttacks(sq, [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1}})
+		pawnAttacks[white][sq] = getLeaperAttacks(sq, [][2]int{{1, 1}, {1, -1}})
+		pawnAttacks[black][sq] = getLeaperAttacks(sq, [][2]int{{-1, 1}, {-1, -1}})
+	}
+
+	for sq := 0; sq < 64; sq++ {
+		rookMagics[sq] = newMagic(sq, rookRays, rookMagicNumbers[sq])
+		bishopMagics[sq] = newMagic(sq, bishopRays, bishopMagicNumbers[sq])
+	}
+
+	for from := 0; from < 64; from++ {
+		for to := 0; to < 64; to++ {
+			for _, rays := range [][][2]int{rookRays, bishopRays} {
+				if getSlidingAttacks(from, rays, 0)&(1<<uint(to)) != 0 {
+					squaresBetween[from][to] = getSlidingAttacks(from, rays, 1<<uint(to)) & getSlidingAttacks(to, rays, 1<<uint(from))
+				}
+			}
+		}
+	}
+}
+
+func rookAttacks(sq int, occupied bitboard) bitboard {
+	m := &rookMagics[sq]
+	return m.attacks[(uint64(occupied&m.mask)*m.number)>>m.shift]
+}
+
+func bishopAttacks(sq int, occupied bitboard) bitboard {
+	m := &bishopMagics[sq]
+	return m.attacks[(uint64(occupied&m.mask)*m.number)>>m.shift]
+}
+
+func getLeaperAttacks(sq int, offsets [][2]int) bitboard {
+	var attacks bitboard
+	for _, offset := range offsets {
+		rank, file := sq/8+offset[0], sq%8+offset[1]
+		if rank >= 0 && rank < 8 && file >= 0 && file < 8 {
+			attacks |= 1 << uint(rank*8+file)
+		}
+	}
+
+	return attacks
+}
+
+// getSlidingAttacks works out the squares a piece moving along the rays from a square attacks, a
+// square at a time, stopping at the first occupied square on each ray. It's used to fill the
+// magic tables, which are then used instead.
+func getSlidingAttacks(sq int, rays [][2]int, occupied bitboard) bitboard {
+	var attacks bitboard
+	for _, ray := range rays {
+		for rank, file := sq/8+ray[0], sq%8+ray[1]; rank >= 0 && rank < 8 && file >= 0 && file < 8; rank, file = rank+ray[0], file+ray[1] {
+			attacks |= 1 << uint(rank*8+file)
+			if occupied&(1<<uint(rank*8+file)) != 0 {
+				break
+			}
+		}
+	}
+
+	return attacks
+}
+
+// getSlidingMask returns the squares that can block a piece moving along the rays from a square.
+// The last square on each ray can't block anything behind it, so isn't included.
+func getSlidingMask(sq int, rays [][2]int) bitboard {
+	var mask bitboard
+	for _, ray := range rays {
+		for rank, file := sq/8+ray[0], sq%8+ray[1]; rank+ray[0] >= 0 && rank+ray[0] < 8 && file+ray[1] >= 0 && file+ray[1] < 8; rank, file = rank+ray[0], file+ray[1] {
+			mask |= 1 << uint(rank*8+file)
+		}
+	}
+
+	return mask
+}
+
+// newMagic fills the table of attacks for a rook or bishop on a square, using the given magic
+// number. It panics if the number maps two arrangements of blockers that give different attacks
+// to the same entry, which the numbers in rookMagicNumbers and bishopMagicNumbers never do.
+func newMagic(sq int, rays [][2]int, number uint64) magic {
+	mask := getSlidingMask(sq, rays)
+	indexBits := uint(bits.OnesCount64(uint64(mask)))
+	m := magic{mask: mask, number: number, shift: 64 - indexBits, attacks: make([]bitboard, 1<<indexBits)}
+	used := make([]bool, len(m.attacks))
+	for subset := bitboard(0); ; {
+		index := (uint64(subset) * m.number) >> m.shift
+		attacks := getSlidingAttacks(sq, rays, subset)
+		if used[index] && m.attacks[index] != attacks {
+			panic(fmt.Sprintf("Magic number %#x doesn't work for square %d.", number, sq))
+		}
+		used[index], m.attacks[index] = true, attacks
+
+		subset = (subset - mask) & mask
+		if subset == 0 {
+			return m
+		}
+	}
+}
+
+// xorshift is a small, fast pseudo-random number generator.
+type xorshift uint64
+
+func (x *xorshift) next() uint64 {
+	*x ^= *x >> 12
+	*x ^= *x << 25
+	*x ^= *x >> 27
+	return uint64(*x) * 2685821657736338717
+}
+
+// popLowestSquare removes the lowest square from the bitboard, and returns it.
+func popLowestSquare(b *bitboard) int {
+	sq := bits.TrailingZeros64(uint64(*b))
+	*b &= *b - 1
+	return sq
+}
+
+func getSquareIndex(sq square) int {
+	return (sq.rank-1)*8 + fromFileStr(sq.file)
+}
+
+func getSquareFromIndex(i int) square {
+	return square{file: toFileStr(i % 8), rank: i/8 + 1}
+}
+
+// The magic numbers for a rook or bishop on each square. They were found by trying random numbers,
+// with few bits set as they tend to work best, until one mapped every arrangement of blockers to
+// an entry without clashes. Searching for them takes long enough to slow down starting up, so
+// they're kept here instead.
+var rookMagicNumbers = [64]uint64{
+	0x1080004008801020, 0x0840092002c03000, 0x1900200010400900, 0x0880100008000480,
+	0x4200100420080200, 0x8100020100080400, 0x0200040110886200, 0x0200008040220411,
+	0x0404800084400220, 0x0000401000402000, 0x0086001081220440, 0x0408800800100280,
+	0x000a001201040820, 0x8848800200840080, 0x4001000100040200, 0x0442000102105084,
+	0x9080010020804100, 0x0040404000201009, 0x0000808010002009, 0x2200090021d00100,
+	0x0008008008040080, 0x0004004002010040, 0x0011040008015042, 0x00000a0001768104,
+	0x0000800080204009, 0x2010004140002001, 0x9800200280100080, 0x1000100080080080,
+	0x0050500500080100, 0x0000020080040080, 0x0c10010400420810, 0x1040008200005104,
+	0x01808240088004a0, 0x0882804004802000, 0x0880402001001100, 0x2000210409001000,
+	0x2000480131001500, 0x0000800400800200, 0x000002380c001003, 0x4600084882000431,
+	0x0080002000504000, 0x0300500020004002, 0x0040408200220011, 0x0010040008004040,
+	0x0000080004008080, 0x0010040002008080, 0x2012004881020004, 0x8300842444820011,
+	0x0088403882010200, 0x0820400080210100, 0x0110910040a00300, 0x0801100280080480,
+	0x0242009008200600, 0x1002000489500200, 0x0040800200010080, 0x0091800041000080,
+	0x0000209300488001, 0x04c1002414824001, 0x020020000b001041, 0x7000100004200901,
+	0x8002002004100802, 0x30010002084c0007, 0x0888221800813004, 0x4000002840840112,
+}
+
+var bishopMagicNumbers = [64]uint64{
+	0x20c0090901061081, 0x0024040094030104, 0x8210810200290200, 0x0011040484620000,
+	0x0081104002221000, 0x0009012011001350, 0x0081010802400380, 0x0000420210010408,
+	0x0008105002280050, 0x0001028484040044, 0x2a00880810408804, 0x7020022282000100,
+	0x0084040420100a50, 0x000401010840e000, 0x2020020210420888, 0x0008084202012010,
+	0x2010400810018800, 0x0445122008020840, 0x0804100808002008, 0x0008002104110100,
+	0x0061005820080800, 0x2001000200820100, 0x480c210084010800, 0x3004442500480420,
+	0x1010102240048100, 0x00182009084220a3, 0x8803090a10004205, 0x0208080040202020,
+	0x000c044084010040, 0x00a1010002004106, 0x6008210020640202, 0x1600902112860801,
+	0x00042008c1220200, 0x010c042002440140, 0x5022080200040820, 0x0402004042940100,
+	0x0860108400008020, 0x000c080022021000, 0x0264080652822100, 0x4005031221010401,
+	0x0004502410008400, 0x000500b010a20400, 0x0415094050080800, 0x080000201800a104,
+	0x4022a80304000110, 0x4012140802028020, 0x40200104010100a0, 0x12810806008b0c41,
+	0x0020441008080000, 0x2002120084045420, 0x0704020062080002, 0x0000001084040001,
+	0x0322200891240200, 0xf040200210024800, 0x0140824832008042, 0x000210020a004602,
+	0x0083042805141020, 0x002c12009a011000, 0x0041a00044140400, 0x00004004020a0202,
+	0x0000140010020210, 0x2864160811012200, 0x2060080841082a17, 0xa010041108003100,
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	white = 0
+	black = 1
+)
+
+// Piece types, in the order of pieceTypeNames.
+const (
+	pawnType = iota
+	knightType
+	bishopType
+	rookType
+	queenType
+	kingType
+)
+
+const pieceTypeNames = "PNBRQK"
+
+// maxMoves is more than the number of legal moves in any position, so a buffer of this size never
+// needs to grow while generating moves.
+const maxMoves = 256
+
+// bbPiece is a piece on a bitboardPosition's square: 0 if it's empty, or otherwise one more than
+// the piece's type, plus 6 for black pieces.
+type bbPiece int8
+
+func newBBPiece(color int, pieceType int) bbPiece {
+	return bbPiece(color*6 + pieceType + 1)
+}
+
+func (pc bbPiece) color() int {
+	return int(pc-1) / 6
+}
+
+func (pc bbPiece) pieceType() int {
+	return int(pc-1) % 6
+}
+
+// Castling rights, as bits: white kingside, white queenside, black kingside, black queenside.
+const (
+	whiteKingsideRight = 1 << iota
+	whiteQueensideRight
+	blackKingsideRight
+	blackQueensideRight
+)
+
+// bbMove is a move on a bitboardPosition: the squares moved from and to in bits 0-5 and 6-11, the
+// type of piece a pawn is promoted to, if any, in bits 12-14, and whether it's castling or taking
+// en passant in bits 15 and 16. When castling, the king's move is the one given.
+type bbMove uint32
+
+const (
+	bbMoveCastling  bbMove = 1 << 15
+	bbMoveEnPassant bbMove = 1 << 16
+)
+
+func newBBMove(from int, to int) bbMove {
+	return bbMove(from | to<<6)
+}
+
+func (m bbMove) from() int { return int(m & 63) }
+func (m bbMove) to() int   { return int(m>>6) & 63 }
+
+// promotion returns the type of piece promoted to, or 0 (a pawn) if it's not a promotion.
+func (m bbMove) promotion() int { return int(m>>12) & 7 }
+
+func (m bbMove) withPromotion(pieceType int) bbMove {
+	return m | bbMove(pieceType)<<12
+}
+
+// String returns the move in the long algebraic form used by UCI, e.g. e2e4 or e7e8q.
+func (m bbMove) String() string {
+	s := getNotationForSquare(getSquareFromIndex(m.from())) + getNotationForSquare(getSquareFromIndex(m.to()))
+	if m.promotion() != 0 {
+		s += strings.ToLower(pieceTypeNames[m.promotion() : m.promotion()+1])
+	}
+	return s
+}
+
+// bitboardPosition is a position held as bitboards, one for each type and colour of piece, which
+// is much quicker to generate and make moves in than a position's board. It's used where speed
+// matters, in perft and the engine's search, and generates the same moves as generateLegalMoves.
+type bitboardPosition struct {
+	pieces         [2][6]bitboard
+	occupied       [2]bitboard
+	squares        [64]bbPiece
+	sideToMove     int
+	castlingRights uint8
+	enPassant      int
+	halfmoveClock  int
+	fullmoveNumber int
+
+	// The material and piece-square score from white's point of view, and the Zobrist hash, kept up
+	// to date as moves are made.
+	score int
+	hash  uint64
+
+	// Where the rook for each castling right starts, and which rights are lost by moving from or
+	// to each square, as well as by moving the king.
+	castlingRooks [4]int
+	castlingMasks [64]uint8
+}
+
+// bbUndo is the state a move loses that unmakeMove needs to take it back.
+type bbUndo struct {
+	captured       bbPiece
+	castlingRights uint8
+	enPassant      int
+	halfmoveClock  int
+	hash           uint64
+}
+
+func newBitboardPosition(p position) bitboardPosition {
+	bp := bitboardPosition{halfmoveClock: p.halfmoveClock, fullmoveNumber: p.fullmoveNumber, enPassant: -1}
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if p.board.isRowColEmpty(i, j) {
+				continue
+			}
+
+			gp := p.board[i][j]
+			color := white
+			if gp.color == "B" {
+				color = black
+			}
+			bp.putPiece(getSquareIndex(getSquareForRowCol(i, j)), newBBPiece(color, strings.Index(pieceTypeNames, gp.getName())))
+		}
+	}
+
+	if p.sideToMove == "B" {
+		bp.sideToMove = black
+	}
+
+	bp.castlingRights = p.castlingRights.getBits()
+	for i := range bp.castlingMasks {
+		bp.castlingMasks[i] = 15
+	}
+	for i := range bp.castlingRooks {
+		bp.castlingRooks[i] = getSquareIndex(p.getCastlingRookSquare(i))
+		bp.castlingMasks[bp.castlingRooks[i]] &^= 1 << uint(i)
+	}
+
+	if !isNoSquare(p.enPassantSquare) {
+		bp.setEnPassant(getSquareIndex(p.enPassantSquare))
+	}
+
+	bp.hash = bp.getHash()
+	return bp
+}
+
+func (bp *bitboardPosition) putPiece(sq int, pc bbPiece) {
+	bp.squares[sq] = pc
+	bp.pieces[pc.color()][pc.pieceType()] |= 1 << uint(sq)
+	bp.occupied[pc.color()] |= 1 << uint(sq)
+	bp.score += pieceSquareScores[pc.color()][pc.pieceType()][sq]
+	bp.hash ^= zobristPieces[pc.color()][pc.pieceType()][sq]
+}
+
+func (bp *bitboardPosition) removePiece(sq int) {
+	pc := bp.squares[sq]
+	bp.squares[sq] = 0
+	bp.pieces[pc.color()][pc.pieceType()] &^= 1 << uint(sq)
+	bp.occupied[pc.color()] &^= 1 << uint(sq)
+	bp.score -= pieceSquareScores[pc.color()][pc.pieceType()][sq]
+	bp.hash ^= zobristPieces[pc.color()][pc.pieceType()][sq]
+}
+
+func (bp *bitboardPosition) movePiece(from int, to int) {
+	pc := bp.squares[from]
+	bp.removePiece(from)
+	bp.putPiece(to, pc)
+}
+
+func (bp *bitboardPosition) kingSquare(color int) int {
+	b := bp.pieces[color][kingType]
+	return popLowestSquare(&b)
+}
+
+// isSquareAttacked returns whether any of the pieces of the given colour attack the square. Each
+// type of piece attacks the square from where a piece of the same type on it would attack.
+func (bp *bitboardPosition) isSquareAttacked(sq int, by int) bool {
+	pieces := &bp.pieces[by]
+	occupied := bp.occupied[white] | bp.occupied[black]
+	return pawnAttacks[1-by][sq]&pieces[pawnType] != 0 ||
+		knightAttacks[sq]&pieces[knightType] != 0 ||
+		kingAttacks[sq]&pieces[kingType] != 0 ||
+		bishopAttacks(sq, occupied)&(pieces[bishopType]|pieces[queenType]) != 0 ||
+		rookAttacks(sq, occupied)&(pieces[rookType]|pieces[queenType]) != 0
+}
+
+func (bp *bitboardPosition) isKingInCheck() bool {
+	return bp.isSquareAttacked(bp.kingSquare(bp.sideToMove), 1-bp.sideToMove)
+}
+
+// generateMoves appends the legal moves for the side to move to moves, and returns it. Passing a
+// slice with spare capacity saves allocating one at every node of a search.
+func (bp *bitboardPosition) generateMoves(moves []bbMove) []bbMove {
+	start := len(moves)
+	moves = bp.generatePseudoLegalMoves(moves)
+
+	// Keep only the moves that don't leave the king in check. Unless the king's in check already,
+	// only moves of the king, pinned pieces or pawns taking en passant can do so, so only they
+	// need to be tried.
+	us := bp.sideToMove
+	king := bp.kingSquare(us)
+	mustTry := bp.getPinned(king) | 1<<uint(king)
+	if bp.isSquareAttacked(king, 1-us) {
+		mustTry = ^bitboard(0)
+	}
+
+	legal := start
+	for _, m := range moves[start:] {
+		if mustTry&(1<<uint(m.from())) != 0 || m&bbMoveEnPassant != 0 {
+			u := bp.makeMove(m)
+			inCheck := bp.isSquareAttacked(bp.kingSquare(us), 1-us)
+			bp.unmakeMove(m, u)
+			if inCheck {
+				continue
+			}
+		}
+
+		moves[legal] = m
+		legal++
+	}
+
+	return moves[:legal]
+}
+
+// getPinned returns the side to move's pieces that are pinned to its king, on the given square:
+// those that are the only piece between it and an opponent's rook, bishop or queen.
+func (bp *bitboardPosition) getPinned(king int) bitboard {
+	us, them := bp.sideToMove, 1-bp.sideToMove
+	pieces := &bp.pieces[them]
+	occupied := bp.occupied[white] | bp.occupied[black]
+
+	// The sliders that would attack the king if none of the side to move's pieces were in the way.
+	pinners := rookAttacks(king, bp.occupied[them])&(pieces[rookType]|pieces[queenType]) |
+		bishopAttacks(king, bp.occupied[them])&(pieces[bishopType]|pieces[queenType])
+
+	var pinned bitboard
+	for pinners != 0 {
+		between := squaresBetween[king][popLowestSquare(&pinners)] & occupied
+		if between != 0 && between&(between-1) == 0 && between&bp.occupied[us] != 0 {
+			pinned |= between
+		}
+	}
+
+	return pinned
+}
+
+// generatePseudoLegalMoves appends the moves the side to move's pieces can make, whether or not
+// they leave the king in check. Castling is only generated if it's legal, though.
+func (bp *bitboardPosition) generatePseudoLegalMoves(moves []bbMove) []bbMove {
+	us, them := bp.sideToMove, 1-bp.sideToMove
+	own, opponents := bp.occupied[us], bp.occupied[them]
+	occupied := own | opponents
+	pieces := &bp.pieces[us]
+
+	moves = bp.generatePawnMoves(moves, occupied, opponents)
+
+	for b := pieces[knightType]; b != 0; {
+		from := popLowestSquare(&b)
+		moves = appendMoves(moves, from, knightAttacks[from]&^own)
+	}
+	for b := pieces[bishopType] | pieces[queenType]; b != 0; {
+		from := popLowestSquare(&b)
+		moves = appendMoves(moves, from, bishopAttacks(from, occupied)&^own)
+	}
+	for b := pieces[rookType] | pieces[queenType]; b != 0; {
+		from := popLowestSquare(&b)
+		moves = appendMoves(moves, from, rookAttacks(from, occupied)&^own)
+	}
+	for b := pieces[kingType]; b != 0; {
+		from := popLowestSquare(&b)
+		moves = appendMoves(moves, from, kingAttacks[from]&^own)
+	}
+
+	return bp.generateCastlingMoves(moves, occupied)
+}
+
+func appendMoves(moves []bbMove, from int, targets bitboard) []bbMove {
+	for targets != 0 {
+		moves = append(moves, newBBMove(from, popLowestSquare(&targets)))
+	}
+	return moves
+}
+
+func (bp *bitboardPosition) generatePawnMoves(moves []bbMove, occupied bitboard, opponents bitboard) []bbMove {
+	us := bp.sideToMove
+	pawns := bp.pieces[us][pawnType]
+	forward, startRank, lastRank := 8, rank2, rank8
+	if us == black {
+		forward, startRank, lastRank = -8, rank7, rank1
+	}
+
+	for b := pawns; b != 0; {
+		from := popLowestSquare(&b)
+		to := from + forward
+		if occupied&(1<<uint(to)) == 0 {
+			moves = appendPawnMove(moves, from, to, lastRank)
+			if startRank&(1<<uint(from)) != 0 && occupied&(1<<uint(to+forward)) == 0 {
+				moves = append(moves, newBBMove(from, to+forward))
+			}
+		}
+
+		for targets := pawnAttacks[us][from] & opponents; targets != 0; {
+			moves = appendPawnMove(moves, from, popLowestSquare(&targets), lastRank)
+		}
+
+		if bp.enPassant >= 0 && pawnAttacks[us][from]&(1<<uint(bp.enPassant)) != 0 {
+			moves = append(moves, newBBMove(from, bp.enPassant)|bbMoveEnPassant)
+		}
+	}
+
+	return moves
+}
+
+func appendPawnMove(moves []bbMove, from int, to int, lastRank bitboard) []bbMove {
+	m := newBBMove(from, to)
+	if lastRank&(1<<uint(to)) == 0 {
+		return append(moves, m)
+	}
+
+	return append(moves, m.withPromotion(queenType), m.withPromotion(rookType), m.withPromotion(bishopType), m.withPromotion(knightType))
+}
+
+// generateCastlingMoves appends castling moves, if the side to move has the right, the squares
+// the king and rook move across are empty, and the king doesn't move out of, through or into
+// check. The king ends up on the g- or c-file, and the rook beside it on the f- or d-file.
+func (bp *bitboardPosition) generateCastlingMoves(moves []bbMove, occupied bitboard) []bbMove {
+	us, them := bp.sideToMove, 1-bp.sideToMove
+	for i := 2 * us; i < 2*us+2; i++ {
+		if bp.castlingRights&(1<<uint(i)) == 0 {
+			continue
+		}
+
+		king, rook := bp.kingSquare(us), bp.castlingRooks[i]
+		if bp.squares[rook] != newBBPiece(us, rookType) {
+			continue
+		}
+
+		kingTo, rookTo := getCastlingSquares(king, i)
+		path := getSquaresFromTo(king, kingTo) | getSquaresFromTo(rook, rookTo)
+		if path&occupied&^(1<<uint(king)|1<<uint(rook)) != 0 {
+			continue
+		}
+
+		attacked := false
+		for b := getSquaresFromTo(king, kingTo); b != 0 && !attacked; {
+			attacked = bp.isSquareAttacked(popLowestSquare(&b), them)
+		}
+		if !attacked {
+			moves = append(moves, newBBMove(king, kingTo)|bbMoveCastling)
+		}
+	}
+
+	return moves
+}
+
+// getCastlingSquares returns the squares the king and rook move to when castling with the given
+// right, from the king's square.
+func getCastlingSquares(king int, right int) (int, int) {
+	rankStart := king &^ 7
+	if right%2 == 0 {
+		return rankStart + 6, rankStart + 5
+	}
+
+	return rankStart + 2, rankStart + 3
+}
+
+// getSquaresFromTo returns the squares on a rank from one square to another, including both.
+func getSquaresFromTo(from int, to int) bitboard {
+	if from > to {
+		from, to = to, from
+	}
+
+	return (^bitboard(0) << uint(from)) & (^bitboard(0) >> uint(63-to))
+}
+
+// makeMove plays a move, which must be legal or at least pseudo-legal, and returns what's needed
+// to take it back with unmakeMove.
+func (bp *bitboardPosition) makeMove(m bbMove) bbUndo {
+	from, to := m.from(), m.to()
+	u := bbUndo{captured: bp.squares[to], castlingRights: bp.castlingRights, enPassant: bp.enPassant, halfmoveClock: bp.halfmoveClock, hash: bp.hash}
+	pc := bp.squares[from]
+
+	bp.halfmoveClock++
+	if bp.enPassant >= 0 {
+		bp.hash ^= zobristEnPassant[bp.enPassant%8]
+		bp.enPassant = -1
+	}
+
+	switch {
+	case m&bbMoveCastling != 0:
+		right := 2*bp.sideToMove + 1
+		if to%8 == 6 {
+			right--
+		}
+		rook := bp.castlingRooks[right]
+		_, rookTo := getCastlingSquares(from, right)
+
+		// In Chess960 the king or rook may already be where the other is going, so both are
+		// lifted off the board before either is put down.
+		bp.removePiece(rook)
+		bp.removePiece(from)
+		bp.putPiece(to, pc)
+		bp.putPiece(rookTo, newBBPiece(bp.sideToMove, rookType))
+		u.captured = 0
+	case m&bbMoveEnPassant != 0:
+		captureSquare := to - 8
+		if bp.sideToMove == black {
+			captureSquare = to + 8
+		}
+		u.captured = bp.squares[captureSquare]
+		bp.removePiece(captureSquare)
+		bp.movePiece(from, to)
+	default:
+		if u.captured != 0 {
+			bp.removePiece(to)
+		}
+		bp.movePiece(from, to)
+		if m.promotion() != 0 {
+			bp.removePiece(to)
+			bp.putPiece(to, newBBPiece(bp.sideToMove, m.promotion()))
+		}
+	}
+
+	if pc.pieceType() == pawnType || u.captured != 0 {
+		bp.halfmoveClock = 0
+	}
+
+	bp.hash ^= zobristCastling[bp.castlingRights]
+	bp.castlingRights &= bp.castlingMasks[from] & bp.castlingMasks[to]
+	if pc.pieceType() == kingType {
+		bp.castlingRights &^= (whiteKingsideRight | whiteQueensideRight) << uint(2*bp.sideToMove)
+	}
+	bp.hash ^= zobristCastling[bp.castlingRights]
+
+	if bp.sideToMove == black {
+		bp.fullmoveNumber++
+	}
+	bp.sideToMove = 1 - bp.sideToMove
+	bp.hash ^= zobristBlackToMove
+
+	if pc.pieceType() == pawnType && (to-from == 16 || from-to == 16) {
+		bp.setEnPassant((from + to) / 2)
+	}
+
+	return u
+}
+
+// setEnPassant sets the square a pawn that has just moved two squares passed over as the one it
+// can be taken en passant on, but only if the side to move can legally do so. Unlike position,
+// which keeps the square regardless, this keeps the hash the same for positions that count as
+// repeated.
+func (bp *bitboardPosition) setEnPassant(sq int) {
+	us := bp.sideToMove
+	for b := pawnAttacks[1-us][sq] & bp.pieces[us][pawnType]; b != 0; {
+		m := newBBMove(popLowestSquare(&b), sq) | bbMoveEnPassant
+		u := bp.makeMove(m)
+		legal := !bp.isSquareAttacked(bp.kingSquare(us), 1-us)
+		bp.unmakeMove(m, u)
+
+		if legal {
+			bp.enPassant = sq
+			bp.hash ^= zobristEnPassant[sq%8]
+			return
+		}
+	}
+}
+
+// unmakeMove takes back the last move made, restoring the position to how it was before.
+func (bp *bitboardPosition) unmakeMove(m bbMove, u bbUndo) {
+	bp.sideToMove = 1 - bp.sideToMove
+	if bp.sideToMove == black {
+		bp.fullmoveNumber--
+	}
+	bp.castlingRights = u.castlingRights
+	bp.enPassant = u.enPassant
+	bp.halfmoveClock = u.halfmoveClock
+
+	from, to := m.from(), m.to()
+	switch {
+	case m&bbMoveCastling != 0:
+		right := 2*bp.sideToMove + 1
+		if to%8 == 6 {
+			right--
+		}
+		_, rookTo := getCastlingSquares(from, right)
+		king := bp.squares[to]
+		bp.removePiece(rookTo)
+		bp.removePiece(to)
+		bp.putPiece(from, king)
+		bp.putPiece(bp.castlingRooks[right], newBBPiece(bp.sideToMove, rookType))
+	case m&bbMoveEnPassant != 0:
+		bp.movePiece(to, from)
+		captureSquare := to - 8
+		if bp.sideToMove == black {
+			captureSquare = to + 8
+		}
+		bp.putPiece(captureSquare, u.captured)
+	default:
+		if m.promotion() != 0 {
+			bp.removePiece(to)
+			bp.putPiece(to, newBBPiece(bp.sideToMove, pawnType))
+		}
+		bp.movePiece(to, from)
+		if u.captured != 0 {
+			bp.putPiece(to, u.captured)
+		}
+	}
+
+	bp.hash = u.hash
+}
+
+// hasInsufficientMaterial is board.hasInsufficientMaterial for a bitboardPosition.
+func (bp *bitboardPosition) hasInsufficientMaterial() bool {
+	var minors, bishops bitboard
+	for color := white; color <= black; color++ {
+		pieces := &bp.pieces[color]
+		if pieces[pawnType]|pieces[rookType]|pieces[queenType] != 0 {
+			return false
+		}
+		minors |= pieces[knightType] | pieces[bishopType]
+		bishops |= pieces[bishopType]
+	}
+
+	if minors&(minors-1) == 0 {
+		return true
+	}
+
+	// Only bishops, all on light squares or all on dark ones.
+	const darkSquares bitboard = 0xaa55aa55aa55aa55
+	return minors == bishops && (bishops&darkSquares == 0 || bishops&^darkSquares == 0)
+}
+
+// isLegal returns whether a move, from anywhere such as the transposition table, is one of the
+// legal moves in the position.
+func (bp *bitboardPosition) isLegal(m bbMove) bool {
+	var buffer [maxMoves]bbMove
+	for _, legal := range bp.generateMoves(buffer[:0]) {
+		if legal == m {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (bp *bitboardPosition) isCapture(m bbMove) bool {
+	return bp.squares[m.to()] != 0 && m&bbMoveCastling == 0 || m&bbMoveEnPassant != 0
+}
+
+// getBBMove returns the bbMove for a move in a position.
+func getBBMove(m move) bbMove {
+	bm := newBBMove(getSquareIndex(m.fromSquare), getSquareIndex(m.toSquare))
+	if m.promotion != "" {
+		bm = bm.withPromotion(strings.Index(pieceTypeNames, m.promotion))
+	}
+	if m.isCastling {
+		bm |= bbMoveCastling
+	}
+	if m.isEnPassant {
+		bm |= bbMoveEnPassant
+	}
+	return bm
+}
+
+// getMovesFromBBMoves returns the moves for a line of bbMoves played from a position, as found by
+// searching it, stopping at any that aren't legal.
+func getMovesFromBBMoves(p position, bbMoves []bbMove) []move {
+	var moves []move
+	for _, bm := range bbMoves {
+		m, ok := getMoveFromBBMove(p, bm)
+		if !ok {
+			break
+		}
+
+		p.makeMove(m)
+		moves = append(moves, m)
+	}
+
+	return moves
+}
+
+// getMoveFromBBMove returns the legal move in the position that a bbMove is, if it is one.
+func getMoveFromBBMove(p position, bm bbMove) (move, bool) {
+	for _, m := range generateLegalMoves(p) {
+		if getBBMove(m) == bm {
+			return m, true
+		}
+	}
+
+	return move{}, false
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSlidingAttacks(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for sq := 0; sq < 64; sq++ {
+		for i := 0; i < 100; i++ {
+			occupied := bitboard(rng.Uint64() & rng.Uint64())
+			if res, expected := rookAttacks(sq, occupied), getSlidingAttacks(sq, rookRays, occupied); res != expected {
+				t.Errorf("Expected rook attacks from %d with occupied %x to be %x, but got: %x", sq, occupied, expected, res)
+			}
+			if res, expected := bishopAttacks(sq, occupied), getSlidingAttacks(sq, bishopRays, occupied); res != expected {
+				t.Errorf("Expected bishop attacks from %d with occupied %x to be %x, but got: %x", sq, occupied, expected, res)
+			}
+		}
+	}
+}
+
+func TestLeaperAttacks(t *testing.T) {
+	tests := []struct {
+		attacks  bitboard
+		expected string
+	}{
+		{knightAttacks[getSquareIndex(square{"A", 1})], "b3 c2"},
+		{knightAttacks[getSquareIndex(square{"E", 4})], "c3 c5 d2 d6 f2 f6 g3 g5"},
+		{kingAttacks[getSquareIndex(square{"H", 8})], "g7 g8 h7"},
+		{pawnAttacks[white][getSquareIndex(square{"A", 2})], "b3"},
+		{pawnAttacks[black][getSquareIndex(square{"E", 7})], "d6 f6"},
+	}
+
+	for _, test := range tests {
+		if res := getBitboardNotation(test.attacks); res != test.expected {
+			t.Errorf("Expected attacks on %s, but got: %s", test.expected, res)
+		}
+	}
+}
+
+// getBitboardNotation lists the squares in a bitboard, sorted, e.g. "b3 c2".
+func getBitboardNotation(b bitboard) string {
+	var squares []string
+	for b != 0 {
+		squares = append(squares, getNotationForSquare(getSquareFromIndex(popLowestSquare(&b))))
+	}
+	sort.Strings(squares)
+	return strings.Join(squares, " ")
+}
+
+// getMoveNotations returns the moves generated both ways for a position, each sorted.
+func getMoveNotations(p position) (string, string) {
+	var moves, bbMoves []string
+	for _, m := range generateLegalMoves(p) {
+		moves = append(moves, m.String())
+	}
+
+	bp := newBitboardPosition(p)
+	for _, m := range bp.generateMoves(nil) {
+		bbMoves = append(bbMoves, m.String())
+	}
+
+	sort.Strings(moves)
+	sort.Strings(bbMoves)
+	return strings.Join(moves, " "), strings.Join(bbMoves, " ")
+}
+
+func TestBitboardGenerateMoves(t *testing.T) {
+	fens := []string{
+		"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1",
+		"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1",
+		"4k3/8/8/8/8/8/4r3/4K3 w - - 0 1",
+		"4k3/4r3/8/8/8/8/4B3/4K3 w - - 0 1",
+		"k7/3P4/8/8/8/8/8/4K3 w - - 0 1",
+		"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1",
+		"8/8/8/K2pP2r/8/8/8/7k w - d6 0 1",
+		"r3k2r/8/8/8/8/8/8/R3K1R1 b Qkq - 0 1",
+		"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1",
+	}
+	for _, test := range perftTests {
+		fens = append(fens, test.fen)
+	}
+
+	for _, fen := range fens {
+		p, err := parseFEN(fen)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", fen, err)
+		}
+
+		if expected, res := getMoveNotations(p); res != expected {
+			t.Errorf("Expected moves for %s to be:\n%s\nbut got:\n%s", fen, expected, res)
+		}
+	}
+}
+
+// TestBitboardRandomGames plays random games, checking at every move that the bitboard position
+// generates the same moves, evaluates the same and is kept the same as the position it came from.
+func TestBitboardRandomGames(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	games := 50
+	if testing.Short() {
+		games = 10
+	}
+
+	for i := 0; i < games; i++ {
+		p := newPosition()
+		bp := newBitboardPosition(p)
+		for ply := 0; ply < 200; ply++ {
+			if expected, res := getMoveNotations(p); res != expected {
+				t.Fatalf("Expected moves for %s to be:\n%s\nbut got:\n%s", p.toFEN(), expected, res)
+			}
+
+			if expected, res := evaluate(p), bp.evaluate(); res != expected {
+				t.Fatalf("Expected evaluation of %s to be %d, but got: %d", p.toFEN(), expected, res)
+			}
+
+			if expected := newBitboardPosition(p); bp != expected {
+				t.Fatalf("Expected bitboard position to be kept the same as %s, but got: %+v", p.toFEN(), bp)
+			}
+
+			moves := generateLegalMoves(p)
+			if len(moves) == 0 || p.halfmoveClock >= fiftyMoveRuleHalfmoves {
+				break
+			}
+
+			m := moves[rng.Intn(len(moves))]
+			p.makeMove(m)
+			before := bp
+			bm := getBBMove(m)
+			u := bp.makeMove(bm)
+			bp.unmakeMove(bm, u)
+			if bp != before {
+				t.Fatalf("Expected unmaking %s to restore the bitboard position, but got: %+v", m, bp)
+			}
+			bp.makeMove(bm)
+		}
+	}
+}
+
+func TestGetMovesFromBBMoves(t *testing.T) {
+	p, _ := parseFEN("r3k3/1P6/8/3pP3/8/8/8/R3K2R w KQq d6 0 1")
+	bbMoves := []bbMove{
+		newBBMove(36, 43) | bbMoveEnPassant,
+		newBBMove(56, 48),
+		newBBMove(4, 6) | bbMoveCastling,
+		newBBMove(60, 59),
+		newBBMove(49, 57).withPromotion(queenType),
+	}
+
+	moves := getMovesFromBBMoves(p, bbMoves)
+	if len(moves) != 5 || !moves[0].isEnPassant || !moves[2].isCastling || moves[4].promotion != "Q" {
+		t.Fatalf("Expected taking en passant, castling then promotion, but got: %v", moves)
+	}
+
+	for i, m := range moves {
+		if res := getBBMove(m); res != bbMoves[i] {
+			t.Errorf("Expected %s to convert back to %s, but got: %s", m, bbMoves[i], res)
+		}
+	}
+}
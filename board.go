@@ -17,11 +17,21 @@ type square struct {
 
 type board [BoardSize][BoardSize]gamePiece
 
+// standardBackRank is the order of the pieces on the first and last ranks at the start of a game
+// of standard chess, from the a-file to the h-file.
+const standardBackRank = "RNBQKBNR"
+
 func (b *board) init() {
+	b.initWithBackRank(standardBackRank)
+}
+
+// initWithBackRank sets up the board for the start of a game with the pieces on the first and
+// last ranks in the given order, as they are in Chess960.
+func (b *board) initWithBackRank(backRank string) {
 	b.clear()
 	initPawns(b)
-	initPieces(b, "B", 0)
-	initPieces(b, "W", BoardSize-1)
+	initPieces(b, "B", 0, backRank)
+	initPieces(b, "W", BoardSize-1, backRank)
 }
 
 func (b *board) clear() {
@@ -39,15 +49,11 @@ func initPawns(b *board) {
 	}
 }
 
-func initPieces(b *board, color string, row int) {
-	(*b)[row][0] = gamePiece{color: color, piece: rook{}}
-	(*b)[row][1] = gamePiece{color: color, piece: knight{}}
-	(*b)[row][2] = gamePiece{color: color, piece: bishop{}}
-	(*b)[row][3] = gamePiece{color: color, piece: queen{}}
-	(*b)[row][4] = gamePiece{color: color, piece: king{}}
-	(*b)[row][5] = gamePiece{color: color, piece: bishop{}}
-	(*b)[row][6] = gamePiece{color: color, piece: knight{}}
-	(*b)[row][7] = gamePiece{color: color, piece: rook{}}
+func initPieces(b *board, color string, row int, backRank string) {
+	for i := 0; i < BoardSize; i++ {
+		piece, _ := getPieceFromName(backRank[i : i+1])
+		(*b)[row][i] = gamePiece{color: color, piece: piece}
+	}
 }
 
 func (b board) isSquareEmpty(sq square) bool {
@@ -67,13 +73,17 @@ func (b board) getPieceAt(sq square) (gamePiece, error) {
 	return b[row][col], nil
 }
 
-func (b *board) addPieceAt(sq square, name string, color string) {
-	row, col := getRowColForSquare(sq)
-	b.setSquareEmpty(row, col)
+// addPieceAt puts a new piece on the square, replacing any piece there. The board is left as it
+// was if the piece's name isn't recognised.
+func (b *board) addPieceAt(sq square, name string, color string) error {
+	piece, err := getPieceFromName(name)
+	if err != nil {
+		return err
+	}
 
-	piece, _ := getPieceFromName(name)
-	gp := gamePiece{color: color, piece: piece}
-	(*b)[row][col] = gp
+	row, col := getRowColForSquare(sq)
+	(*b)[row][col] = gamePiece{color: color, piece: piece}
+	return nil
 }
 
 func getPieceFromName(name string) (piece, error) {
@@ -126,7 +136,10 @@ func getSquaresBetween(sq1 square, sq2 square) []square {
 			squares = append(squares, square{file: toFileStr(i), rank: sq1.rank})
 		}
 	} else if maxRank-minRank == maxFile-minFile {
-		// Diagonal squares between
+		// Diagonal squares between, working up from the lower ranked square
+		if sq1.rank > sq2.rank {
+			sq1, sq2 = sq2, sq1
+		}
 		var leftRightDirection int
 		if sq2.file > sq1.file {
 			leftRightDirection = 1
@@ -143,191 +156,229 @@ func getSquaresBetween(sq1 square, sq2 square) []square {
 	return squares
 }
 
-func (b board) areEmptySquaresBetween(sq1 square, sq2 square) bool {
-	squares := getSquaresBetween(sq1, sq2)
-	if len(squares) == 0 {
-		return false
-	}
-
-	for _, sq := range squares {
-		if !b.isSquareEmpty(sq) {
-			return false
-		}
-	}
-
-	return true
-}
-
+// movePiece moves the piece on fromSquare to toSquare, taking any piece there. It's only the
+// piece's own move: the rook's move when castling and the pawn taken en passant are made along
+// with it by playMove.
 func (b *board) movePiece(fromSquare square, toSquare square) {
 	fromRow, fromCol := getRowColForSquare(fromSquare)
 	toRow, toCol := getRowColForSquare(toSquare)
 
-	isDestinationSquareEmpty := b.isSquareEmpty(toSquare)
-
 	(*b)[toRow][toCol] = b[fromRow][fromCol]
 	(*b)[toRow][toCol].moved = true
 	(*b)[toRow][toCol].numberOfMoves++
 	b.setSquareEmpty(fromRow, fromCol)
+}
 
-	if isCastling(b[toRow][toCol], fromCol, toCol) {
-		moveCastledRook(b, fromRow, toCol)
+// movePieceAndPromote moves a piece as movePiece does, then if a promotion piece name is given,
+// replaces the moved pawn with it.
+func (b *board) movePieceAndPromote(fromSquare square, toSquare square, promotion string) {
+	piece, _ := b.getPieceAt(fromSquare)
+	b.movePiece(fromSquare, toSquare)
+	if promotion != "" {
+		// This can't fail: moves only get a promotion piece from generateLegalMoves, from input
+		// that's been checked against the pieces the variant allows, or as a queen with auto-queen,
+		// all of which addPieceAt knows.
+		_ = b.addPieceAt(toSquare, promotion, piece.color)
 	}
+}
 
-	if isTakingEnPassant(b[toRow][toCol], fromCol, toCol, isDestinationSquareEmpty) {
-		if toRow > fromRow {
-			b.setSquareEmpty(toRow-1, toCol)
-		} else {
-			b.setSquareEmpty(toRow+1, toCol)
-		}
+// playMove moves the pieces on the board for a move, including the rook when castling and the
+// pawn taken en passant, or puts down a dropped piece.
+func (b *board) playMove(m move) {
+	if m.isDrop {
+		b.putMovedPiece(m.piece, m.toSquare)
+		return
+	}
+
+	if m.isEnPassant {
+		b.setSquareEmpty(getRowColForSquare(square{file: m.toSquare.file, rank: m.fromSquare.rank}))
 	}
+
+	if m.isCastling {
+		// In Chess960 the king or rook may already be where the other is going, so both are
+		// lifted off the board before either is put down.
+		rookSquares := getCastledRookSquares(m)
+		king, _ := b.getPieceAt(m.fromSquare)
+		rook, _ := b.getPieceAt(rookSquares[0])
+		b.setSquareEmpty(getRowColForSquare(m.fromSquare))
+		b.setSquareEmpty(getRowColForSquare(rookSquares[0]))
+		b.putMovedPiece(king, m.toSquare)
+		b.putMovedPiece(rook, rookSquares[1])
+		return
+	}
+
+	b.movePieceAndPromote(m.fromSquare, m.toSquare, m.promotion)
 }
 
-func isCastling(gp gamePiece, fromCol int, toCol int) bool {
-	return gp.getName() == "K" && math.Abs(float64(fromCol)-float64(toCol)) == 2
+// putMovedPiece puts a piece that's moving down on a square, as movePiece does.
+func (b *board) putMovedPiece(gp gamePiece, sq square) {
+	gp.moved = true
+	gp.numberOfMoves++
+	row, col := getRowColForSquare(sq)
+	(*b)[row][col] = gp
 }
 
-func moveCastledRook(b *board, row int, kingCol int) {
-	var currentSquare square
-	var newSquare square
-	if kingCol > BoardSize/2 {
-		currentSquare = square{rank: BoardSize - row, file: toFileStr(BoardSize - 1)}
-		newSquare = square{rank: BoardSize - row, file: toFileStr(kingCol - 1)}
-	} else {
-		currentSquare = square{rank: BoardSize - row, file: toFileStr(0)}
-		newSquare = square{rank: BoardSize - row, file: toFileStr(kingCol + 1)}
+// unplayMove takes back playMove, putting the pieces back as they were before the move. The
+// castled rook is needed to restore the rook's state when taking back castling.
+func (b *board) unplayMove(m move, castledRook gamePiece) {
+	fromRow, fromCol := getRowColForSquare(m.fromSquare)
+	toRow, toCol := getRowColForSquare(m.toSquare)
+
+	if m.isDrop {
+		b.setSquareEmpty(toRow, toCol)
+		return
 	}
 
-	fmt.Println("moving rook", currentSquare, newSquare)
-	b.movePiece(currentSquare, newSquare)
+	if m.isCastling {
+		rookSquares := getCastledRookSquares(m)
+		b.setSquareEmpty(toRow, toCol)
+		b.setSquareEmpty(getRowColForSquare(rookSquares[1]))
+		(*b)[fromRow][fromCol] = m.piece
+		rookRow, rookCol := getRowColForSquare(rookSquares[0])
+		(*b)[rookRow][rookCol] = castledRook
+		return
+	}
+
+	(*b)[fromRow][fromCol] = m.piece
+	if m.isEnPassant {
+		b.setSquareEmpty(toRow, toCol)
+		(*b)[fromRow][toCol] = m.captured
+	} else {
+		(*b)[toRow][toCol] = m.captured
+	}
 }
 
-func isTakingEnPassant(gp gamePiece, fromCol int, toCol int, isDestinationSquareEmpty bool) bool {
-	return gp.getName() == "P" &&
-		math.Abs(float64(fromCol)-float64(toCol)) == 1 &&
-		isDestinationSquareEmpty
+// getCastledRookSquares returns the square the rook moves from, and the one it moves to, when
+// castling. The king ends up on the g- or c-file, and the rook beside it on the f- or d-file.
+func getCastledRookSquares(m move) [2]square {
+	if m.toSquare.file == "G" {
+		return [2]square{m.rookSquare, {file: "F", rank: m.toSquare.rank}}
+	}
+
+	return [2]square{m.rookSquare, {file: "D", rank: m.toSquare.rank}}
 }
 
 func (b *board) setSquareEmpty(row int, col int) {
 	(*b)[row][col] = gamePiece{}
 }
 
+// isKingInCheck returns whether the side's king is in check, and the squares of the pieces giving
+// check. A side with no king, as in horde, is never in check.
 func (b board) isKingInCheck(color string) (bool, []square) {
-	kingSquare, _ := b.getSquareForPiece(color, "K")
+	kingSquare, err := b.getSquareForPiece(color, "K")
+	if err != nil {
+		return false, nil
+	}
 
 	// To determine if king is in check, we can more generally check if the piece can be "taken",
 	// i.e. is en prise.
 	return isSquareEnPrise(b, kingSquare, color)
 }
 
+// isKingInCheckMate returns whether the side's king is checkmated on the board, and why or why
+// not. The board has no pockets, so in crazyhouse, where a check can also be blocked by dropping a
+// piece, position's isCheckMate is needed.
 func (b board) isKingInCheckMate(color string) (bool, string) {
 	// If king not in check, can't be in check-mate.
-	kingInCheck, checkingSquares := b.isKingInCheck(color)
+	kingInCheck, _ := b.isKingInCheck(color)
 	if !kingInCheck {
 		return false, "Not in check"
 	}
 
-	// King is in check.  It won't be check-mate though, if:
-	kingSquare, _ := b.getSquareForPiece(color, "K")
-	king, _ := b.getPieceAt(kingSquare)
-	var opponentColor string
-	if color == "W" {
-		opponentColor = "B"
-	} else {
-		opponentColor = "W"
+	// King is in check.  It won't be check-mate though, if there's any legal move, as a move
+	// is only legal if it takes the king out of check (by moving it, taking or blocking).
+	moves := generateLegalMoves(newPositionFromBoard(b, color))
+	if len(moves) > 0 {
+		return false, fmt.Sprintf("In check, but %s on %v can move to %v", moves[0].piece.getName(), moves[0].fromSquare, moves[0].toSquare)
 	}
 
-	// - king has legal moves, and at least one moves it out of check
-	if kingCanMoveOutOfCheck(b, kingSquare, king, color) {
-		return false, "King can move out of check"
-	}
-
-	// - OR any piece has a legal move that takes the checking piece (if there's only one of them),
-	//   unless the only piece that can take is the king, which would then still be in check)
-	if len(checkingSquares) == 1 {
-		isSquareEnPrise, takingSquares := isSquareEnPrise(b, checkingSquares[0], opponentColor)
-		if isSquareEnPrise && (len(takingSquares) > 1 || !takingPieceIsKingMovingToCheck(b, takingSquares[0], checkingSquares[0])) {
-			return false, "Checking piece can be taken"
-		}
-	}
+	return true, "In check, and no legal moves"
+}
 
-	// - OR check can be blocked by a piece
-	// -- if more than one checking piece, can't be blocked
-	if len(checkingSquares) > 1 {
-		return true, "In check, and more than one checking piece so can't block or take"
-	}
+// Offsets, in rows and columns, of the directions pieces attack along or jump to.
+var (
+	rookDirections   = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	bishopDirections = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+	knightJumps      = [][2]int{{2, 1}, {2, -1}, {-2, 1}, {-2, -1}, {1, 2}, {1, -2}, {-1, 2}, {-1, -2}}
+	kingDirections   = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
 
-	// -- knights can't be blocked
-	checkingPiece, _ := b.getPieceAt(checkingSquares[0])
-	if checkingPiece.getName() == "N" {
-		return true, "In check, can't take and checking piece is a knight so can't be blocked"
+func isSquareEnPrise(b board, pieceSquare square, color string) (bool, []square) {
+	// To determine if a square is en prise, we look at whether any of the opponent's pieces
+	// attack it. Rather than working out where each of them can move, it's quicker to look
+	// outwards from the square, along the lines and jumps a piece would have to attack it from.
+	var takingSquares []square
+	row, col := getRowColForSquare(pieceSquare)
+	isAttacker := func(r int, c int, names string) bool {
+		gp := b[r][c]
+		return gp.piece != nil && gp.color != color && strings.Contains(names, gp.getName())
 	}
 
-	// -- if piece is adjacent, can't be blocked
-	if math.Abs(float64(checkingSquares[0].rank-kingSquare.rank)) <= 1 &&
-		math.Abs(float64(fromFileStr(checkingSquares[0].file)-fromFileStr(kingSquare.file))) <= 1 {
-		return true, "In check, can't take and checking piece is adjacent so can't be blocked"
-	}
+	for _, directions := range []struct {
+		offsets [][2]int
+		names   string
+	}{{rookDirections, "RQ"}, {bishopDirections, "BQ"}} {
+		for _, d := range directions.offsets {
+			for r, c := row+d[0], col+d[1]; r >= 0 && r < BoardSize && c >= 0 && c < BoardSize; r, c = r+d[0], c+d[1] {
+				if b.isRowColEmpty(r, c) {
+					continue
+				}
 
-	// -- can block if any piece has a legal move that intercepts the vertical, horizontal or
-	//    diagonal line between the single checking piece and the king
-	for _, squareBetween := range getSquaresBetween(kingSquare, checkingSquares[0]) {
-		for i := 0; i < BoardSize; i++ {
-			for j := 0; j < BoardSize; j++ {
-				if !b.isRowColEmpty(i, j) {
-					piece := b[i][j]
-					if piece.color == color && piece.getName() != "K" {
-						square := getSquareForRowCol(i, j)
-						for _, legalSquare := range piece.getLegalSquares(b, square, piece.color, piece.moved) {
-							if areSquaresEqual(squareBetween, legalSquare) {
-								return false, fmt.Sprintf("In check, can't take but piece %s on %v can block", piece.getName(), square)
-							}
-						}
-					}
+				if isAttacker(r, c, directions.names) {
+					takingSquares = append(takingSquares, getSquareForRowCol(r, c))
 				}
+				break
 			}
 		}
 	}
 
-	return true, "In check, can't take or block"
-}
+	for _, jump := range knightJumps {
+		r, c := row+jump[0], col+jump[1]
+		if r >= 0 && r < BoardSize && c >= 0 && c < BoardSize && isAttacker(r, c, "N") {
+			takingSquares = append(takingSquares, getSquareForRowCol(r, c))
+		}
+	}
 
-func isSquareEnPrise(b board, pieceSquare square, color string) (bool, []square) {
-	// To determine if a square is en prise is in check, we look at legal moves for all
-	// the opponent's pieces, and if they include the piece, it's en prise.
-	var takingSquares []square
-	for i := 0; i < BoardSize; i++ {
-		for j := 0; j < BoardSize; j++ {
-			if !b.isRowColEmpty(i, j) {
-				piece := b[i][j]
-				if piece.color != color {
-					square := getSquareForRowCol(i, j)
-					legalSquares := piece.getLegalSquares(b, square, piece.color, piece.moved)
-					for _, sq := range legalSquares {
-						if sq.rank == pieceSquare.rank && sq.file == pieceSquare.file {
-							takingSquares = append(takingSquares, square)
-							break
-						}
-					}
-				}
-			}
+	for _, d := range kingDirections {
+		r, c := row+d[0], col+d[1]
+		if r >= 0 && r < BoardSize && c >= 0 && c < BoardSize && isAttacker(r, c, "K") {
+			takingSquares = append(takingSquares, getSquareForRowCol(r, c))
 		}
 	}
 
-	if (len(takingSquares)) > 0 {
-		return true, takingSquares
+	// Pawns attack diagonally forwards, so a white pawn attacks from the row below, which is the
+	// next row down the board array, and a black pawn from the row above.
+	pawnRow := row + 1
+	if color == "W" {
+		pawnRow = row - 1
+	}
+	for _, c := range []int{col - 1, col + 1} {
+		if pawnRow >= 0 && pawnRow < BoardSize && c >= 0 && c < BoardSize && isAttacker(pawnRow, c, "P") {
+			takingSquares = append(takingSquares, getSquareForRowCol(pawnRow, c))
+		}
 	}
 
-	return false, takingSquares
+	return len(takingSquares) > 0, takingSquares
 }
 
-func kingCanMoveOutOfCheck(b board, kingSquare square, k gamePiece, color string) bool {
-	legalSquares := k.getLegalSquares(b, kingSquare, color, k.moved)
-	if len(legalSquares) > 0 {
-		for _, sq := range legalSquares {
-			tempBoard := b
-			tempBoard.movePiece(kingSquare, sq)
-			movedKingInCheck, _ := tempBoard.isKingInCheck(color)
-			if !movedKingInCheck {
+// isSquareAttackedBy returns whether the piece on pieceSquare could take on targetSquare, if there
+// was an opponent's piece there. For most pieces that's when they can move there, but pawns
+// only take diagonally, and whether or not there's a piece to take, and kings don't take by
+// castling.
+func isSquareAttackedBy(b board, gp gamePiece, pieceSquare square, targetSquare square) bool {
+	switch gp.getName() {
+	case "P":
+		direction := 1
+		if gp.color == "B" {
+			direction = -1
+		}
+		fileDistance := math.Abs(float64(fromFileStr(pieceSquare.file) - fromFileStr(targetSquare.file)))
+		return targetSquare.rank == pieceSquare.rank+direction && fileDistance == 1
+	case "K":
+		return areSquaresAdjacent(pieceSquare, targetSquare) && !areSquaresEqual(pieceSquare, targetSquare)
+	default:
+		for _, sq := range gp.getLegalSquares(b, pieceSquare, gp.color) {
+			if areSquaresEqual(sq, targetSquare) {
 				return true
 			}
 		}
@@ -336,24 +387,14 @@ func kingCanMoveOutOfCheck(b board, kingSquare square, k gamePiece, color string
 	return false
 }
 
-func takingPieceIsKingMovingToCheck(b board, fromSquare square, toSquare square) bool {
-	takingPiece, _ := b.getPieceAt(fromSquare)
-	if takingPiece.getName() != "K" {
-		return false
-	}
-
-	tempBoard := b
-	tempBoard.movePiece(fromSquare, toSquare)
-	isKingInCheck, _ := b.isKingInCheck(takingPiece.color)
-	return isKingInCheck
-}
-
+// getSquareForPiece returns the square of the first of the side's pieces of the type found on the
+// board, from a8 to h1, or an error if it has none, as when a side has no king in some variants.
 func (b board) getSquareForPiece(color string, name string) (square, error) {
 	for i := 0; i < BoardSize; i++ {
 		for j := 0; j < BoardSize; j++ {
 			if !b.isRowColEmpty(i, j) {
 				piece := b[i][j]
-				if piece.color == color && piece.getName() == "K" {
+				if piece.color == color && piece.getName() == name {
 					return getSquareForRowCol(i, j), nil
 				}
 			}
@@ -363,8 +404,13 @@ func (b board) getSquareForPiece(color string, name string) (square, error) {
 	return square{}, fmt.Errorf("Piece %s%s not found", color, name)
 }
 
-func (b board) print() {
+// print prints the board, with white at the bottom, and any notes on each side, by colour index,
+// on that side of it, such as the pieces in its pocket in crazyhouse.
+func (b board) print(notes [2]string) {
 	fmt.Println()
+	if notes[black] != "" {
+		fmt.Println(notes[black])
+	}
 	printRankSeparator(b)
 	for i := 0; i < BoardSize; i++ {
 		fmt.Printf("%d ", BoardSize-i)
@@ -386,6 +432,9 @@ func (b board) print() {
 	}
 
 	fmt.Println()
+	if notes[white] != "" {
+		fmt.Println(notes[white])
+	}
 	fmt.Println()
 }
 
@@ -64,6 +64,12 @@ func TestGetSquaresBetween(t *testing.T) {
 		t.Errorf("Expected %d diagonal squares between, but got: %d (%v)", expectedCount, len(res), res)
 	}
 
+	res = getSquaresBetween(square{file: "E", rank: 8}, square{file: "H", rank: 5})
+	expectedCount = 2
+	if len(res) != expectedCount || !areSquaresEqual(res[0], square{file: "G", rank: 6}) || !areSquaresEqual(res[1], square{file: "F", rank: 7}) {
+		t.Errorf("Expected %d diagonal squares between G6 and F7, but got: %d (%v)", expectedCount, len(res), res)
+	}
+
 	res = getSquaresBetween(square{file: "A", rank: 1}, square{file: "H", rank: 7})
 	expectedCount = 0
 	if len(res) != expectedCount {
@@ -292,3 +298,21 @@ func TestIsKingInCheckMate(t *testing.T) {
 		t.Errorf("King reported to not be in in check-mate but is. Reason: %s", reason)
 	}
 }
+
+func TestAddPieceAt(t *testing.T) {
+	var b board
+	sq := square{file: "E", rank: 8}
+	if err := b.addPieceAt(sq, "Q", "W"); err != nil || b.isSquareEmpty(sq) {
+		t.Fatalf("Expected a queen to be added on e8, but got: %v", err)
+	}
+
+	for _, name := range []string{"", "X", "q"} {
+		if err := b.addPieceAt(sq, name, "W"); err == nil {
+			t.Errorf("Expected an error adding a piece named %q, but got none", name)
+		}
+
+		if piece, _ := b.getPieceAt(sq); piece.getName() != "Q" {
+			t.Errorf("Expected adding a piece named %q to leave the queen on e8, but got: %v", name, piece)
+		}
+	}
+}
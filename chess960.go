@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// chess960Positions is the number of starting positions in Chess960.
+const chess960Positions = 960
+
+// chess960KnightPlacements are where the knights go among the five squares left once the bishops
+// and queen are placed, for each of the ten ways they can be placed, in Scharnagl's numbering.
+var chess960KnightPlacements = [10][2]int{
+	{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4},
+}
+
+// getChess960BackRank returns the order of the pieces on the first rank, from the a-file to the
+// h-file, in the Chess960 starting position with the given number from 0 to 959, as numbered by
+// Scharnagl. Standard chess is number 518.
+func getChess960BackRank(n int) (string, error) {
+	if n < 0 || n >= chess960Positions {
+		return "", fmt.Errorf("Chess960 position %d not valid (must be from 0 to %d).", n, chess960Positions-1)
+	}
+
+	var backRank [BoardSize]byte
+	backRank[n%4*2+1] = 'B'
+	n /= 4
+	backRank[n%4*2] = 'B'
+	n /= 4
+	placeOnEmptySquare(&backRank, n%6, 'Q')
+	n /= 6
+
+	// The knights go on the later of the two squares first, so the earlier one is still counted
+	// the same among those left empty.
+	placeOnEmptySquare(&backRank, chess960KnightPlacements[n][1], 'N')
+	placeOnEmptySquare(&backRank, chess960KnightPlacements[n][0], 'N')
+
+	// The king goes between the rooks on the three squares left.
+	for _, name := range "RKR" {
+		placeOnEmptySquare(&backRank, 0, byte(name))
+	}
+
+	return string(backRank[:]), nil
+}
+
+// placeOnEmptySquare puts a piece on the back rank's i-th empty square, counting from 0.
+func placeOnEmptySquare(backRank *[BoardSize]byte, i int, name byte) {
+	for col := range backRank {
+		if backRank[col] != 0 {
+			continue
+		}
+
+		if i == 0 {
+			backRank[col] = name
+			return
+		}
+		i--
+	}
+}
+
+// newChess960Position returns the Chess960 starting position with the given number, with each
+// side able to castle with either of its rooks.
+func newChess960Position(n int) (position, error) {
+	backRank, err := getChess960BackRank(n)
+	if err != nil {
+		return position{}, err
+	}
+
+	p := position{sideToMove: "W", fullmoveNumber: 1, chess960: true}
+	p.board.initWithBackRank(backRank)
+	p.castlingRights = castlingRights{true, true, true, true}
+	rooks := []string{toFileStr(strings.LastIndex(backRank, "R")), toFileStr(strings.Index(backRank, "R"))}
+	for right := range p.castlingFiles {
+		if file := rooks[right%2]; file != p.getCastlingRookSquare(right).file {
+			p.castlingFiles[right] = file
+		}
+	}
+
+	p.hash = p.getHash()
+	return p, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetChess960BackRank(t *testing.T) {
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{0, "BBQNNRKR"},
+		{1, "BQNBNRKR"},
+		{518, "RNBQKBNR"},
+		{959, "RKRNNQBB"},
+	}
+
+	for _, test := range tests {
+		res, err := getChess960BackRank(test.n)
+		if err != nil || res != test.expected {
+			t.Errorf("Expected Chess960 position %d to be %s, but got: %s (%v)", test.n, test.expected, res, err)
+		}
+	}
+
+	for _, n := range []int{-1, 960} {
+		if _, err := getChess960BackRank(n); err == nil {
+			t.Errorf("Expected an error for Chess960 position %d, but got none", n)
+		}
+	}
+}
+
+func TestGetChess960BackRankGivesEveryPosition(t *testing.T) {
+	seen := map[string]bool{}
+	for n := 0; n < chess960Positions; n++ {
+		backRank, _ := getChess960BackRank(n)
+		seen[backRank] = true
+
+		bishops := []int{strings.Index(backRank, "B"), strings.LastIndex(backRank, "B")}
+		rooks := []int{strings.Index(backRank, "R"), strings.LastIndex(backRank, "R")}
+		king := strings.Index(backRank, "K")
+		if bishops[0]%2 == bishops[1]%2 || king < rooks[0] || king > rooks[1] ||
+			strings.Count(backRank, "N") != 2 || strings.Count(backRank, "Q") != 1 {
+			t.Errorf("Expected Chess960 position %d to have bishops on opposite colours and the king between the rooks, but got: %s", n, backRank)
+		}
+	}
+
+	if len(seen) != chess960Positions {
+		t.Errorf("Expected %d different Chess960 positions, but got: %d", chess960Positions, len(seen))
+	}
+}
+
+func TestNewChess960Position(t *testing.T) {
+	p, _ := newChess960Position(0)
+	expected := "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1"
+	if p.toFEN() != expected || !p.chess960 {
+		t.Errorf("Expected Chess960 position 0 to be %s, but got: %s", expected, p.toFEN())
+	}
+
+	standard, _ := newChess960Position(518)
+	standard.chess960 = false
+	if standard != newPosition() {
+		t.Errorf("Expected Chess960 position 518 to be the standard starting position, but got: %s", standard.toFEN())
+	}
+}
+
+func TestChess960Castling(t *testing.T) {
+	tests := []struct {
+		fen      string
+		move     string
+		san      string
+		expected string
+	}{
+		// Test: the king doesn't move, castling with the rook on h1
+		{"4k3/8/8/8/8/8/8/R5KR w HA - 0 1", "g1h1", "O-O", "4k3/8/8/8/8/8/8/R4RK1 b - - 1 1"},
+		// Test: the king moves one file, written as the king taking its rook
+		{"4k3/8/8/8/8/8/8/RK5R w HA - 0 1", "b1a1", "O-O-O", "4k3/8/8/8/8/8/8/2KR3R b - - 1 1"},
+		// Test: moving the king one file is still a king move
+		{"4k3/8/8/8/8/8/8/RK5R w HA - 0 1", "b1c1", "Kc1", "4k3/8/8/8/8/8/8/R1K4R b - - 1 1"},
+		// Test: the king and rook swap squares
+		{"4k3/8/8/8/8/8/8/R4KR1 w GA - 0 1", "f1g1", "O-O", "4k3/8/8/8/8/8/8/R4RK1 b - - 1 1"},
+		// Test: the rook doesn't move
+		{"4k3/8/8/8/8/8/8/R3KR2 w FA - 0 1", "e1g1", "O-O", "4k3/8/8/8/8/8/8/R4RK1 b - - 1 1"},
+		// Test: castling with the inner of two rooks
+		{"4k3/8/8/8/8/8/8/1K2R2R w E - 0 1", "b1e1", "O-O", "4k3/8/8/8/8/8/8/5RKR b - - 1 1"},
+		// Test: a king move two files in standard chess, or the king taking its rook, is castling
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8c8", "O-O-O", "2kr3r/8/8/8/8/8/8/R3K2R w KQ - 1 2"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8h8", "O-O", "r4rk1/8/8/8/8/8/8/R3K2R w KQ - 1 2"},
+	}
+
+	for _, test := range tests {
+		p, err := parseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		m, err := getUCIMove(p, test.move)
+		if err != nil {
+			t.Errorf("Expected %s to be legal in %s, but got: %s", test.move, test.fen, err)
+			continue
+		}
+
+		if san := getSAN(p, m); san != test.san {
+			t.Errorf("Expected %s in %s to be %s, but got: %s", test.move, test.fen, test.san, san)
+		}
+
+		bp := newBitboardPosition(p)
+		bp.makeMove(getBBMove(m))
+		p.makeMove(m)
+		if p.toFEN() != test.expected {
+			t.Errorf("Expected FEN after %s in %s to be %s, but got: %s", test.move, test.fen, test.expected, p.toFEN())
+		}
+
+		if expected := newBitboardPosition(p); bp != expected {
+			t.Errorf("Expected bitboard position after %s in %s to be the same as %s", test.move, test.fen, test.expected)
+		}
+	}
+}
+
+func TestChess960CastlingNotAllowed(t *testing.T) {
+	tests := []struct {
+		fen         string
+		move        string
+		description string
+	}{
+		{"4k3/8/8/8/8/8/8/RK1N3R w HA - 0 1", "b1a1", "a piece on the rook's way"},
+		{"4k3/8/8/8/8/8/8/R1N3KR w HA - 0 1", "g1a1", "a piece on the king's way"},
+		{"4r1k1/8/8/8/8/8/8/RK5R w HA - 0 1", "b1h1", "the king crossing an attacked square"},
+		{"6k1/8/8/8/8/8/8/qRK4R w HB - 0 1", "c1b1", "the rook no longer shielding the king"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		if m, err := getUCIMove(p, test.move); err == nil {
+			t.Errorf("Expected castling with %s to be illegal with %s, but got: %+v", test.move, test.description, m)
+		}
+
+		if res := perft(p, 1); res != len(generateLegalMoves(p)) {
+			t.Errorf("Expected the bitboard moves to match the position's moves with %s, but got %d", test.description, res)
+		}
+	}
+}
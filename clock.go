@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockMoveOverhead is the time the engine leaves on its clock for each move, for printing and
+// reading moves, so it doesn't run out of time between finishing its search and the clock stopping.
+const clockMoveOverhead = 50 * time.Millisecond
+
+type timeBonus int
+
+const (
+	noBonus timeBonus = iota
+	fischerIncrement
+	simpleDelay
+	bronsteinDelay
+)
+
+// timePeriod is one period of a time control: the time for a number of moves, or for the rest of
+// the game if moves is 0, and any bonus time given for each move.
+type timePeriod struct {
+	moves     int
+	time      time.Duration
+	bonus     time.Duration
+	bonusKind timeBonus
+}
+
+// parseTimeControl reads a time control made of one or more periods separated by commas. Each is
+// the number of moves to make in it and a slash, unless it's for the rest of the game, then the
+// minutes for it, and optionally the seconds of Fischer increment (+), simple delay (d) or
+// Bronstein delay (b) for each move: e.g. 5, 3+2, 15d5, or 40/90+30,30+30. If the last period
+// has a number of moves, it's repeated for as long as the game lasts.
+func parseTimeControl(s string) ([]timePeriod, error) {
+	var periods []timePeriod
+	for _, field := range strings.Split(s, ",") {
+		var period timePeriod
+		if moves, rest, ok := strings.Cut(field, "/"); ok {
+			n, err := strconv.Atoi(moves)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("Time control '%s' not recognised (moves must be a positive number).", s)
+			}
+
+			period.moves = n
+			field = rest
+		}
+
+		if i := strings.IndexAny(field, "+db"); i >= 0 {
+			switch field[i] {
+			case '+':
+				period.bonusKind = fischerIncrement
+			case 'd':
+				period.bonusKind = simpleDelay
+			case 'b':
+				period.bonusKind = bronsteinDelay
+			}
+
+			seconds, err := strconv.ParseFloat(field[i+1:], 64)
+			if err != nil || seconds < 0 {
+				return nil, fmt.Errorf("Time control '%s' not recognised (bonus must be a number of seconds).", s)
+			}
+
+			period.bonus = time.Duration(seconds * float64(time.Second))
+			field = field[:i]
+		}
+
+		minutes, err := strconv.ParseFloat(field, 64)
+		if err != nil || minutes <= 0 {
+			return nil, fmt.Errorf("Time control '%s' not recognised (time must be a positive number of minutes).", s)
+		}
+
+		period.time = time.Duration(minutes * float64(time.Minute))
+		periods = append(periods, period)
+	}
+
+	for _, period := range periods[:len(periods)-1] {
+		if period.moves == 0 {
+			return nil, fmt.Errorf("Time control '%s' not recognised (only the last period can be for the rest of the game).", s)
+		}
+	}
+
+	return periods, nil
+}
+
+// clock is one side's clock. It counts the moves made in the current period of the time control,
+// which moves on to the next period, adding its time, when they've all been made.
+type clock struct {
+	periods   []timePeriod
+	period    int
+	moves     int
+	remaining time.Duration
+}
+
+func newClock(periods []timePeriod) *clock {
+	return &clock{periods: periods, remaining: periods[0].time}
+}
+
+// getTimeLeft returns the time left on the clock once the side to move has thought for the
+// elapsed time. With a simple delay, the clock doesn't start running until the delay has passed.
+func (c *clock) getTimeLeft(elapsed time.Duration) time.Duration {
+	p := c.periods[c.period]
+	if p.bonusKind == simpleDelay {
+		elapsed -= min(elapsed, p.bonus)
+	}
+
+	return c.remaining - elapsed
+}
+
+// hasRunOut returns whether the clock's flag has fallen once the side to move has thought for
+// the elapsed time.
+func (c *clock) hasRunOut(elapsed time.Duration) bool {
+	return c.getTimeLeft(elapsed) <= 0
+}
+
+// stop charges the clock for a move that took the elapsed time, adding any bonus time and the
+// time for the next period if the move completes this one. It returns false if the flag fell
+// before the move was made.
+func (c *clock) stop(elapsed time.Duration) bool {
+	if c.hasRunOut(elapsed) {
+		c.remaining = 0
+		return false
+	}
+
+	p := c.periods[c.period]
+	c.remaining = c.getTimeLeft(elapsed)
+	switch p.bonusKind {
+	case fischerIncrement:
+		c.remaining += p.bonus
+	case bronsteinDelay:
+		c.remaining += min(elapsed, p.bonus)
+	}
+
+	c.moves++
+	if p.moves > 0 && c.moves == p.moves {
+		c.moves = 0
+		if c.period < len(c.periods)-1 {
+			c.period++
+		}
+
+		c.remaining += c.periods[c.period].time
+	}
+
+	return true
+}
+
+// getMoveTime returns how long the engine should think for its next move with the time on the
+// clock, spreading it over the moves left in the period.
+func (c *clock) getMoveTime() time.Duration {
+	p := c.periods[c.period]
+	movesToGo := 0
+	if p.moves > 0 {
+		movesToGo = p.moves - c.moves
+	}
+
+	return getMoveTime(c.remaining, p.bonus, movesToGo, clockMoveOverhead)
+}
+
+// formatClockTime formats time left on a clock as h:mm:ss, or m:ss, with tenths of a second
+// when there are less than ten seconds left.
+func formatClockTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+
+	if d < 10*time.Second {
+		return fmt.Sprintf("0:%04.1f", d.Seconds())
+	}
+
+	seconds := int(d / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeControl(t *testing.T) {
+	tests := []struct {
+		control  string
+		expected []timePeriod
+	}{
+		{"5", []timePeriod{{time: 5 * time.Minute}}},
+		{"3+2", []timePeriod{{time: 3 * time.Minute, bonus: 2 * time.Second, bonusKind: fischerIncrement}}},
+		{"15d5", []timePeriod{{time: 15 * time.Minute, bonus: 5 * time.Second, bonusKind: simpleDelay}}},
+		{"15b5", []timePeriod{{time: 15 * time.Minute, bonus: 5 * time.Second, bonusKind: bronsteinDelay}}},
+		{"0.5+0.5", []timePeriod{{time: 30 * time.Second, bonus: 500 * time.Millisecond, bonusKind: fischerIncrement}}},
+		{"40/90+30,30+30", []timePeriod{
+			{moves: 40, time: 90 * time.Minute, bonus: 30 * time.Second, bonusKind: fischerIncrement},
+			{time: 30 * time.Minute, bonus: 30 * time.Second, bonusKind: fischerIncrement},
+		}},
+		{"40/120,20/60,15", []timePeriod{{moves: 40, time: 2 * time.Hour}, {moves: 20, time: time.Hour}, {time: 15 * time.Minute}}},
+		{"40/120", []timePeriod{{moves: 40, time: 2 * time.Hour}}},
+		{"", nil},
+		{"0", nil},
+		{"5+", nil},
+		{"5x3", nil},
+		{"0/5", nil},
+		{"15,40/90", nil},
+	}
+
+	for _, test := range tests {
+		res, err := parseTimeControl(test.control)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("Expected an error parsing time control '%s', but got: %v", test.control, res)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Expected time control '%s' to parse, but got: %v", test.control, err)
+			continue
+		}
+
+		if len(res) != len(test.expected) {
+			t.Errorf("Expected time control '%s' to be %v, but got: %v", test.control, test.expected, res)
+			continue
+		}
+
+		for i := range res {
+			if res[i] != test.expected[i] {
+				t.Errorf("Expected time control '%s' to be %v, but got: %v", test.control, test.expected, res)
+				break
+			}
+		}
+	}
+}
+
+func TestClockStop(t *testing.T) {
+	tests := []struct {
+		control  string
+		moves    []time.Duration
+		expected time.Duration
+		flagged  bool
+	}{
+		// Test: sudden death
+		{"5", []time.Duration{10 * time.Second, 20 * time.Second}, 4*time.Minute + 30*time.Second, false},
+		{"1", []time.Duration{30 * time.Second, 30 * time.Second}, 0, true},
+		// Test: Fischer increment is added after each move
+		{"3+2", []time.Duration{10 * time.Second, 1 * time.Second}, 2*time.Minute + 53*time.Second, false},
+		// Test: the clock doesn't run during a simple delay
+		{"5d5", []time.Duration{3 * time.Second, 8 * time.Second}, 4*time.Minute + 57*time.Second, false},
+		{"1d5", []time.Duration{64 * time.Second}, 1 * time.Second, false},
+		{"1d5", []time.Duration{65 * time.Second}, 0, true},
+		// Test: Bronstein delay adds back the time used, up to the delay
+		{"5b5", []time.Duration{3 * time.Second, 8 * time.Second}, 4*time.Minute + 57*time.Second, false},
+		{"1b5", []time.Duration{60 * time.Second}, 0, true},
+		// Test: the next period's time is added when the moves for one have been made
+		{"2/10,5", []time.Duration{time.Minute, time.Minute}, 13 * time.Minute, false},
+		{"2/10,5", []time.Duration{time.Minute, time.Minute, time.Minute}, 12 * time.Minute, false},
+		{"2/10+30,5", []time.Duration{time.Minute, time.Minute}, 14 * time.Minute, false},
+		// Test: a last period with a number of moves repeats
+		{"2/10", []time.Duration{time.Minute, time.Minute, time.Minute}, 17 * time.Minute, false},
+	}
+
+	for _, test := range tests {
+		periods, err := parseTimeControl(test.control)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c := newClock(periods)
+		flagged := false
+		for _, elapsed := range test.moves {
+			if !c.stop(elapsed) {
+				flagged = true
+				break
+			}
+		}
+
+		if flagged != test.flagged || c.remaining != test.expected {
+			t.Errorf("Expected %s with moves taking %v to leave %v (flag fallen %t), but got: %v (%t)", test.control, test.moves,
+				test.expected, test.flagged, c.remaining, flagged)
+		}
+	}
+}
+
+func TestClockHasRunOut(t *testing.T) {
+	tests := []struct {
+		control  string
+		elapsed  time.Duration
+		expected bool
+	}{
+		{"1", 59 * time.Second, false},
+		{"1", time.Minute, true},
+		{"1+5", time.Minute, true},
+		{"1d5", 64 * time.Second, false},
+		{"1d5", 65 * time.Second, true},
+		{"1b5", time.Minute, true},
+	}
+
+	for _, test := range tests {
+		periods, _ := parseTimeControl(test.control)
+		res := newClock(periods).hasRunOut(test.elapsed)
+		if res != test.expected {
+			t.Errorf("Expected %s to have run out after %v to be %t, but got: %t", test.control, test.elapsed, test.expected, res)
+		}
+	}
+}
+
+func TestFormatClockTime(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{5 * time.Minute, "5:00"},
+		{90 * time.Minute, "1:30:00"},
+		{61*time.Second + 900*time.Millisecond, "1:01"},
+		{10 * time.Second, "0:10"},
+		{9*time.Second + 420*time.Millisecond, "0:09.4"},
+		{-time.Second, "0:00.0"},
+	}
+
+	for _, test := range tests {
+		res := formatClockTime(test.d)
+		if res != test.expected {
+			t.Errorf("Expected %v to be formatted as %s, but got: %s", test.d, test.expected, res)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import "strings"
+
+// pocketPieceNames are the pieces that can be held in a pocket, in the order they're counted and
+// written.
+const pocketPieceNames = "QRBNP"
+
+// pocket holds the pieces a side has captured in crazyhouse, which it can drop back on the board
+// as its own instead of moving. They're counted by type, in the order of pocketPieceNames.
+type pocket [len(pocketPieceNames)]int
+
+func (pk *pocket) add(name string) {
+	pk[strings.Index(pocketPieceNames, name)]++
+}
+
+func (pk *pocket) remove(name string) {
+	pk[strings.Index(pocketPieceNames, name)]--
+}
+
+func (pk pocket) count(name string) int {
+	return pk[strings.Index(pocketPieceNames, name)]
+}
+
+// String returns the pieces in the pocket, e.g. "Q N P P", or "-" if it's empty.
+func (pk pocket) String() string {
+	var names []string
+	for i, n := range pk {
+		for ; n > 0; n-- {
+			names = append(names, pocketPieceNames[i:i+1])
+		}
+	}
+
+	if len(names) == 0 {
+		return "-"
+	}
+
+	return strings.Join(names, " ")
+}
+
+// getPocket returns the side's pocket.
+func (p *position) getPocket(color string) *pocket {
+	if color == "W" {
+		return &p.pockets[white]
+	}
+
+	return &p.pockets[black]
+}
+
+// getCapturedPocketPiece returns the name of the piece that goes in the capturer's pocket when a
+// piece is captured in crazyhouse: its own, unless it was promoted, when it goes back to being a
+// pawn.
+func getCapturedPocketPiece(captured gamePiece) string {
+	if captured.promoted {
+		return "P"
+	}
+
+	return captured.getName()
+}
+
+// generateDrops returns the side to move's legal moves dropping a piece from its pocket onto an
+// empty square. Pawns can't be dropped on the first or last rank. A drop can't expose the king to
+// check, so when the king isn't in check, every drop is legal, and when it is, only the drops that
+// block the check are.
+func (p position) generateDrops(kingSquare square) []move {
+	pk := *p.getPocket(p.sideToMove)
+	if pk == (pocket{}) {
+		return nil
+	}
+
+	inCheck := p.isKingInCheck()
+	var moves []move
+	for i := range pocketPieceNames {
+		name := pocketPieceNames[i : i+1]
+		if pk[i] == 0 {
+			continue
+		}
+
+		piece, _ := getPieceFromName(name)
+		for row := 0; row < BoardSize; row++ {
+			for col := 0; col < BoardSize; col++ {
+				toSquare := getSquareForRowCol(row, col)
+				if !p.board.isRowColEmpty(row, col) || name == "P" && (toSquare.rank == 1 || toSquare.rank == BoardSize) {
+					continue
+				}
+
+				m := move{toSquare: toSquare, piece: gamePiece{piece: piece, color: p.sideToMove}, isDrop: true}
+				if inCheck && wouldKingOnSquareBeInCheck(p, m, kingSquare) {
+					continue
+				}
+
+				moves = append(moves, m)
+			}
+		}
+	}
+
+	return moves
+}
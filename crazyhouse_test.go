@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const crazyhouseStartingFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1"
+
+func TestCrazyhousePerft(t *testing.T) {
+	tests := []struct {
+		fen    string
+		counts []int
+	}{
+		{crazyhouseStartingFEN, []int{20, 400, 8902, 197281}},
+		{"2k5/8/8/8/8/8/8/4K3[QRBNPqrbnp] w - - 0 1", []int{301, 75353}},
+	}
+
+	for _, test := range tests {
+		p, err := parseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		for i, expected := range test.counts {
+			if testing.Short() && expected > perftShortMaxNodes {
+				continue
+			}
+
+			if res := perft(p, i+1); res != expected {
+				t.Errorf("Expected perft(%d) for %s to be %d, but got: %d", i+1, test.fen, expected, res)
+			}
+		}
+	}
+}
+
+func TestCrazyhouseMoves(t *testing.T) {
+	tests := []struct {
+		fen      string
+		moves    []string
+		expected string
+	}{
+		// Test: a captured piece goes to the capturer's pocket
+		{crazyhouseStartingFEN, []string{"e4", "d5", "exd5"}, "rnbqkbnr/ppp1pppp/8/3P4/8/8/PPPP1PPP/RNBQKBNR[P] b KQkq - 0 2"},
+		// Test: a piece is dropped from the pocket
+		{"4k3/8/8/8/8/8/8/4K3[Nq] w - - 0 1", []string{"N@f6+"}, "4k3/8/5N2/8/8/8/8/4K3[q] b - - 1 1"},
+		{"4k3/8/8/8/8/8/8/4K3[PP] w - - 0 1", []string{"P@e2", "Kd7", "e4"}, "8/3k4/8/8/4P3/8/8/4K3[P] b - e3 0 2"},
+		// Test: a promoted piece goes back to being a pawn when it's captured
+		{"r3k3/1P6/8/8/8/8/8/4K3[] w - - 0 1", []string{"bxa8=Q+"}, "Q~3k3/8/8/8/8/8/8/4K3[R] b - - 0 1"},
+		{"r3k3/8/8/8/8/8/8/Q~3K3[] b - - 0 1", []string{"Rxa1+"}, "4k3/8/8/8/8/8/8/r3K3[p] w - - 0 2"},
+	}
+
+	for _, test := range tests {
+		p, err := parseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		start := p
+		var moves []move
+		var undos []moveUndo
+		for _, san := range test.moves {
+			m, err := resolveSAN(p, san)
+			if err != nil {
+				t.Fatalf("Unexpected error playing %s in %s: %s", san, p.toFEN(), err)
+			}
+
+			if res := getSAN(p, m); res != san {
+				t.Errorf("Expected %s to be written as %s, but got: %s", san, san, res)
+			}
+
+			moves = append(moves, m)
+			undos = append(undos, p.makeMove(m))
+		}
+
+		if p.toFEN() != test.expected || p.hash != p.getHash() {
+			t.Errorf("Expected %s after %v from %s, but got: %s", test.expected, test.moves, test.fen, p.toFEN())
+		}
+
+		for i := len(moves) - 1; i >= 0; i-- {
+			p.unmakeMove(moves[i], undos[i])
+		}
+
+		if p != start {
+			t.Errorf("Expected taking back %v to restore %s, but got: %s", test.moves, test.fen, p.toFEN())
+		}
+	}
+}
+
+func TestCrazyhouseDropsNotAllowed(t *testing.T) {
+	tests := []struct {
+		fen      string
+		san      string
+		contains string
+	}{
+		{"4k3/8/8/8/8/8/8/4K3[P] w - - 0 1", "P@e8", "no white pawn can be dropped on e8"},
+		{"4k3/8/8/8/8/8/8/4K3[P] w - - 0 1", "P@a1", "no white pawn can be dropped on a1"},
+		{"4k3/8/8/8/8/8/8/4K3[N] w - - 0 1", "N@e8", "no white knight can be dropped on e8"},
+		{"4k3/8/8/8/8/8/8/4K3[n] w - - 0 1", "N@f3", "no white knight can be dropped on f3"},
+		{"4k3/8/8/8/8/8/8/r3K3[N] w - - 0 1", "N@f3", "no white knight can be dropped on f3"},
+		{"4k3/8/8/8/8/8/8/4K3[N] w - - 0 1", "K@f3", "can only drop Q, R, B, N or P"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		_, err := resolveSAN(p, test.san)
+		if err == nil || !strings.Contains(err.Error(), test.contains) {
+			t.Errorf("Expected an error containing \"%s\" dropping %s in %s, but got: %v", test.contains, test.san, test.fen, err)
+		}
+	}
+}
+
+func TestCrazyhouseCheckmate(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected bool
+	}{
+		// Test: a back rank check can be blocked by dropping a piece
+		{"6k1/8/8/8/8/8/6PP/r6K[N] w - - 0 1", false},
+		{"6k1/8/8/8/8/8/6PP/r6K[] w - - 0 1", true},
+		{"6k1/8/8/8/8/8/6PP/r6K[n] w - - 0 1", true},
+		// Test: a check from an adjacent piece can't be blocked
+		{"6k1/8/8/8/8/6b1/6Pq/7K[QRBNP] w - - 0 1", true},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		if res := p.isCheckMate(); res != test.expected {
+			t.Errorf("Expected checkmate in %s to be %t, but got: %t", test.fen, test.expected, res)
+		}
+	}
+}
+
+func TestCrazyhousePGN(t *testing.T) {
+	g := newGame(newVariantPosition(crazyhouse))
+	for _, san := range []string{"e4", "d5", "exd5", "Qxd5", "Nc3", "Qa5", "P@d5", "@e3"} {
+		m, err := getMoveFromInput(g.position, san)
+		if err != nil {
+			t.Fatalf("Unexpected error playing %s: %s", san, err)
+		}
+		g.makeMove(m)
+	}
+
+	pg := g.toPGN()
+	if _, ok := pg.tags["FEN"]; ok || pg.tags["Variant"] != "Crazyhouse" || !strings.Contains(pg.String(), "4. P@d5 P@e3") {
+		t.Errorf("Expected a crazyhouse game with drops, but got:\n%s", pg)
+	}
+
+	games, err := parsePGN(pg.String())
+	if err != nil || len(games) != 1 {
+		t.Fatalf("Unexpected error reading PGN: %v", err)
+	}
+
+	if p := games[0].getPositionAfter(len(games[0].moves)); p.toFEN() != g.position.toFEN() {
+		t.Errorf("Expected the game read from PGN to reach %s, but got: %s", g.position.toFEN(), p.toFEN())
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+const fiftyMoveRuleHalfmoves = 100
+
+// getDrawReason returns why the game is drawn with the position reached, or an empty string if it
+// isn't. Repetitions holds how many times each position in the game has been reached, by hash,
+// including the current one.
+func getDrawReason(p position, repetitions map[uint64]int) string {
+	if reason := p.getVariantDrawReason(); reason != "" {
+		return reason
+	}
+
+	if p.isStalemate() {
+		return "Stalemate"
+	}
+
+	if p.hasInsufficientMaterial() {
+		return "Insufficient material"
+	}
+
+	if p.halfmoveClock >= fiftyMoveRuleHalfmoves {
+		return "Fifty-move rule"
+	}
+
+	if repetitions[p.hash] >= 3 {
+		return "Threefold repetition"
+	}
+
+	return ""
+}
+
+// hasInsufficientMaterial returns whether neither side has the pieces to give checkmate in the
+// position, as the board's hasInsufficientMaterial does. In crazyhouse, any piece but a king can be
+// captured and dropped by either side, so that's only the case with bare kings and empty pockets.
+// In three-check, any piece can give check, so again only bare kings can't win, in King of the
+// Hill and Racing Kings, a king can always head for its goal, in antichess, pieces can always be
+// given away, and in horde, black can always take white's.
+func (p position) hasInsufficientMaterial() bool {
+	switch p.variant {
+	case crazyhouse:
+		return p.pockets == [2]pocket{} && !p.board.hasPiecesOtherThanKing("W") && !p.board.hasPiecesOtherThanKing("B")
+	case atomicChess:
+		return p.board.hasAtomicInsufficientMaterial()
+	case threeCheck:
+		return !p.board.hasPiecesOtherThanKing("W") && !p.board.hasPiecesOtherThanKing("B")
+	case kingOfTheHill, antichess, horde, racingKings:
+		return false
+	}
+
+	return p.board.hasInsufficientMaterial()
+}
+
+// canCheckmate returns whether the side could win in the position by any series of legal moves,
+// as the board's canCheckmate does, allowing in crazyhouse for the pieces either side could
+// capture and drop. In atomic and three-check, a bare king can't win, as it can neither capture
+// nor give check, and in horde, white needs pieces, but in King of the Hill, antichess and Racing
+// Kings, any side can.
+func (p position) canCheckmate(color string) bool {
+	switch p.variant {
+	case crazyhouse:
+		return !p.hasInsufficientMaterial()
+	case atomicChess, threeCheck:
+		return !p.hasInsufficientMaterial() && p.board.hasPiecesOtherThanKing(color)
+	case horde:
+		return p.board.hasPieces(color)
+	case kingOfTheHill, antichess, racingKings:
+		return true
+	}
+
+	return p.board.canCheckmate(color)
+}
+
+// hasPiecesOtherThanKing returns whether the side has any pieces on the board but its king.
+func (b board) hasPiecesOtherThanKing(color string) bool {
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if !b.isRowColEmpty(i, j) && b[i][j].color == color && b[i][j].getName() != "K" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hasInsufficientMaterial returns whether neither side has the pieces to give checkmate, whatever
+// moves are played. That's the case with only kings and a single knight or bishop, or only kings
+// and bishops that are all on the same colour squares.
+func (b board) hasInsufficientMaterial() bool {
+	var minorPieces []string
+	var bishopSquareColors []int
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if b.isRowColEmpty(i, j) {
+				continue
+			}
+
+			switch b[i][j].getName() {
+			case "K":
+				continue
+			case "B":
+				bishopSquareColors = append(bishopSquareColors, (i+j)%2)
+				minorPieces = append(minorPieces, "B")
+			case "N":
+				minorPieces = append(minorPieces, "N")
+			default:
+				return false
+			}
+		}
+	}
+
+	if len(minorPieces) <= 1 {
+		return true
+	}
+
+	if len(bishopSquareColors) != len(minorPieces) {
+		return false
+	}
+
+	for _, c := range bishopSquareColors {
+		if c != bishopSquareColors[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// canCheckmate returns whether the side could checkmate the other by any series of legal moves,
+// which under FIDE rules decides whether the other side running out of time loses or draws. It
+// can't with only its king. With a single knight, or bishops that are all on the same colour
+// squares, it can only if the other side has pieces that could block its own king in: anything
+// but a bare king for a knight, and anything but bishops on the same colour squares for bishops.
+func (b board) canCheckmate(color string) bool {
+	var pieces, otherPieces []string
+	var bishopSquareColors, otherBishopSquareColors []int
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if b.isRowColEmpty(i, j) || b[i][j].getName() == "K" {
+				continue
+			}
+
+			if b[i][j].color == color {
+				pieces = append(pieces, b[i][j].getName())
+				if b[i][j].getName() == "B" {
+					bishopSquareColors = append(bishopSquareColors, (i+j)%2)
+				}
+			} else {
+				otherPieces = append(otherPieces, b[i][j].getName())
+				if b[i][j].getName() == "B" {
+					otherBishopSquareColors = append(otherBishopSquareColors, (i+j)%2)
+				}
+			}
+		}
+	}
+
+	if len(pieces) == 0 {
+		return false
+	}
+
+	if len(pieces) == 1 && pieces[0] == "N" {
+		return len(otherPieces) > 0
+	}
+
+	if len(bishopSquareColors) != len(pieces) {
+		return true
+	}
+
+	for _, c := range bishopSquareColors {
+		if c != bishopSquareColors[0] {
+			return true
+		}
+	}
+
+	if len(otherBishopSquareColors) != len(otherPieces) {
+		return true
+	}
+
+	for _, c := range otherBishopSquareColors {
+		if c != bishopSquareColors[0] {
+			return true
+		}
+	}
+
+	return false
+}
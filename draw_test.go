@@ -0,0 +1,178 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIsStalemate(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected bool
+	}{
+		{StartingFEN, false},
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", true},
+		{"k7/P7/K7/8/8/8/8/8 b - - 0 1", true},
+		{"k7/1R6/8/K7/8/8/8/8 b - - 0 1", false},
+		{"7k/6Q1/6K1/8/8/8/8/8 b - - 0 1", false},
+		{"7k/5Q2/6K1/8/8/8/p7/8 b - - 0 1", false},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		res := p.isStalemate()
+		if res != test.expected {
+			t.Errorf("Expected stalemate to be %t in %s, but got: %t", test.expected, test.fen, res)
+		}
+	}
+}
+
+func TestHasInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected bool
+	}{
+		{StartingFEN, false},
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/2B1K3 w - - 0 1", true},
+		{"4k3/8/8/8/8/8/8/1N2K3 w - - 0 1", true},
+		{"2b1k3/8/8/8/8/8/8/3BK3 w - - 0 1", true},
+		{"2b1k3/8/8/8/8/8/8/2B1K3 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/1NB1K3 w - - 0 1", false},
+		{"4kn2/8/8/8/8/8/8/1N2K3 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/8/3RK3 w - - 0 1", false},
+		{"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", false},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		res := p.board.hasInsufficientMaterial()
+		if res != test.expected {
+			t.Errorf("Expected insufficient material to be %t in %s, but got: %t", test.expected, test.fen, res)
+		}
+	}
+}
+
+func TestCanCheckmate(t *testing.T) {
+	tests := []struct {
+		fen      string
+		color    string
+		expected bool
+	}{
+		{StartingFEN, "W", true},
+		{"4k3/8/8/8/8/8/8/3QK3 w - - 0 1", "W", true},
+		{"4k3/8/8/8/8/8/8/3QK3 w - - 0 1", "B", false},
+		{"4k3/8/8/8/8/8/8/1N2K3 w - - 0 1", "W", false},
+		{"4k3/7p/8/8/8/8/8/1N2K3 w - - 0 1", "W", true},
+		{"4k3/7p/8/8/8/8/8/1N2K3 w - - 0 1", "B", true},
+		{"4k3/8/8/8/8/8/8/1NN1K3 w - - 0 1", "W", true},
+		{"4k3/8/8/8/8/8/8/3BK3 w - - 0 1", "W", false},
+		{"2b1k3/8/8/8/8/8/8/3BK3 w - - 0 1", "W", false},
+		{"3bk3/8/8/8/8/8/8/3BK3 w - - 0 1", "W", true},
+		{"3rk3/8/8/8/8/8/8/3BK3 w - - 0 1", "W", true},
+		{"4k3/8/8/8/8/8/8/2BBK3 w - - 0 1", "W", true},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		res := p.board.canCheckmate(test.color)
+		if res != test.expected {
+			t.Errorf("Expected %s being able to checkmate to be %t in %s, but got: %t", test.color, test.expected, test.fen, res)
+		}
+	}
+}
+
+func TestGetDrawReason(t *testing.T) {
+	var p position
+	var res string
+
+	// Test: no draw in the starting position
+	p = newPosition()
+	repetitions := map[uint64]int{p.hash: 1}
+	res = getDrawReason(p, repetitions)
+	if res != "" {
+		t.Errorf("Expected no draw in starting position, but got: %s", res)
+	}
+
+	// Test: threefold repetition, with the starting position reached for the third time
+	for i := 0; i < 2; i++ {
+		for _, m := range []string{"g1f3", "g8f6", "f3g1", "f6g8"} {
+			from, _ := getSquareFromNotation(m[0:2])
+			to, _ := getSquareFromNotation(m[2:4])
+			legalMove, _ := findLegalMove(p, from, to, "")
+			p.makeMove(legalMove)
+			repetitions[p.hash]++
+
+			res = getDrawReason(p, repetitions)
+			if res != "" && !(i == 1 && m == "f6g8") {
+				t.Errorf("Expected no draw after %s in repetition %d, but got: %s", m, i+1, res)
+			}
+		}
+	}
+	if res != "Threefold repetition" {
+		t.Errorf("Expected draw by threefold repetition, but got: %s", res)
+	}
+
+	// Test: fifty-move rule applies after a hundred halfmoves without a capture or pawn move
+	p, _ = parseFEN("4k3/8/8/8/8/8/4P3/R3K3 w - - 99 80")
+	res = getDrawReason(p, map[uint64]int{})
+	if res != "" {
+		t.Errorf("Expected no draw after 99 halfmoves, but got: %s", res)
+	}
+	m, _ := findLegalMove(p, square{file: "A", rank: 1}, square{file: "A", rank: 2}, "")
+	p.makeMove(m)
+	res = getDrawReason(p, map[uint64]int{})
+	if res != "Fifty-move rule" {
+		t.Errorf("Expected draw by fifty-move rule, but got: %s", res)
+	}
+
+	// Test: stalemate and insufficient material are draws
+	p, _ = parseFEN("7k/5Q2/6K1/8/8/8/8/8 b - - 0 1")
+	res = getDrawReason(p, map[uint64]int{})
+	if res != "Stalemate" {
+		t.Errorf("Expected draw by stalemate, but got: %s", res)
+	}
+
+	p, _ = parseFEN("4k3/8/8/8/8/8/8/2B1K3 w - - 0 1")
+	res = getDrawReason(p, map[uint64]int{})
+	if res != "Insufficient material" {
+		t.Errorf("Expected draw by insufficient material, but got: %s", res)
+	}
+}
+
+func TestPositionHashEnPassant(t *testing.T) {
+	tests := []struct {
+		fen         string
+		otherFEN    string
+		expected    bool
+		description string
+	}{
+		{
+			"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+			"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1",
+			true, "en passant square with no pawn to take",
+		},
+		{
+			"rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+			"rnbqkbnr/ppp1pppp/8/8/3pP3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1",
+			false, "en passant capture that can be made",
+		},
+		{
+			"8/8/8/8/k2pP2R/8/8/4K3 b - e3 0 1",
+			"8/8/8/8/k2pP2R/8/8/4K3 b - - 0 1",
+			true, "en passant capture that would leave the king in check",
+		},
+		{
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w Kkq - 0 1",
+			false, "different castling rights",
+		},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		other, _ := parseFEN(test.otherFEN)
+		if res := p.hash == other.hash; res != test.expected {
+			t.Errorf("Expected hashes to be the same to be %t for %s, but got: %t", test.expected, test.description, res)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	mateScore      = 100000
+	maxSearchDepth = 64
+	infiniteScore  = mateScore + 1
+
+	// tablebaseWinScore is the score of a position the tablebases say is won, more than any
+	// evaluation but less than any mate.
+	tablebaseWinScore = mateScore / 2
+)
+
+// searchLimits says how long the engine should think about a move: to a depth, for a time, or
+// until the first of the two is reached. A limit of zero means there's no limit of that kind.
+type searchLimits struct {
+	depth    int
+	moveTime time.Duration
+}
+
+// searchInfo describes the result of searching to a depth: the best move, its score, from the
+// side to move's point of view, and the principal variation, the line of best play found, which
+// starts with the best move. A move from the book has only the move itself, and one from the
+// tablebases only the move, its score and its DTZ.
+type searchInfo struct {
+	depth     int
+	score     int
+	nodes     int
+	elapsed   time.Duration
+	bestMove  move
+	pv        []move
+	book      bool
+	tablebase bool
+	dtz       int
+}
+
+// engine searches for moves. A search in progress can be stopped from another goroutine with
+// stop, after which the search returns as soon as it can. What it finds is kept in its
+// transposition table from one search to the next. With an opening book, it plays from the book
+// for as long as it can, and with tablebases, it plays perfectly once the position is in them.
+type engine struct {
+	tt            *transpositionTable
+	book          *polyglotBook
+	tablebase     *tablebase
+	limits        searchLimits
+	start         time.Time
+	depth         int
+	nodes         int
+	stopped       bool
+	stopRequested int32
+	onInfo        func(searchInfo)
+
+	// The best move found at the root by the search to the current depth. It's kept here rather
+	// than only in the transposition table, where it may be replaced, or not stored at all.
+	rootBestMove bbMove
+}
+
+// newEngine creates an engine with a transposition table of the given size in MB.
+func newEngine(hashSize int) *engine {
+	return &engine{tt: newTranspositionTable(hashSize)}
+}
+
+// search finds the best move in the position, searching to increasing depths until a limit is
+// reached, and returns the result of the deepest search that completed. The position must have
+// at least one legal move. The search itself is made on bitboards, for speed. If the position is
+// in the engine's book, a book move is returned straight away instead.
+func (e *engine) search(p position, limits searchLimits) searchInfo {
+	if e.book != nil {
+		if m, ok := e.book.pickMove(p); ok {
+			return searchInfo{bestMove: m, pv: []move{m}, book: true}
+		}
+	}
+
+	bp := newBitboardPosition(p)
+	if e.tablebase != nil {
+		if m, dtz, ok := e.tablebase.getBestMove(&bp); ok {
+			bestMove, _ := getMoveFromBBMove(p, m)
+			return searchInfo{score: getDTZScore(dtz, p.halfmoveClock), bestMove: bestMove, pv: []move{bestMove}, tablebase: true, dtz: dtz}
+		}
+	}
+
+	e.limits = limits
+	e.start = time.Now()
+	e.nodes = 0
+	e.stopped = false
+	if e.tt == nil {
+		e.tt = newTranspositionTable(defaultHashSize)
+	}
+	e.tt.newSearch()
+
+	maxDepth := limits.depth
+	if maxDepth <= 0 || maxDepth > maxSearchDepth {
+		maxDepth = maxSearchDepth
+	}
+
+	// The search to depth 1 is never stopped, so there's always a result, and a best move, as
+	// every root move scores better than -infiniteScore.
+	var result searchInfo
+	for depth := 1; depth <= maxDepth; depth++ {
+		e.depth = depth
+		e.rootBestMove = 0
+		score := e.alphaBeta(&bp, depth, 0, -infiniteScore, infiniteScore)
+		if e.stopped {
+			break
+		}
+
+		bestMove, _ := getMoveFromBBMove(p, e.rootBestMove)
+		result = searchInfo{depth: depth, score: score, nodes: e.nodes, elapsed: time.Since(e.start), bestMove: bestMove, pv: getMovesFromBBMoves(p, e.getPV(&bp, e.rootBestMove, depth))}
+		if e.onInfo != nil {
+			e.onInfo(result)
+		}
+
+		// No need to look any deeper once a forced mate has been found.
+		if isMateScore(score) {
+			break
+		}
+	}
+
+	return result
+}
+
+// alphaBeta returns the score of the position to the given depth, from the side to move's point
+// of view. Scores outside the alpha-beta window aren't exact, only known to be no better than
+// alpha or at least as good as beta. What's found is stored in the transposition table, and used
+// instead of searching if the position has already been searched deep enough.
+func (e *engine) alphaBeta(bp *bitboardPosition, depth int, ply int, alpha int, beta int) int {
+	if e.shouldStop() {
+		return 0
+	}
+
+	if ply > 0 && (bp.halfmoveClock >= fiftyMoveRuleHalfmoves || bp.hasInsufficientMaterial()) {
+		return 0
+	}
+
+	// Positions in the tablebases don't need searching, or evaluating. Only those just reached by
+	// a capture or pawn move are probed, as for the others, the fifty-move rule might draw the
+	// game before a win could be reached.
+	if ply > 0 && bp.halfmoveClock == 0 && e.tablebase != nil {
+		if wdl, ok := e.tablebase.probeWDL(bp); ok {
+			return getTablebaseScore(wdl, ply)
+		}
+	}
+
+	if depth <= 0 {
+		return e.quiesce(bp, alpha, beta)
+	}
+
+	e.nodes++
+	entry, found := e.tt.probe(bp.hash)
+	if found && ply > 0 && int(entry.depth) >= depth {
+		score := entry.getScore(ply)
+		switch {
+		case entry.bound == ttExact:
+			return score
+		case entry.bound == ttLowerBound && score >= beta:
+			return beta
+		case entry.bound == ttUpperBound && score <= alpha:
+			return alpha
+		}
+	}
+
+	var buffer [maxMoves]bbMove
+	moves := bp.generateMoves(buffer[:0])
+	if len(moves) == 0 {
+		if bp.isKingInCheck() {
+			// Being mated sooner is worse, so prefer the longest way to lose and shortest to win.
+			return -mateScore + ply
+		}
+
+		return 0
+	}
+
+	bound, bestMove := ttUpperBound, bbMove(0)
+	for _, m := range orderMoves(bp, moves, entry.move) {
+		u := bp.makeMove(m)
+		score := -e.alphaBeta(bp, depth-1, ply+1, -beta, -alpha)
+		bp.unmakeMove(m, u)
+
+		if e.stopped {
+			return 0
+		}
+
+		if score >= beta {
+			e.tt.store(bp.hash, depth, ply, beta, ttLowerBound, m)
+			return beta
+		}
+
+		if score > alpha {
+			alpha = score
+			bound, bestMove = ttExact, m
+			if ply == 0 {
+				e.rootBestMove = m
+			}
+		}
+	}
+
+	e.tt.store(bp.hash, depth, ply, alpha, bound, bestMove)
+	return alpha
+}
+
+// getPV returns the principal variation, the line of best play found by the search: the best move
+// at the root, then the best moves stored in the transposition table from the position after it.
+// It's cut short if an entry on the way has been replaced.
+func (e *engine) getPV(bp *bitboardPosition, bestMove bbMove, depth int) []bbMove {
+	pv := []bbMove{bestMove}
+	undos := []bbUndo{bp.makeMove(bestMove)}
+	for len(pv) < depth {
+		entry, found := e.tt.probe(bp.hash)
+		if !found || entry.move == 0 || !bp.isLegal(entry.move) {
+			break
+		}
+
+		pv = append(pv, entry.move)
+		undos = append(undos, bp.makeMove(entry.move))
+	}
+
+	for i := len(pv) - 1; i >= 0; i-- {
+		bp.unmakeMove(pv[i], undos[i])
+	}
+
+	return pv
+}
+
+// quiesce extends the search with captures and promotions only, until the position is quiet,
+// so that the evaluation isn't made in the middle of an exchange of pieces.
+func (e *engine) quiesce(bp *bitboardPosition, alpha int, beta int) int {
+	if e.shouldStop() {
+		return 0
+	}
+
+	e.nodes++
+
+	// The side to move doesn't have to capture, so can "stand pat" with the current score.
+	standPat := bp.evaluate()
+	if standPat >= beta {
+		return beta
+	}
+
+	if standPat > alpha {
+		alpha = standPat
+	}
+
+	var buffer [maxMoves]bbMove
+	for _, m := range orderMoves(bp, bp.generateMoves(buffer[:0]), 0) {
+		if !bp.isCapture(m) && m.promotion() == 0 {
+			continue
+		}
+
+		u := bp.makeMove(m)
+		score := -e.quiesce(bp, -beta, -alpha)
+		bp.unmakeMove(m, u)
+
+		if score >= beta {
+			return beta
+		}
+
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	return alpha
+}
+
+// stop asks a search in progress to stop. The request stands until clearStop is called, so it
+// also stops the next search if made between searches.
+func (e *engine) stop() {
+	atomic.StoreInt32(&e.stopRequested, 1)
+}
+
+func (e *engine) clearStop() {
+	atomic.StoreInt32(&e.stopRequested, 0)
+}
+
+// shouldStop returns whether the search has run out of time or been asked to stop. The search to
+// the first depth is always allowed to finish, so that there's a move to play.
+func (e *engine) shouldStop() bool {
+	if e.stopped || e.depth <= 1 || e.nodes%256 != 0 {
+		return e.stopped
+	}
+
+	if atomic.LoadInt32(&e.stopRequested) == 1 || (e.limits.moveTime > 0 && time.Since(e.start) >= e.limits.moveTime) {
+		e.stopped = true
+	}
+
+	return e.stopped
+}
+
+// orderMoves sorts moves so that those most likely to be best are searched first, which lets
+// alpha-beta cut off more of the tree: the best move from a shallower search, then captures of
+// the most valuable pieces by the least valuable, then promotions.
+func orderMoves(bp *bitboardPosition, moves []bbMove, pvMove bbMove) []bbMove {
+	var buffer [maxMoves]int
+	scores := buffer[:len(moves)]
+	for i, m := range moves {
+		score := 0
+		if m == pvMove {
+			score = 100000
+		} else if bp.isCapture(m) {
+			captured := pawnType
+			if m&bbMoveEnPassant == 0 {
+				captured = bp.squares[m.to()].pieceType()
+			}
+			score = 10000 + 10*pieceTypeValues[captured] - pieceTypeValues[bp.squares[m.from()].pieceType()]
+		}
+		if m.promotion() != 0 {
+			score += pieceTypeValues[m.promotion()]
+		}
+		scores[i] = score
+	}
+
+	sort.Stable(movesByScore{moves, scores})
+	return moves
+}
+
+type movesByScore struct {
+	moves  []bbMove
+	scores []int
+}
+
+func (ms movesByScore) Len() int           { return len(ms.moves) }
+func (ms movesByScore) Less(i, j int) bool { return ms.scores[i] > ms.scores[j] }
+func (ms movesByScore) Swap(i, j int) {
+	ms.moves[i], ms.moves[j] = ms.moves[j], ms.moves[i]
+	ms.scores[i], ms.scores[j] = ms.scores[j], ms.scores[i]
+}
+
+// getTablebaseScore returns the score for a WDL result found the given ply from the root. A win
+// found sooner is better, and wins and losses the fifty-move rule turns into draws score as draws.
+func getTablebaseScore(wdl int, ply int) int {
+	switch {
+	case wdl == tbWin:
+		return tablebaseWinScore - ply
+	case wdl == tbLoss:
+		return -tablebaseWinScore + ply
+	}
+
+	return 0
+}
+
+// getDTZScore returns the score for the DTZ of a move from the root, given the halfmove clock.
+func getDTZScore(dtz int, halfmoveClock int) int {
+	switch {
+	case dtz > 0 && dtz+halfmoveClock <= fiftyMoveRuleHalfmoves:
+		return tablebaseWinScore - dtz
+	case dtz < 0 && -dtz+halfmoveClock <= fiftyMoveRuleHalfmoves:
+		return -tablebaseWinScore - dtz
+	}
+
+	return 0
+}
+
+func isMateScore(score int) bool {
+	return score > mateScore-maxSearchDepth*2 || score < -mateScore+maxSearchDepth*2
+}
+
+// formatScore returns a score as pawns, e.g. +0.35, or as the number of moves to mate, e.g. #3 or
+// #-2 if the side to move is being mated.
+func formatScore(score int) string {
+	if isMateScore(score) {
+		return fmt.Sprintf("#%d", getMateMoves(score))
+	}
+
+	return fmt.Sprintf("%+.2f", float64(score)/100)
+}
+
+// getMateMoves returns the number of moves to mate for a mate score, negative if it's the side to
+// move that's being mated.
+func getMateMoves(score int) int {
+	if score > 0 {
+		return (mateScore - score + 1) / 2
+	}
+
+	return -(mateScore + score) / 2
+}
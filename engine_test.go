@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEngineSearch(t *testing.T) {
+	tests := []struct {
+		fen           string
+		depth         int
+		expectedMove  string
+		expectedScore string
+		description   string
+	}{
+		{"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", 2, "a1a8", "#1", "back rank mate in one"},
+		{"r1bqkbnr/pppp1ppp/2n5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 2 3", 2, "h5f7", "#1", "scholar's mate"},
+		{"4k3/8/8/3q4/8/8/3R4/4K3 w - - 0 1", 2, "d2d5", "", "rook takes undefended queen"},
+		{"4k3/8/2p5/3q4/8/8/3R4/3RK3 w - - 0 1", 3, "d2d5", "", "rook takes defended queen"},
+		{"k7/8/1K6/8/8/8/8/7R w - - 0 1", 4, "h1h8", "#1", "mate with the rook"},
+	}
+
+	for _, test := range tests {
+		p, err := parseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		e := engine{}
+		res := e.search(p, searchLimits{depth: test.depth})
+		if res.bestMove.String() != test.expectedMove || len(res.pv) == 0 || res.pv[0] != res.bestMove {
+			t.Errorf("Expected engine to play %s for %s, but got: %v", test.expectedMove, test.description, res.pv)
+		}
+
+		if test.expectedScore != "" && formatScore(res.score) != test.expectedScore {
+			t.Errorf("Expected score %s for %s, but got: %s", test.expectedScore, test.description, formatScore(res.score))
+		}
+	}
+}
+
+func TestEngineSearchFindsMateInTwo(t *testing.T) {
+	// 1. Ra7 Kg8 2. Rb8#
+	p, _ := parseFEN("7k/8/8/8/8/8/R7/1R4K1 w - - 0 1")
+	e := engine{}
+	res := e.search(p, searchLimits{depth: 4})
+	if formatScore(res.score) != "#2" {
+		t.Errorf("Expected engine to find mate in 2, but got: %s (%v)", formatScore(res.score), res.pv)
+	}
+}
+
+func TestEngineSearchWithoutTranspositionTable(t *testing.T) {
+	// With no table, there are no stored moves to follow, so the PV is only the best move.
+	p, _ := parseFEN("7k/8/8/8/8/8/R7/1R4K1 w - - 0 1")
+	e := newEngine(0)
+	res := e.search(p, searchLimits{depth: 4})
+	if _, err := findLegalMove(p, res.bestMove.fromSquare, res.bestMove.toSquare, ""); err != nil || formatScore(res.score) != "#2" {
+		t.Errorf("Expected engine to find mate in 2 without a transposition table, but got: %s %s (%v)", res.bestMove, formatScore(res.score), err)
+	}
+
+	if len(res.pv) != 1 || res.pv[0] != res.bestMove {
+		t.Errorf("Expected the PV to be only the best move, %s, but got: %v", res.bestMove, res.pv)
+	}
+}
+
+func TestFormatScore(t *testing.T) {
+	tests := []struct {
+		score    int
+		expected string
+	}{
+		{0, "+0.00"},
+		{35, "+0.35"},
+		{-120, "-1.20"},
+		{mateScore - 1, "#1"},
+		{mateScore - 3, "#2"},
+		{-mateScore + 2, "#-1"},
+		{-mateScore + 4, "#-2"},
+	}
+
+	for _, test := range tests {
+		if res := formatScore(test.score); res != test.expected {
+			t.Errorf("Expected score %d to be formatted as %s, but got: %s", test.score, test.expected, res)
+		}
+	}
+}
+
+// BenchmarkSearch searches standard test positions with and without a transposition table, to
+// show how many fewer nodes are searched with one, reported as nodes/op.
+func BenchmarkSearch(b *testing.B) {
+	for _, test := range perftTests {
+		p, _ := parseFEN(test.fen)
+		for _, hashSize := range []int{0, defaultHashSize} {
+			name := test.name + "/no TT"
+			if hashSize > 0 {
+				name = test.name + "/TT"
+			}
+
+			b.Run(name, func(b *testing.B) {
+				nodes := 0
+				for i := 0; i < b.N; i++ {
+					e := newEngine(hashSize)
+					nodes += e.search(p, searchLimits{depth: 5}).nodes
+				}
+				b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+			})
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+// Piece values and piece-square tables are those of Tomasz Michniewski's "Simplified Evaluation
+// Function". Each table is laid out as the board is, from rank 8 down to rank 1, from white's
+// side; black's are read with the ranks mirrored.
+var pieceValues = map[string]int{"P": 100, "N": 320, "B": 330, "R": 500, "Q": 900, "K": 0}
+
+var pieceSquareTables = map[string][BoardSize][BoardSize]int{
+	"P": {
+		{0, 0, 0, 0, 0, 0, 0, 0},
+		{50, 50, 50, 50, 50, 50, 50, 50},
+		{10, 10, 20, 30, 30, 20, 10, 10},
+		{5, 5, 10, 25, 25, 10, 5, 5},
+		{0, 0, 0, 20, 20, 0, 0, 0},
+		{5, -5, -10, 0, 0, -10, -5, 5},
+		{5, 10, 10, -20, -20, 10, 10, 5},
+		{0, 0, 0, 0, 0, 0, 0, 0},
+	},
+	"N": {
+		{-50, -40, -30, -30, -30, -30, -40, -50},
+		{-40, -20, 0, 0, 0, 0, -20, -40},
+		{-30, 0, 10, 15, 15, 10, 0, -30},
+		{-30, 5, 15, 20, 20, 15, 5, -30},
+		{-30, 0, 15, 20, 20, 15, 0, -30},
+		{-30, 5, 10, 15, 15, 10, 5, -30},
+		{-40, -20, 0, 5, 5, 0, -20, -40},
+		{-50, -40, -30, -30, -30, -30, -40, -50},
+	},
+	"B": {
+		{-20, -10, -10, -10, -10, -10, -10, -20},
+		{-10, 0, 0, 0, 0, 0, 0, -10},
+		{-10, 0, 5, 10, 10, 5, 0, -10},
+		{-10, 5, 5, 10, 10, 5, 5, -10},
+		{-10, 0, 10, 10, 10, 10, 0, -10},
+		{-10, 10, 10, 10, 10, 10, 10, -10},
+		{-10, 5, 0, 0, 0, 0, 5, -10},
+		{-20, -10, -10, -10, -10, -10, -10, -20},
+	},
+	"R": {
+		{0, 0, 0, 0, 0, 0, 0, 0},
+		{5, 10, 10, 10, 10, 10, 10, 5},
+		{-5, 0, 0, 0, 0, 0, 0, -5},
+		{-5, 0, 0, 0, 0, 0, 0, -5},
+		{-5, 0, 0, 0, 0, 0, 0, -5},
+		{-5, 0, 0, 0, 0, 0, 0, -5},
+		{-5, 0, 0, 0, 0, 0, 0, -5},
+		{0, 0, 0, 5, 5, 0, 0, 0},
+	},
+	"Q": {
+		{-20, -10, -10, -5, -5, -10, -10, -20},
+		{-10, 0, 0, 0, 0, 0, 0, -10},
+		{-10, 0, 5, 5, 5, 5, 0, -10},
+		{-5, 0, 5, 5, 5, 5, 0, -5},
+		{0, 0, 5, 5, 5, 5, 0, -5},
+		{-10, 5, 5, 5, 5, 5, 0, -10},
+		{-10, 0, 5, 0, 0, 0, 0, -10},
+		{-20, -10, -10, -5, -5, -10, -10, -20},
+	},
+	"K": {
+		{-30, -40, -40, -50, -50, -40, -40, -30},
+		{-30, -40, -40, -50, -50, -40, -40, -30},
+		{-30, -40, -40, -50, -50, -40, -40, -30},
+		{-30, -40, -40, -50, -50, -40, -40, -30},
+		{-20, -30, -30, -40, -40, -30, -30, -20},
+		{-10, -20, -20, -20, -20, -20, -20, -10},
+		{20, 20, 0, 0, 0, 0, 20, 20},
+		{20, 30, 10, 0, 0, 10, 30, 20},
+	},
+}
+
+// evaluate returns the score of the position in centipawns, from the side to move's point of view.
+func evaluate(p position) int {
+	score := 0
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if p.board.isRowColEmpty(i, j) {
+				continue
+			}
+
+			gp := p.board[i][j]
+			if gp.color == "W" {
+				score += getPieceScore(gp.getName(), i, j)
+			} else {
+				score -= getPieceScore(gp.getName(), BoardSize-1-i, j)
+			}
+		}
+	}
+
+	if p.sideToMove == "B" {
+		return -score
+	}
+
+	return score
+}
+
+// getPieceScore returns the value of a piece on the given square, as seen from white's side.
+func getPieceScore(name string, row int, col int) int {
+	return pieceValues[name] + pieceSquareTables[name][row][col]
+}
+
+// pieceTypeValues holds pieceValues by the type of piece, for a bitboardPosition.
+var pieceTypeValues [6]int
+
+// pieceSquareScores holds getPieceScore for each colour and type of piece on each square of a
+// bitboardPosition, negated for black, so that evaluating one is a matter of adding them up.
+var pieceSquareScores [2][6][64]int
+
+func init() {
+	for pieceType, name := range pieceTypeNames {
+		pieceTypeValues[pieceType] = pieceValues[string(name)]
+		for sq := 0; sq < 64; sq++ {
+			row, col := getRowColForSquare(getSquareFromIndex(sq))
+			pieceSquareScores[white][pieceType][sq] = getPieceScore(string(name), row, col)
+			pieceSquareScores[black][pieceType][sq] = -getPieceScore(string(name), BoardSize-1-row, col)
+		}
+	}
+}
+
+// evaluate is evaluate for a bitboardPosition, which keeps its score as it goes.
+func (bp *bitboardPosition) evaluate() int {
+	if bp.sideToMove == black {
+		return -bp.score
+	}
+
+	return bp.score
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		fen         string
+		expected    int
+		description string
+	}{
+		{StartingFEN, 0, "starting position"},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", -40, "black to move after e4"},
+		{"4k3/8/8/8/8/8/8/3QK3 w - - 0 1", 895, "white up a queen"},
+		{"3qk3/8/8/8/8/8/8/4K3 w - - 0 1", -895, "black up a queen"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		res := evaluate(p)
+		if res != test.expected {
+			t.Errorf("Expected evaluation of %d for %s, but got: %d", test.expected, test.description, res)
+		}
+	}
+}
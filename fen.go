@@ -0,0 +1,529 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const StartingFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// parseFEN builds a position from a Forsyth-Edwards Notation string. The two move clock fields
+// are optional, defaulting to 0 and 1, as they are frequently left off in EPD style strings. A
+// crazyhouse position has the pieces in the pockets after the piece placement, either in brackets
+// or as a ninth rank, e.g. [Qnp] or /Qnp, and its promoted pieces followed by a tilde, e.g. Q~. A
+// three-check position has the checks each side has left to give after the en passant target
+// square, e.g. 3+3, or the checks each side has given at the end, e.g. +0+0.
+func parseFEN(fen string) (position, error) {
+	return parseVariantFEN(fen, standardChess)
+}
+
+// parseVariantFEN builds a position of the variant from FEN, as parseFEN does, for variants whose
+// positions can't be told apart by their FEN. In antichess, a side may have any number of kings,
+// and there's no castling.
+func parseVariantFEN(fen string, v variant) (position, error) {
+	fields := strings.Fields(fen)
+	checksField, checksFieldNumber := "", 0
+	if n := len(fields); n == 5 || n == 7 {
+		i := 4
+		if strings.HasPrefix(fields[n-1], "+") {
+			i = n - 1
+		}
+
+		if strings.Contains(fields[i], "+") {
+			checksField, checksFieldNumber = fields[i], i+1
+			fields = append(fields[:i:i], fields[i+1:]...)
+		}
+	}
+
+	if len(fields) != 6 && len(fields) != 4 {
+		return position{}, fmt.Errorf("Invalid FEN: expected 4 or 6 space separated fields but found %d.", len(fields))
+	}
+
+	p := position{halfmoveClock: 0, fullmoveNumber: 1}
+
+	placement := fields[0]
+	if i := strings.Index(placement, "["); i >= 0 && strings.HasSuffix(placement, "]") {
+		p.variant = crazyhouse
+		if err := parseFENPockets(&p, placement[i+1:len(placement)-1]); err != nil {
+			return position{}, err
+		}
+		placement = placement[:i]
+	} else if strings.Count(placement, "/") == BoardSize {
+		p.variant = crazyhouse
+		i := strings.LastIndex(placement, "/")
+		if err := parseFENPockets(&p, placement[i+1:]); err != nil {
+			return position{}, err
+		}
+		placement = placement[:i]
+	}
+
+	if v != standardChess {
+		p.variant = v
+	}
+
+	err := parseFENPiecePlacement(&p.board, placement, p.variant)
+	if err != nil {
+		return position{}, err
+	}
+
+	switch fields[1] {
+	case "w":
+		p.sideToMove = "W"
+	case "b":
+		p.sideToMove = "B"
+	default:
+		return position{}, fmt.Errorf("Invalid FEN side to move (field 2): '%s' (must be w or b).", fields[1])
+	}
+
+	err = parseFENCastlingRights(&p, fields[2])
+	if err != nil {
+		return position{}, err
+	}
+
+	p.enPassantSquare, err = parseFENEnPassantSquare(p.board, fields[3], p.sideToMove)
+	if err != nil {
+		return position{}, err
+	}
+
+	if len(fields) == 6 {
+		p.halfmoveClock, err = strconv.Atoi(fields[4])
+		if err != nil || p.halfmoveClock < 0 {
+			return position{}, fmt.Errorf("Invalid FEN halfmove clock (field 5): '%s' (must be a number of 0 or more).", fields[4])
+		}
+
+		p.fullmoveNumber, err = strconv.Atoi(fields[5])
+		if err != nil || p.fullmoveNumber < 1 {
+			return position{}, fmt.Errorf("Invalid FEN fullmove number (field 6): '%s' (must be a number of 1 or more).", fields[5])
+		}
+	}
+
+	if checksField != "" {
+		if v == standardChess {
+			p.variant = threeCheck
+		}
+		if err := parseFENChecks(&p, checksField, checksFieldNumber); err != nil {
+			return position{}, err
+		}
+	}
+
+	setPieceStateFromFEN(&p)
+	p.hash = p.getHash()
+	return p, nil
+}
+
+// parseFENPiecePlacement reads the pieces on the board, which must include the kings the variant
+// has, one of each colour in most. Pawns can't be on the first or last rank, except for white's on
+// the first rank in horde.
+func parseFENPiecePlacement(b *board, field string, v variant) error {
+	ranks := strings.Split(field, "/")
+	if len(ranks) != BoardSize {
+		return fmt.Errorf("Invalid FEN piece placement (field 1): expected %d ranks separated by '/' but found %d.", BoardSize, len(ranks))
+	}
+
+	b.clear()
+	kingCount := map[string]int{"W": 0, "B": 0}
+	for row, rankStr := range ranks {
+		rank := BoardSize - row
+		col := 0
+		for i, c := range rankStr {
+			if c == '~' {
+				if i == 0 || !unicode.IsLetter(rune(rankStr[i-1])) {
+					return fmt.Errorf("Invalid FEN piece placement (field 1): '~' must follow a piece on rank %d (at character %d of the rank).", rank, i+1)
+				}
+				(*b)[row][col-1].promoted = true
+				continue
+			}
+
+			if col >= BoardSize {
+				return fmt.Errorf("Invalid FEN piece placement (field 1): rank %d describes more than %d squares (at character %d of the rank).", rank, BoardSize, i+1)
+			}
+
+			if c >= '1' && c <= '8' {
+				col += int(c - '0')
+				continue
+			}
+
+			name := strings.ToUpper(string(c))
+			piece, err := getPieceFromName(name)
+			if err != nil {
+				return fmt.Errorf("Invalid FEN piece placement (field 1): unrecognised character '%c' on rank %d (at character %d of the rank).", c, rank, i+1)
+			}
+
+			color := "B"
+			if unicode.IsUpper(c) {
+				color = "W"
+			}
+
+			if name == "P" && (rank == 1 || rank == BoardSize) && !(v == horde && color == "W" && rank == 1) {
+				return fmt.Errorf("Invalid FEN piece placement (field 1): pawn found on rank %d (at character %d of the rank).", rank, i+1)
+			}
+
+			if name == "K" {
+				kingCount[color]++
+			}
+
+			(*b)[row][col] = gamePiece{color: color, piece: piece}
+			col++
+		}
+
+		if col != BoardSize {
+			return fmt.Errorf("Invalid FEN piece placement (field 1): rank %d describes %d squares (must be %d).", rank, col, BoardSize)
+		}
+	}
+
+	if counts := v.getKingCounts(); counts[white] >= 0 && kingCount["W"] != counts[white] || counts[black] >= 0 && kingCount["B"] != counts[black] {
+		expected := "one of each"
+		if counts != [2]int{1, 1} {
+			expected = fmt.Sprintf("%d white and %d black in %s", counts[white], counts[black], strings.ToLower(v.String()))
+		}
+		return fmt.Errorf("Invalid FEN piece placement (field 1): found %d white and %d black kings (must be %s).", kingCount["W"], kingCount["B"], expected)
+	}
+
+	return nil
+}
+
+// parseFENPockets reads the pieces in the pockets of a crazyhouse position: white's in upper case
+// and black's in lower case, in any order, or "-" if they're empty.
+func parseFENPockets(p *position, field string) error {
+	if field == "-" {
+		return nil
+	}
+
+	for i, c := range field {
+		name := strings.ToUpper(string(c))
+		if !strings.Contains(pocketPieceNames, name) {
+			return fmt.Errorf("Invalid FEN pockets (field 1): unrecognised character '%c' (at character %d of the pockets).", c, i+1)
+		}
+
+		color := "B"
+		if unicode.IsUpper(c) {
+			color = "W"
+		}
+		p.getPocket(color).add(name)
+	}
+
+	return nil
+}
+
+// parseFENChecks reads the checks each side has given in a three-check position, white's first,
+// from the number each has left to give, e.g. 3+3, or after a '+', the number each has given, e.g.
+// +0+0.
+func parseFENChecks(p *position, field string, fieldNumber int) error {
+	invalid := fmt.Errorf("Invalid FEN check counts (field %d): '%s' (must be the checks each side has left to give, e.g. 3+3, or has given, e.g. +0+0).", fieldNumber, field)
+	given := strings.HasPrefix(field, "+")
+	counts := strings.Split(strings.TrimPrefix(field, "+"), "+")
+	if len(counts) != len(p.checks) {
+		return invalid
+	}
+
+	for color, count := range counts {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 || n > threeCheckChecks {
+			return invalid
+		}
+
+		if !given {
+			n = threeCheckChecks - n
+		}
+		p.checks[color] = n
+	}
+
+	return nil
+}
+
+// parseFENCastlingRights reads the castling rights, and the rooks they're with, from FEN's castling
+// availability field. As well as K, Q, k and q, X-FEN and Shredder-FEN's letters for the files of
+// the rooks are read, for Chess960, where there may be more than one rook on one side of the king.
+// In X-FEN, K, Q, k and q are with the outermost rook on that side.
+func parseFENCastlingRights(p *position, field string) error {
+	if field == "-" {
+		return nil
+	}
+
+	if p.variant == antichess {
+		return fmt.Errorf("Invalid FEN castling availability (field 3): '%s' (must be - in antichess, which has no castling).", field)
+	}
+
+	for i, c := range field {
+		color, rank := "W", 1
+		if unicode.IsLower(c) {
+			color, rank = "B", BoardSize
+		}
+
+		kingSquare, err := p.board.getSquareForPiece(color, "K")
+		if err != nil || kingSquare.rank != rank {
+			return fmt.Errorf("Invalid FEN castling availability (field 3): '%c' at character %d requires the %s king on rank %d.", c, i+1, getColorName(color), rank)
+		}
+
+		var rookSquare square
+		switch letter := unicode.ToUpper(c); {
+		case letter == 'K' || letter == 'Q':
+			rookSquare = getOutermostRookSquare(p.board, kingSquare, letter == 'K')
+			if isNoSquare(rookSquare) {
+				side := "kingside"
+				if letter == 'Q' {
+					side = "queenside"
+				}
+				return fmt.Errorf("Invalid FEN castling availability (field 3): '%c' at character %d requires a rook on the %s of the %s king.", c, i+1, side, getColorName(color))
+			}
+		case letter >= 'A' && letter <= 'H':
+			rookSquare = square{file: string(letter), rank: rank}
+			if !hasPiece(p.board, rookSquare, "R", color) || rookSquare.file == kingSquare.file {
+				return fmt.Errorf("Invalid FEN castling availability (field 3): '%c' at character %d requires a rook on %s%d.", c, i+1, rookSquare.file, rank)
+			}
+		default:
+			return fmt.Errorf("Invalid FEN castling availability (field 3): unrecognised character '%c' at character %d (must be - or a combination of K, Q, k and q, or of the files of the rooks, as in Shredder-FEN).", c, i+1)
+		}
+
+		right := getCastlingRights(color)[0]
+		if fromFileStr(rookSquare.file) < fromFileStr(kingSquare.file) {
+			right++
+		}
+
+		if *p.castlingRights.get(right) {
+			return fmt.Errorf("Invalid FEN castling availability (field 3): '%c' repeated at character %d.", c, i+1)
+		}
+
+		*p.castlingRights.get(right) = true
+		if !areSquaresEqual(rookSquare, p.getCastlingRookSquare(right)) {
+			p.castlingFiles[right] = rookSquare.file
+		}
+		if kingSquare.file != "E" || p.castlingFiles[right] != "" {
+			p.chess960 = true
+		}
+	}
+
+	return nil
+}
+
+// getOutermostRookSquare returns the square of the rook of the king's colour furthest from it on
+// its rank, on its kingside or queenside, if there is one.
+func getOutermostRookSquare(b board, kingSquare square, kingside bool) square {
+	king, _ := b.getPieceAt(kingSquare)
+	col, step := 0, 1
+	if kingside {
+		col, step = BoardSize-1, -1
+	}
+
+	for ; col != fromFileStr(kingSquare.file); col += step {
+		sq := square{file: toFileStr(col), rank: kingSquare.rank}
+		if hasPiece(b, sq, "R", king.color) {
+			return sq
+		}
+	}
+
+	return square{}
+}
+
+func parseFENEnPassantSquare(b board, field string, sideToMove string) (square, error) {
+	if field == "-" {
+		return square{}, nil
+	}
+
+	sq, err := getSquareFromNotation(field)
+	if err != nil {
+		return square{}, fmt.Errorf("Invalid FEN en passant target square (field 4): '%s' is not a square.", field)
+	}
+
+	// The target square is the one the pawn passed over, so it's on the 6th rank if white is to
+	// move, and the 3rd if black is. The pawn itself must be directly in front of it.
+	targetRank, pawnRank, pawnColor := 6, 5, "B"
+	if sideToMove == "B" {
+		targetRank, pawnRank, pawnColor = 3, 4, "W"
+	}
+
+	if sq.rank != targetRank {
+		return square{}, fmt.Errorf("Invalid FEN en passant target square (field 4): '%s' must be on rank %d when %s is to move.", field, targetRank, sideToMove)
+	}
+
+	if !hasPiece(b, square{file: sq.file, rank: pawnRank}, "P", pawnColor) {
+		return square{}, fmt.Errorf("Invalid FEN en passant target square (field 4): '%s' has no pawn on %s%d that could have just passed it.", field, sq.file, pawnRank)
+	}
+
+	return sq, nil
+}
+
+// setPieceStateFromFEN sets the moved flags and move counts on the pieces of a position parsed
+// from FEN. FEN doesn't record how pieces got to where they are, so kings and rooks are unmoved
+// only if they have a castling right, other pieces are unmoved if they are on a square they start
+// the game on, and the only piece given a move count is a pawn that can be taken en passant.
+func setPieceStateFromFEN(p *position) {
+	start := board{}
+	start.init()
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if p.board.isRowColEmpty(i, j) {
+				continue
+			}
+
+			gp := &p.board[i][j]
+			gp.moved = gp.color != start[i][j].color || start[i][j].piece == nil || gp.getName() != start[i][j].getName()
+		}
+	}
+
+	for _, color := range []string{"W", "B"} {
+		if kingSquare, err := p.board.getSquareForPiece(color, "K"); err == nil {
+			setMovedUnlessCastlingRight(&p.board, kingSquare, p.castlingRights.any(color))
+		}
+	}
+	for right := 0; right < 4; right++ {
+		setMovedUnlessCastlingRight(&p.board, p.getCastlingRookSquare(right), *p.castlingRights.get(right))
+	}
+
+	if !isNoSquare(p.enPassantSquare) {
+		pawnRank := 5
+		if p.sideToMove == "B" {
+			pawnRank = 4
+		}
+
+		row, col := getRowColForSquare(square{file: p.enPassantSquare.file, rank: pawnRank})
+		p.board[row][col].moved = true
+		p.board[row][col].numberOfMoves = 1
+	}
+}
+
+func setMovedUnlessCastlingRight(b *board, sq square, hasRight bool) {
+	row, col := getRowColForSquare(sq)
+	if !b.isRowColEmpty(row, col) {
+		(*b)[row][col].moved = !hasRight
+	}
+}
+
+func hasPiece(b board, sq square, name string, color string) bool {
+	gp, err := b.getPieceAt(sq)
+	return err == nil && gp.getName() == name && gp.color == color
+}
+
+// toFEN serializes a position to Forsyth-Edwards Notation.
+func (p position) toFEN() string {
+	var sb strings.Builder
+	for i := 0; i < BoardSize; i++ {
+		empty := 0
+		for j := 0; j < BoardSize; j++ {
+			if p.board.isRowColEmpty(i, j) {
+				empty++
+				continue
+			}
+
+			if empty > 0 {
+				sb.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+
+			sb.WriteString(getFENPieceName(p.board[i][j]))
+			if p.variant == crazyhouse && p.board[i][j].promoted {
+				sb.WriteString("~")
+			}
+		}
+
+		if empty > 0 {
+			sb.WriteString(strconv.Itoa(empty))
+		}
+
+		if i < BoardSize-1 {
+			sb.WriteString("/")
+		}
+	}
+
+	if p.variant == crazyhouse {
+		sb.WriteString("[" + getFENPockets(p.pockets) + "]")
+	}
+
+	sb.WriteString(" ")
+	sb.WriteString(strings.ToLower(p.sideToMove))
+
+	sb.WriteString(" ")
+	castling := ""
+	for right := 0; right < 4; right++ {
+		if *p.castlingRights.get(right) {
+			castling += p.getFENCastlingRight(right)
+		}
+	}
+	if castling == "" {
+		castling = "-"
+	}
+	sb.WriteString(castling)
+
+	sb.WriteString(" ")
+	if isNoSquare(p.enPassantSquare) {
+		sb.WriteString("-")
+	} else {
+		sb.WriteString(getNotationForSquare(p.enPassantSquare))
+	}
+
+	if p.variant == threeCheck {
+		sb.WriteString(fmt.Sprintf(" %d+%d", threeCheckChecks-p.checks[white], threeCheckChecks-p.checks[black]))
+	}
+
+	sb.WriteString(fmt.Sprintf(" %d %d", p.halfmoveClock, p.fullmoveNumber))
+	return sb.String()
+}
+
+// getFENCastlingRight returns how a castling right is written in FEN: as K, Q, k or q, or as in
+// X-FEN, the file of the rook, if it's not the outermost rook on that side of the king.
+func (p position) getFENCastlingRight(right int) string {
+	color := "W"
+	if right >= 2 {
+		color = "B"
+	}
+
+	rookSquare := p.getCastlingRookSquare(right)
+	kingSquare, _ := p.board.getSquareForPiece(color, "K")
+	letter := "KQ"[right%2 : right%2+1]
+	if !areSquaresEqual(getOutermostRookSquare(p.board, kingSquare, right%2 == 0), rookSquare) {
+		letter = rookSquare.file
+	}
+
+	if color == "B" {
+		return strings.ToLower(letter)
+	}
+
+	return letter
+}
+
+// getFENPockets returns the pieces in the pockets as FEN writes them: white's in upper case, then
+// black's in lower case.
+func getFENPockets(pockets [2]pocket) string {
+	var sb strings.Builder
+	for color, pk := range pockets {
+		for i, n := range pk {
+			name := pocketPieceNames[i : i+1]
+			if color == black {
+				name = strings.ToLower(name)
+			}
+			sb.WriteString(strings.Repeat(name, n))
+		}
+	}
+
+	return sb.String()
+}
+
+func getFENPieceName(gp gamePiece) string {
+	if gp.color == "B" {
+		return strings.ToLower(gp.getName())
+	}
+
+	return gp.getName()
+}
+
+// getSquareFromNotation parses a square written as in FEN, PGN and UCI, e.g. "e4".
+func getSquareFromNotation(s string) (square, error) {
+	if len(s) != 2 {
+		return square{}, errors.New("Square not valid (must be a file and a rank, e.g. e4).")
+	}
+
+	file := strings.ToUpper(s[0:1])
+	rank := int(s[1] - '0')
+	if fromFileStr(file) < 0 || rank < 1 || rank > BoardSize {
+		return square{}, fmt.Errorf("Square not valid: %s.", s)
+	}
+
+	return square{file: file, rank: rank}, nil
+}
+
+func getNotationForSquare(sq square) string {
+	return fmt.Sprintf("%s%d", strings.ToLower(sq.file), sq.rank)
+}
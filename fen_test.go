@@ -0,0 +1,211 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFENStartingPosition(t *testing.T) {
+	p, err := parseFEN(StartingFEN)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing starting position FEN: %s", err)
+	}
+
+	b := board{}
+	b.init()
+	if p.board != b {
+		t.Errorf("Board parsed from starting position FEN doesn't match initialised board")
+	}
+
+	if p.sideToMove != "W" || !p.castlingRights.any("W") || !p.castlingRights.any("B") ||
+		!isNoSquare(p.enPassantSquare) || p.halfmoveClock != 0 || p.fullmoveNumber != 1 {
+		t.Errorf("Unexpected state parsed from starting position FEN: %+v", p)
+	}
+
+	if newPosition().toFEN() != StartingFEN {
+		t.Errorf("Expected starting position to serialize to %s, but got: %s", StartingFEN, newPosition().toFEN())
+	}
+}
+
+func TestParseFENRoundTrip(t *testing.T) {
+	fens := []string{
+		StartingFEN,
+		"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		"rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"4k3/8/8/8/8/8/8/4K2R b K - 49 120",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[] w KQkq - 0 1",
+		"r1bqk2r/pppp1ppp/2n5/4p3/1b2P3/2N5/PPPP1PPP/R1BQKB1R[NPn] w KQkq - 0 5",
+		"4k2Q~/8/8/8/8/8/8/4K3[RPPpp] b - - 0 40",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 3+3 0 1",
+		"rnbqkb1r/pppp1ppp/5n2/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR b KQkq - 1+3 3 3",
+	}
+
+	for _, fen := range fens {
+		p, err := parseFEN(fen)
+		if err != nil {
+			t.Errorf("Unexpected error parsing FEN %s: %s", fen, err)
+			continue
+		}
+
+		if p.toFEN() != fen {
+			t.Errorf("Expected FEN to round-trip to %s, but got: %s", fen, p.toFEN())
+		}
+	}
+}
+
+func TestParseFENPieceState(t *testing.T) {
+	p, _ := parseFEN("r3k2r/8/8/3pP3/8/8/8/R3K2R w Kq d6 0 1")
+
+	expectMoved := func(sq square, expected bool) {
+		gp, _ := p.board.getPieceAt(sq)
+		if gp.moved != expected {
+			t.Errorf("Expected piece %v on %v to have moved=%t", gp, sq, expected)
+		}
+	}
+
+	expectMoved(square{file: "E", rank: 1}, false)
+	expectMoved(square{file: "H", rank: 1}, false)
+	expectMoved(square{file: "A", rank: 1}, true)
+	expectMoved(square{file: "E", rank: 8}, false)
+	expectMoved(square{file: "H", rank: 8}, true)
+	expectMoved(square{file: "A", rank: 8}, false)
+
+	// The pawn that has just moved two squares can be taken en passant.
+	res := p.getLegalSquares(square{file: "E", rank: 5})
+	expectedCount := 2
+	if len(res) != expectedCount {
+		t.Errorf("Expected white pawn that can take en passant to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
+	}
+}
+
+func TestParseFENErrors(t *testing.T) {
+	tests := []struct {
+		fen      string
+		contains string
+	}{
+		{"", "expected 4 or 6 space separated fields"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0", "expected 4 or 6 space separated fields but found 5."},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1", "expected 8 ranks"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNX w KQkq - 0 1", "unrecognised character 'X' on rank 1 (at character 8"},
+		{"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "unrecognised character '9' on rank 6"},
+		{"rnbqkbnr/ppppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "rank 7 describes more than 8 squares"},
+		{"rnbqkbnr/ppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "rank 7 describes 7 squares"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQQBNR w KQkq - 0 1", "found 0 white and 1 black kings"},
+		{"pnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "pawn found on rank 8"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1", "side to move (field 2)"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQxq - 0 1", "unrecognised character 'x' at character 3"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KKkq - 0 1", "'K' repeated at character 2"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBN1 w KQkq - 0 1", "'K' at character 1 requires a rook on the kingside of the white king"},
+		{"4k3/8/8/8/8/8/8/1K2R2R w Q - 0 1", "'Q' at character 1 requires a rook on the queenside of the white king"},
+		{"4k3/8/8/8/8/8/8/1K2R2R w C - 0 1", "'C' at character 1 requires a rook on C1"},
+		{"4k3/8/8/8/8/8/8/1K2R2R w KH - 0 1", "'H' repeated at character 2"},
+		{"8/4k3/8/8/8/8/8/1K2R2R w k - 0 1", "'k' at character 1 requires the black king on rank 8"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e9 0 1", "'e9' is not a square"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e3 0 1", "must be on rank 6 when W is to move"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e6 0 1", "has no pawn on E5"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - -1 1", "halfmove clock (field 5)"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0", "fullmove number (field 6)"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR[QK] w KQkq - 0 1", "unrecognised character 'K' (at character 2 of the pockets)"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR/x w KQkq - 0 1", "unrecognised character 'x' (at character 1 of the pockets)"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/~RNBQKBNR[] w KQkq - 0 1", "'~' must follow a piece on rank 1"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 4+3 0 1", "check counts (field 5): '4+3'"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 +1", "check counts (field 7): '+1'"},
+	}
+
+	for _, test := range tests {
+		_, err := parseFEN(test.fen)
+		if err == nil {
+			t.Errorf("Expected error parsing FEN '%s' but got none", test.fen)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.contains) {
+			t.Errorf("Expected error parsing FEN '%s' to contain \"%s\", but got: %s", test.fen, test.contains, err)
+		}
+	}
+}
+
+func TestParseFENCastlingNotation(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected string
+		chess960 bool
+	}{
+		// Test: Shredder-FEN gives the files of the rooks
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1", StartingFEN, false},
+		{"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9", "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9", true},
+		// Test: X-FEN gives the file of a rook only if it's not the outermost on that side
+		{"4k3/8/8/8/8/8/8/1K2R2R w E - 0 1", "4k3/8/8/8/8/8/8/1K2R2R w E - 0 1", true},
+		{"4k3/8/8/8/8/8/8/1K2R2R w H - 0 1", "4k3/8/8/8/8/8/8/1K2R2R w K - 0 1", true},
+		{"r1r1k3/8/8/8/8/8/8/4K3 b c - 0 1", "r1r1k3/8/8/8/8/8/8/4K3 b c - 0 1", true},
+		{"r1r1k3/8/8/8/8/8/8/4K3 b q - 0 1", "r1r1k3/8/8/8/8/8/8/4K3 b q - 0 1", false},
+	}
+
+	for _, test := range tests {
+		p, err := parseFEN(test.fen)
+		if err != nil {
+			t.Errorf("Unexpected error parsing FEN %s: %s", test.fen, err)
+			continue
+		}
+
+		if p.toFEN() != test.expected || p.chess960 != test.chess960 {
+			t.Errorf("Expected %s to be read as %s (Chess960 %t), but got: %s (%t)", test.fen, test.expected, test.chess960, p.toFEN(), p.chess960)
+		}
+	}
+}
+
+func TestFENRoundTripsBoardTestPositions(t *testing.T) {
+	// The move sequences used to set up positions in board_test.go.
+	sequences := [][]string{
+		{"e2e4", "f7f6", "d1h5", "g7g6"},
+		{"f2f3", "e7e6", "d2d3", "d8h4"},
+		{"f2f3", "e7e6", "a2a4", "a7a6", "a4a5", "b7b6", "a1a4", "d8h4"},
+		{"f2f3", "e7e6", "e2e3", "g8f6", "e1f2", "f6h5", "d1e2", "h5g3", "a2a3", "d8h4", "b2b3", "g3e4"},
+		{"e2e3", "g8f6", "c2c3", "f6d5", "g2g3", "d5b4", "f1g2", "h7h6", "g1e2", "g7g6", "h1f1", "b4d3"},
+		{"e2e3", "e7e5", "e1e2", "e5e4", "d1e1", "f7f5", "d2d3", "f5f4", "c1d2", "a7a6", "b1c3", "b7b6",
+			"a1d1", "c7c6", "g2g3", "d7d6", "g1h3", "f4f3"},
+		{"f2f3", "e7e6", "a2a3", "d8h4"},
+		{"f2f3", "b8c6", "g2g4", "c6d4", "e2e3", "e7e6", "a2a3", "d8h4"},
+		{"e2e4", "e7e5", "f1c4", "a7a6", "d1f3", "b7b4", "f3f7"},
+	}
+
+	for _, sequence := range sequences {
+		b := board{}
+		b.init()
+		for i, m := range sequence {
+			from, _ := getSquareFromNotation(m[0:2])
+			to, _ := getSquareFromNotation(m[2:4])
+			b.movePiece(from, to)
+
+			sideToMove := "B"
+			if i%2 == 1 {
+				sideToMove = "W"
+			}
+
+			p := newPositionFromBoard(b, sideToMove)
+			fen := p.toFEN()
+			parsed, err := parseFEN(fen)
+			if err != nil {
+				t.Errorf("Unexpected error parsing FEN %s after %v: %s", fen, sequence[:i+1], err)
+				continue
+			}
+
+			if parsed.toFEN() != fen {
+				t.Errorf("Expected FEN to round-trip to %s, but got: %s", fen, parsed.toFEN())
+			}
+
+			for row := 0; row < BoardSize; row++ {
+				for col := 0; col < BoardSize; col++ {
+					if b.isRowColEmpty(row, col) != parsed.board.isRowColEmpty(row, col) ||
+						(!b.isRowColEmpty(row, col) && getFENPieceName(b[row][col]) != getFENPieceName(parsed.board[row][col])) {
+						t.Errorf("Board parsed from %s differs from original at %v", fen, getSquareForRowCol(row, col))
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// game is a game in progress: the position it has reached, and the moves that reached it from the
+// position it started from. Moves that have been undone are kept until another move is made, so
+// they can be redone. Each side is played by a "human" or the "engine", and has a clock, by color,
+// if the game is timed.
+type game struct {
+	startPosition position
+	position      position
+	moves         []move
+	undos         []moveUndo
+	undoneMoves   []move
+	repetitions   map[uint64]int
+	result        string
+	players       map[string]string
+	clocks        map[string]*clock
+}
+
+func newGame(startPosition position) *game {
+	return &game{
+		startPosition: startPosition,
+		position:      startPosition,
+		repetitions:   map[uint64]int{startPosition.hash: 1},
+		result:        "*",
+	}
+}
+
+// makeMove plays a legal move in the game's position, and records it in the game's history. Any
+// moves that were undone can no longer be redone.
+func (g *game) makeMove(m move) {
+	g.playMove(m)
+	g.undoneMoves = nil
+}
+
+func (g *game) playMove(m move) {
+	g.moves = append(g.moves, m)
+	g.undos = append(g.undos, g.position.makeMove(m))
+	g.repetitions[g.position.hash]++
+}
+
+// makeTimedMove makes a move that took the elapsed time, stopping the mover's clock if the game is
+// timed. It returns false, without making the move, if their time ran out first.
+func (g *game) makeTimedMove(m move, elapsed time.Duration) bool {
+	if c := g.clocks[g.position.sideToMove]; c != nil && !c.stop(elapsed) {
+		return false
+	}
+
+	g.makeMove(m)
+	return true
+}
+
+// undoMove takes back the last move made, returning false if there are none.
+func (g *game) undoMove() bool {
+	if len(g.moves) == 0 {
+		return false
+	}
+
+	last := len(g.moves) - 1
+	m, u := g.moves[last], g.undos[last]
+	g.repetitions[g.position.hash]--
+	if g.repetitions[g.position.hash] == 0 {
+		delete(g.repetitions, g.position.hash)
+	}
+	g.position.unmakeMove(m, u)
+	g.moves, g.undos = g.moves[:last], g.undos[:last]
+	g.undoneMoves = append(g.undoneMoves, m)
+	return true
+}
+
+// redoMove plays again the last move undone, returning false if there are none.
+func (g *game) redoMove() bool {
+	if len(g.undoneMoves) == 0 {
+		return false
+	}
+
+	last := len(g.undoneMoves) - 1
+	g.playMove(g.undoneMoves[last])
+	g.undoneMoves = g.undoneMoves[:last]
+	return true
+}
+
+// isEngineToMove returns whether the side to move is played by the engine.
+func (g *game) isEngineToMove() bool {
+	return g.players[g.position.sideToMove] == "engine"
+}
+
+// getTimeoutResult returns the result of the game when the side's time runs out: a loss, unless
+// the other side couldn't checkmate them by any series of legal moves, which is a draw.
+func (g *game) getTimeoutResult(color string) string {
+	if !g.position.canCheckmate(switchColor(color)) {
+		return "1/2-1/2"
+	}
+
+	return getResultForWinner(switchColor(color))
+}
+
+// print prints the board, and the time left on each side's clock if the game is timed. The side
+// to move's clock doesn't include the time they've been thinking.
+func (g *game) print() {
+	g.position.print()
+	if g.clocks != nil {
+		fmt.Printf("W %s   B %s\n\n", formatClockTime(g.clocks["W"].getTimeLeft(0)), formatClockTime(g.clocks["B"].getTimeLeft(0)))
+	}
+}
+
+// getDrawReason returns why the game is drawn in its current position, if it is.
+func (g *game) getDrawReason() string {
+	return getDrawReason(g.position, g.repetitions)
+}
+
+// toPGN returns the game for export in PGN format, with its moves written in SAN.
+func (g *game) toPGN() pgnGame {
+	pg := newPGNGame(g.startPosition)
+	p := g.startPosition
+	for _, m := range g.moves {
+		pg.addMove(pgnMove{san: getSAN(p, m), move: m})
+		p.makeMove(m)
+	}
+	pg.setResult(g.result)
+	return pg
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGameMakeMove(t *testing.T) {
+	g := newGame(newPosition())
+	for _, san := range []string{"Nf3", "Nf6", "Ng1", "Ng8", "Nf3", "Nf6", "Ng1"} {
+		m, err := resolveSAN(g.position, san)
+		if err != nil {
+			t.Fatalf("Unexpected error playing %s: %s", san, err)
+		}
+		g.makeMove(m)
+	}
+
+	if len(g.moves) != 7 {
+		t.Errorf("Expected game to have 7 moves, but got: %d", len(g.moves))
+	}
+
+	if res := g.getDrawReason(); res != "" {
+		t.Errorf("Expected no draw before the third repetition, but got: %s", res)
+	}
+
+	m, _ := resolveSAN(g.position, "Ng8")
+	g.makeMove(m)
+	if res := g.getDrawReason(); res != "Threefold repetition" {
+		t.Errorf("Expected draw by threefold repetition, but got: %s", res)
+	}
+
+	g.result = "1/2-1/2"
+	pg := g.toPGN()
+	if len(pg.moves) != 8 || pg.moves[0].san != "Nf3" || pg.moves[7].san != "Ng8" || pg.result != "1/2-1/2" {
+		t.Errorf("Expected PGN of game to have its moves and result, but got: %v", pg)
+	}
+}
+
+func TestGameUndoRedo(t *testing.T) {
+	g := newGame(newPosition())
+	for _, san := range []string{"e4", "d5", "exd5"} {
+		m, _ := resolveSAN(g.position, san)
+		g.makeMove(m)
+	}
+
+	if !g.undoMove() || !g.undoMove() {
+		t.Fatalf("Expected to be able to undo two moves")
+	}
+
+	expected := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+	if g.position.toFEN() != expected {
+		t.Errorf("Expected FEN after undoing two moves to be %s, but got: %s", expected, g.position.toFEN())
+	}
+
+	if !g.redoMove() {
+		t.Fatalf("Expected to be able to redo a move")
+	}
+
+	expected = "rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2"
+	if g.position.toFEN() != expected {
+		t.Errorf("Expected FEN after redoing a move to be %s, but got: %s", expected, g.position.toFEN())
+	}
+
+	// Making a different move means the undone one can't be redone.
+	m, _ := resolveSAN(g.position, "Nc3")
+	g.makeMove(m)
+	if g.redoMove() {
+		t.Errorf("Expected not to be able to redo a move after making another")
+	}
+
+	for g.undoMove() {
+	}
+	if g.position != g.startPosition || len(g.moves) != 0 {
+		t.Errorf("Expected undoing all moves to return to the start position, but got: %s", g.position.toFEN())
+	}
+
+	if g.repetitions[g.position.hash] != 1 || len(g.repetitions) != 1 {
+		t.Errorf("Expected repetition counts to be restored, but got: %v", g.repetitions)
+	}
+}
@@ -3,102 +3,570 @@ package main
 import (
 	"bufio"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
-	"unicode/utf8"
+	"time"
 )
 
 func main() {
-	board := board{}
-	board.init()
-	board.print()
+	fen := flag.String("fen", StartingFEN, "FEN of the position to start the game from")
+	chess960 := flag.String("chess960", "", "number of the Chess960 starting position to play from, 0-959, or random")
+	variantName := flag.String("variant", "standard", "rules to play by: standard, crazyhouse, atomic, three-check, kingofthehill, antichess, horde or racingkings")
+	pgnPath := flag.String("pgn", "", "file to write the game to in PGN format when it ends")
+	gameNumber := flag.Int("game", 1, "number of the game to replay from a PGN file with several games")
+	white := flag.String("white", "human", "who plays white: human or engine")
+	black := flag.String("black", "human", "who plays black: human or engine")
+	depth := flag.Int("depth", 0, "depth the engine searches to for each move, 0 for no limit")
+	moveTime := flag.Duration("movetime", 5*time.Second, "time the engine thinks for each move, 0 for no limit")
+	hashSize := flag.Int("hash", defaultHashSize, "size of the engine's transposition table in MB")
+	bookPath := flag.String("book", "", "Polyglot opening book (.bin) for the engine to play from and to give hints")
+	bookMode := flag.String("bookmode", "best", "how moves are picked from the book: best, or random by weight")
+	minGames := flag.Int("mingames", 3, "number of games a move must be played in to go in a book made with book")
+	syzygyPath := flag.String("syzygy", "", "directories of Syzygy endgame tablebases, separated as in PATH")
+	timeControl := flag.String("time", "", "time control for each side in minutes, with seconds of increment or delay: e.g. 5, 3+2, 15d5, 15b5 or 40/90+30,30+30")
+	autoQueen := flag.Bool("autoqueen", false, "promote pawns to queens without asking, when a move is entered without a promotion piece")
+	maxPly := flag.Int("maxply", 30, "number of plies from the start of each game that go in a book made with book")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n"+
+			"  %[1]s [flags]                   play a game, against the engine with -white or -black engine\n"+
+			"  %[1]s [flags] replay <file>     step through a game from a PGN file\n"+
+			"  %[1]s [flags] perft <depth>     count the move tree's leaf nodes to the given depth\n"+
+			"  %[1]s [flags] divide <depth>    as perft, broken down by the first move\n"+
+			"  %[1]s [flags] book <pgn> <bin>  make a Polyglot opening book from the games in a PGN file\n"+
+			"  %[1]s [flags] uci               run as an engine for a GUI, using the UCI protocol\n"+
+			"  %[1]s [flags] xboard            run as an engine for a GUI, using the XBoard protocol\n"+
+			"\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *hashSize < 1 {
+		fmt.Println("The hash size must be at least 1 MB.")
+		os.Exit(1)
+	}
+
+	var book *polyglotBook
+	if *bookPath != "" {
+		var err error
+		if book, err = readPolyglotBook(*bookPath, *bookMode); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	var tb *tablebase
+	if *syzygyPath != "" {
+		var err error
+		if tb, err = newTablebase(*syzygyPath); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	var err error
+	switch flag.Arg(0) {
+	case "":
+		var startPosition position
+		var players map[string]string
+		var periods []timePeriod
+		startPosition, err = getStartPosition(*fen, *chess960, *variantName)
+		if err == nil {
+			players, err = getPlayers(*white, *black, *depth, *moveTime, startPosition.variant)
+		}
+		if err == nil && *timeControl != "" {
+			periods, err = parseTimeControl(*timeControl)
+		}
+		if err == nil {
+			g := newGame(startPosition)
+			g.players = players
+			if periods != nil {
+				g.clocks = map[string]*clock{"W": newClock(periods), "B": newClock(periods)}
+			}
+
+			e := newEngine(*hashSize)
+			e.book = book
+			e.tablebase = tb
+			play(g, e, searchLimits{depth: *depth, moveTime: *moveTime}, *pgnPath, *autoQueen)
+		}
+	case "replay":
+		err = replay(flag.Arg(1), *gameNumber)
+	case "perft", "divide":
+		var startPosition position
+		var depth int
+		startPosition, err = getStartPosition(*fen, *chess960, *variantName)
+		if err == nil {
+			depth, err = strconv.Atoi(flag.Arg(1))
+		}
+		if err == nil {
+			runPerft(startPosition, depth, flag.Arg(0) == "divide")
+		}
+	case "uci":
+		runUCI(os.Stdin, os.Stdout, *hashSize, book, tb)
+	case "xboard":
+		runXBoard(os.Stdin, os.Stdout, *hashSize, book, tb)
+	case "book":
+		err = makeBook(flag.Arg(1), flag.Arg(2), *minGames, *maxPly)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// getStartPosition returns the position to start from: the one given as FEN, unless a Chess960
+// starting position is given by number, or as random. Games of a variant start from its own
+// starting position unless another is given as FEN.
+func getStartPosition(fen string, chess960 string, variantName string) (position, error) {
+	v, err := parseVariant(variantName)
+	if err != nil {
+		return position{}, err
+	}
+
+	if v != standardChess {
+		if chess960 != "" {
+			return position{}, fmt.Errorf("Chess960 can't be played as %s.", strings.ToLower(v.String()))
+		}
+
+		if fen == StartingFEN {
+			return newVariantPosition(v), nil
+		}
+
+		return parseVariantFEN(fen, v)
+	}
+
+	switch chess960 {
+	case "":
+		return parseFEN(fen)
+	case "random":
+		return newChess960Position(rand.Intn(chess960Positions))
+	}
+
+	n, err := strconv.Atoi(chess960)
+	if err != nil {
+		return position{}, fmt.Errorf("Chess960 position '%s' not recognised (must be a number from 0 to %d, or random).", chess960, chess960Positions-1)
+	}
+
+	return newChess960Position(n)
+}
+
+// getPlayers returns who plays each side, by color, checking the engine has a limit on how long
+// it thinks if it's playing, and that it knows the variant's rules.
+func getPlayers(white string, black string, depth int, moveTime time.Duration, v variant) (map[string]string, error) {
+	players := map[string]string{"W": white, "B": black}
+	for _, player := range players {
+		if player != "human" && player != "engine" {
+			return nil, fmt.Errorf("Player '%s' not recognised (must be human or engine).", player)
+		}
 
-	color := "W"
-	kingInCheckMate := false
-	kingInCheck := false
+		if player == "engine" && v != standardChess {
+			return nil, fmt.Errorf("The engine only plays standard chess, not %s.", strings.ToLower(v.String()))
+		}
+
+		if player == "engine" && depth <= 0 && moveTime <= 0 {
+			return nil, errors.New("The engine needs a depth or a move time to limit its search.")
+		}
+	}
+
+	return players, nil
+}
+
+func play(g *game, e *engine, limits searchLimits, pgnPath string, autoQueen bool) {
+	g.print()
 
-	reader := bufio.NewReader(os.Stdin)
+	lines := readLines(os.Stdin)
+	turnStart := time.Now()
 	for {
-		kingInCheckMate, _ = board.isKingInCheckMate(color)
-		if kingInCheckMate {
+		color := g.position.sideToMove
+		if winner, reason := g.position.getVariantWin(); winner != "" {
+			fmt.Printf("%s. %s wins!\n", reason, winner)
+			g.result = getResultForWinner(winner)
+			break
+		}
+
+		if g.position.isCheckMate() {
 			fmt.Printf("The %s king is in checkmate. %s wins!.\n", color, switchColor(color))
+			g.result = getResultForWinner(switchColor(color))
 			break
 		}
 
-		kingInCheck, _ = board.isKingInCheck(color)
-		if kingInCheck {
+		if drawReason := g.getDrawReason(); drawReason != "" {
+			fmt.Printf("%s. The game is drawn.\n", drawReason)
+			g.result = "1/2-1/2"
+			break
+		}
+
+		if c := g.clocks[color]; c != nil && c.hasRunOut(time.Since(turnStart)) {
+			g.result = g.getTimeoutResult(color)
+			if g.result == "1/2-1/2" {
+				fmt.Printf("The %s clock has run out, but %s can't checkmate. The game is drawn.\n", color, switchColor(color))
+			} else {
+				fmt.Printf("The %s clock has run out. %s wins on time!\n", color, switchColor(color))
+			}
+			break
+		}
+
+		if g.position.isKingInCheck() {
 			fmt.Printf("The %s king is in check!\n", color)
 		}
 
-		fmt.Printf("Select piece (%s): ", color)
-		fromInput, _ := reader.ReadString('\n')
-		fromSquare, err := getSquareFromInput(fromInput)
-		if err != nil {
-			fmt.Println(err)
+		if g.isEngineToMove() {
+			moveLimits := limits
+			if c := g.clocks[color]; c != nil && (limits.moveTime <= 0 || c.getMoveTime() < limits.moveTime) {
+				moveLimits.moveTime = c.getMoveTime()
+			}
+
+			result := e.search(g.position, moveLimits)
+			m := result.bestMove
+			if result.book {
+				fmt.Printf("Engine (%s) plays %s from its opening book\n", color, getSAN(g.position, m))
+			} else if result.tablebase {
+				fmt.Printf("Engine (%s) plays %s from the tablebases (score %s, DTZ %d)\n", color, getSAN(g.position, m), formatScore(result.score), result.dtz)
+			} else {
+				fmt.Printf("Engine (%s) plays %s (depth %d, score %s, %d nodes in %.1fs)\n", color, getSAN(g.position, m),
+					result.depth, formatScore(result.score), result.nodes, result.elapsed.Seconds())
+			}
+
+			if g.makeTimedMove(m, time.Since(turnStart)) {
+				g.print()
+				turnStart = time.Now()
+			}
 			continue
 		}
 
-		piece, err := board.getPieceAt(fromSquare)
-		if err != nil {
-			fmt.Println(err)
-			continue
+		fmt.Printf("Enter move (%s): ", color)
+		input, ok := readInput(lines, g.clocks[color], turnStart)
+		if !ok {
+			if c := g.clocks[color]; c != nil && c.hasRunOut(time.Since(turnStart)) {
+				fmt.Println()
+				continue
+			}
+			break
 		}
 
-		if piece.color != color {
-			fmt.Printf("Piece isn't of the correct colour (%s)\n", color)
+		if command, args, ok := getCommandFromInput(input); ok {
+			if command == "quit" {
+				break
+			}
+
+			runCommand(command, args, g, e)
 			continue
 		}
 
-		fmt.Printf("Enter destination square: ")
-		toInput, _ := reader.ReadString('\n')
-		toSquare, err := getSquareFromInput(toInput)
+		m, err := getMoveFromInput(g.position, input)
+		if err == errNoPromotionPiece {
+			if autoQueen {
+				m.promotion, err = "Q", nil
+			} else if m.promotion, ok = readPromotion(lines, g.clocks[color], turnStart, g.position.variant); ok {
+				err = nil
+			} else {
+				continue
+			}
+		}
+
 		if err != nil {
 			fmt.Println(err)
 			continue
 		}
 
-		if !isMoveLegal(board, piece, fromSquare, toSquare) {
-			fmt.Println("Not a legal move.")
-			continue
+		if g.makeTimedMove(m, time.Since(turnStart)) {
+			g.print()
+			turnStart = time.Now()
 		}
+	}
 
-		wouldKingBeInCheck := wouldKingBeInCheck(board, fromSquare, toSquare, color)
-		if wouldKingBeInCheck {
-			fmt.Println("Not a legal move (your king would be in check).")
-			continue
+	if pgnPath != "" {
+		runCommand("pgn", []string{pgnPath}, g, e)
+	}
+}
+
+// readPromotion asks for the piece a pawn is promoted to until one that it can be promoted to is
+// given. It returns false if the input ends, or the player's time runs out, first.
+func readPromotion(lines <-chan string, c *clock, turnStart time.Time, v variant) (string, bool) {
+	for {
+		fmt.Printf("Promoted pawn. Promote to (%s)? ", strings.Join(v.getPromotionPieceNames(), ", "))
+		input, ok := readInput(lines, c, turnStart)
+		if !ok {
+			return "", false
+		}
+
+		promotion, err := parsePromotionPiece(input, v)
+		if err == nil {
+			return promotion, true
+		}
+		fmt.Println(err)
+	}
+}
+
+// readLines reads lines of input in the background, so that waiting for a move can be given up
+// when the player's time runs out. The channel is closed when the input ends.
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	return lines
+}
+
+// readInput waits for the next line of input, for as long as there's time left on the player's
+// clock if they have one. It returns false if the input has ended or their time has run out.
+func readInput(lines <-chan string, c *clock, turnStart time.Time) (string, bool) {
+	var ticks <-chan time.Time
+	if c != nil {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			return line, ok
+		case <-ticks:
+			if c.hasRunOut(time.Since(turnStart)) {
+				return "", false
+			}
+		}
+	}
+}
+
+// getCommandFromInput splits input into a command and its arguments, if it's one of the commands
+// that can be entered in place of a move.
+func getCommandFromInput(entry string) (string, []string, bool) {
+	fields := strings.Fields(entry)
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "pgn", "undo", "redo", "hint", "analyze", "quit":
+		return strings.ToLower(fields[0]), fields[1:], true
+	}
+
+	return "", nil, false
+}
+
+func runCommand(command string, args []string, g *game, e *engine) {
+	switch command {
+	case "pgn":
+		game := g.toPGN()
+		// Prints the game so far, or with a file name argument, writes it to the file.
+		if len(args) == 0 {
+			fmt.Println()
+			fmt.Print(game)
+			fmt.Println()
+			return
+		}
+
+		if err := game.writeToFile(args[0]); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Printf("Game written to %s\n", args[0])
+	case "undo":
+		// Takes back the last move, which can be played again with redo until another move is made.
+		// Against the engine, its reply is taken back too, so that it's the player's move again.
+		if g.clocks != nil {
+			fmt.Println("Moves can't be taken back in a timed game.")
+			return
+		}
+
+		if !g.undoMove() {
+			fmt.Println("No move to undo.")
+			return
+		}
+
+		for g.isEngineToMove() && g.undoMove() {
+		}
+
+		g.print()
+	case "redo":
+		if !g.redoMove() {
+			fmt.Println("No move to redo.")
+			return
+		}
+
+		for g.isEngineToMove() && g.redoMove() {
+		}
+
+		g.print()
+	case "hint":
+		// Suggests a move from the opening book, picked as the engine would, and lists the others.
+		book := e.book
+		if g.position.variant != standardChess {
+			fmt.Println("Hints are only given in standard chess.")
+			return
+		}
+
+		if book == nil {
+			fmt.Println("No opening book to give hints from (use -book).")
+			return
+		}
+
+		m, ok := book.pickMove(g.position)
+		if !ok {
+			fmt.Println("No book moves for this position.")
+			return
 		}
 
-		board.movePiece(fromSquare, toSquare)
+		var moves []string
+		for _, bm := range book.getMoves(g.position) {
+			moves = append(moves, fmt.Sprintf("%s (%d)", getSAN(g.position, bm.move), bm.weight))
+		}
+		fmt.Printf("Hint: %s. Book moves by weight: %s\n", getSAN(g.position, m), strings.Join(moves, ", "))
+	case "analyze":
+		// Gives the tablebases' verdict on the position, and the best move.
+		if g.position.variant != standardChess {
+			fmt.Println("The tablebases are only for standard chess.")
+			return
+		}
 
-		if pawnIsPromoted(piece, toSquare) {
-			fmt.Printf("Promoted pawn. Promote to (Q, R, B, N)? ")
-			promoteInput, _ := reader.ReadString('\n')
-			board.addPieceAt(toSquare, strings.ToUpper(promoteInput[0:1]), color)
+		if e.tablebase == nil {
+			fmt.Println("No tablebases to analyze with (use -syzygy).")
+			return
 		}
 
-		board.print()
+		bp := newBitboardPosition(g.position)
+		wdl, ok := e.tablebase.probeWDL(&bp)
+		if !ok {
+			fmt.Println("The position isn't in the tablebases.")
+			return
+		}
+
+		fmt.Printf("Tablebases: %s", getWDLDescription(wdl, g.position.sideToMove))
+		if dtz, ok := e.tablebase.probeDTZ(&bp); ok {
+			fmt.Printf(" (DTZ %d)", dtz)
+		}
+		if m, _, ok := e.tablebase.getBestMove(&bp); ok {
+			fmt.Printf(". Best move: %s", getSAN(g.position, getMovesFromBBMoves(g.position, []bbMove{m})[0]))
+		}
+		fmt.Println()
+	}
+}
 
-		color = switchColor(color)
+// getWDLDescription describes a WDL result for the given side to move.
+func getWDLDescription(wdl int, color string) string {
+	switch wdl {
+	case tbWin:
+		return getColorName(color) + " wins"
+	case tbCursedWin:
+		return getColorName(color) + " wins, but the fifty-move rule draws"
+	case tbBlessedLoss:
+		return getColorName(switchColor(color)) + " wins, but the fifty-move rule draws"
+	case tbLoss:
+		return getColorName(switchColor(color)) + " wins"
 	}
+
+	return "draw"
 }
 
-func getSquareFromInput(entry string) (square, error) {
-	if utf8.RuneCountInString(entry) != 4 {
-		return square{}, errors.New("Entry not valid (must be 2 characters).")
+// getMoveFromInput reads a move for the side to move, written either in Standard Algebraic
+// Notation (e.g. Nf3, exd5, O-O, e8=Q, or for a crazyhouse drop, N@f3) or as the squares moved
+// from and to (e.g. e2e4, e7e8q).
+// If a pawn's move to the last rank is given without the piece it's promoted to (e.g. e8 or e7e8),
+// the move is returned with errNoPromotionPiece, so that the piece can be asked for separately.
+func getMoveFromInput(p position, entry string) (move, error) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" {
+		return move{}, errors.New("No move entered.")
+	}
+
+	if squares := strings.Replace(entry, "-", "", 1); len(squares) == 5 && isSquaresMoveInput(squares[0:4]) {
+		if _, err := parsePromotionPiece(squares[4:], p.variant); err != nil {
+			return move{}, err
+		}
+	}
+
+	if !isSquaresMoveInput(entry) {
+		// Piece letters are often typed in lower case, which is only ambiguous for bishops and
+		// the b-file, unless the piece is being dropped.
+		if strings.ContainsAny(entry[0:1], "kqrn") || len(entry) > 1 && entry[1] == '@' {
+			entry = strings.ToUpper(entry[0:1]) + entry[1:]
+		}
+
+		return resolveSANMove(p, entry)
+	}
+
+	entry = strings.Replace(entry, "-", "", 1)
+	fromSquare, _ := getSquareFromNotation(entry[0:2])
+	toSquare, _ := getSquareFromNotation(entry[2:4])
+	promotion := strings.ToUpper(entry[4:])
+
+	piece, err := p.board.getPieceAt(fromSquare)
+	if err != nil {
+		return move{}, fmt.Errorf("No piece found at %s.", getNotationForSquare(fromSquare))
 	}
 
-	// TODO: more validation
+	if piece.color != p.sideToMove {
+		return move{}, fmt.Errorf("Piece on %s isn't of the correct colour (%s).", getNotationForSquare(fromSquare), p.sideToMove)
+	}
+
+	if !isMoveLegal(p, fromSquare, toSquare) {
+		return move{}, fmt.Errorf("Not a legal move (the %s on %s can't move to %s).", getPieceDescription(piece.getName()), getNotationForSquare(fromSquare), getNotationForSquare(toSquare))
+	}
+
+	if promotion != "" && !pawnIsPromoted(piece, toSquare) {
+		return move{}, errors.New("Not a legal move (only a pawn reaching the last rank can be promoted).")
+	}
 
-	file := strings.ToUpper(entry[0:1])
-	rank, _ := strconv.Atoi(entry[1:2])
+	moves := generateLegalMoves(p)
+	for _, m := range moves {
+		if areSquaresEqual(m.fromSquare, fromSquare) && m.isWrittenTo(toSquare) &&
+			(m.promotion == promotion || promotion == "") {
+			if m.promotion != "" && promotion == "" {
+				m.promotion = ""
+				return m, errNoPromotionPiece
+			}
+			return m, nil
+		}
+	}
 
-	return square{file, rank}, nil
+	if p.isCaptureCompulsory(moves) {
+		return move{}, errors.New("Not a legal move (a capture can be made, so one must be).")
+	}
+
+	if wouldKingBeInCheck(p, newMove(p, fromSquare, toSquare)) {
+		return move{}, errors.New("Not a legal move (your king would be in check).")
+	}
+
+	return move{}, errors.New("Not a legal move.")
+}
+
+// isSquaresMoveInput returns whether input is a move given as the squares moved from and to, as
+// used by UCI, e.g. e2e4, or e7e8q for a promotion. A dash between the squares is allowed.
+func isSquaresMoveInput(entry string) bool {
+	entry = strings.ToLower(strings.Replace(entry, "-", "", 1))
+	if len(entry) != 4 && len(entry) != 5 {
+		return false
+	}
+
+	_, fromErr := getSquareFromNotation(entry[0:2])
+	_, toErr := getSquareFromNotation(entry[2:4])
+	return fromErr == nil && toErr == nil && (len(entry) == 4 || strings.ContainsAny(entry[4:], "qrbnk"))
 }
 
-func isMoveLegal(b board, p gamePiece, fromSquare square, toSquare square) bool {
-	legalSquares := p.getLegalSquares(b, fromSquare, p.color, p.moved)
+// isMoveLegal returns whether the piece on fromSquare can move to toSquare in the position,
+// without regard to whether it leaves its own king in check.
+func isMoveLegal(p position, fromSquare square, toSquare square) bool {
+	legalSquares := p.getLegalSquares(fromSquare)
 	for _, sq := range legalSquares {
 		if sq.rank == toSquare.rank && sq.file == toSquare.file {
 			return true
@@ -108,10 +576,24 @@ func isMoveLegal(b board, p gamePiece, fromSquare square, toSquare square) bool
 	return false
 }
 
-func wouldKingBeInCheck(b board, fromSquare square, toSquare square, color string) bool {
-	tempBoard := b
-	tempBoard.movePiece(fromSquare, toSquare)
-	kingInCheck, _ := tempBoard.isKingInCheck(color)
+// wouldKingBeInCheck returns whether making the move would leave the moving side's king in check.
+func wouldKingBeInCheck(p position, m move) bool {
+	kingSquare, _ := p.board.getSquareForPiece(m.piece.color, "K")
+	return wouldKingOnSquareBeInCheck(p, m, kingSquare)
+}
+
+// wouldKingOnSquareBeInCheck is wouldKingBeInCheck for when where the king is already known. A
+// side with no king, whose king square is no square, can't be left in check.
+func wouldKingOnSquareBeInCheck(p position, m move, kingSquare square) bool {
+	if m.piece.getName() == "K" {
+		kingSquare = m.toSquare
+	} else if isNoSquare(kingSquare) {
+		return false
+	}
+
+	tempBoard := p.board
+	tempBoard.playMove(m)
+	kingInCheck, _ := isSquareEnPrise(tempBoard, kingSquare, m.piece.color)
 	return kingInCheck
 }
 
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetMoveFromInput(t *testing.T) {
+	tests := []struct {
+		fen       string
+		input     string
+		from      string
+		to        string
+		promotion string
+	}{
+		{StartingFEN, "e4\n", "e2", "e4", ""},
+		{StartingFEN, "e2e4\n", "e2", "e4", ""},
+		{StartingFEN, "e2-e4\r\n", "e2", "e4", ""},
+		{StartingFEN, "Nf3", "g1", "f3", ""},
+		{StartingFEN, "nf3", "g1", "f3", ""},
+		{StartingFEN, "g1f3", "g1", "f3", ""},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", "exd5", "e4", "d5", ""},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O", "e1", "g1", ""},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1c1", "e1", "c1", ""},
+		{"4k3/8/8/8/4K3/8/8/R2r3R w - - 0 1", "Raxd1", "a1", "d1", ""},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8=Q+", "e7", "e8", "Q"},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8n", "e7", "e8", "N"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		m, err := getMoveFromInput(p, test.input)
+		if err != nil {
+			t.Errorf("Unexpected error reading move %q in %s: %s", test.input, test.fen, err)
+			continue
+		}
+
+		if getNotationForSquare(m.fromSquare) != test.from || getNotationForSquare(m.toSquare) != test.to || m.promotion != test.promotion {
+			t.Errorf("Expected move %q in %s to be %s%s%s, but got: %v", test.input, test.fen, test.from, test.to, test.promotion, m)
+		}
+	}
+}
+
+// A promotion without its piece, whether given as squares or in SAN, is returned without one, so
+// that it can be asked for or made a queen.
+func TestGetMoveFromInputWithoutPromotionPiece(t *testing.T) {
+	p, _ := parseFEN("5n1k/4P3/8/8/8/8/8/4K3 w - - 0 1")
+	tests := []struct {
+		input string
+		to    string
+	}{
+		{"e8", "e8"},
+		{"e7e8", "e8"},
+		{"e7-e8", "e8"},
+		{"exf8", "f8"},
+		{"e7f8", "f8"},
+	}
+
+	for _, test := range tests {
+		m, err := getMoveFromInput(p, test.input)
+		if err != errNoPromotionPiece || getNotationForSquare(m.fromSquare) != "e7" || getNotationForSquare(m.toSquare) != test.to || m.promotion != "" {
+			t.Errorf("Expected move %q to be e7%s without a promotion piece, but got: %v (%v)", test.input, test.to, m, err)
+		}
+	}
+}
+
+func TestGetMoveFromInputErrors(t *testing.T) {
+	tests := []struct {
+		fen      string
+		input    string
+		contains string
+	}{
+		{StartingFEN, "\n", "No move entered."},
+		{StartingFEN, "e5", "no white pawn can move to e5"},
+		{StartingFEN, "Bc4", "no white bishop can move to c4"},
+		{StartingFEN, "e3e4", "No piece found at e3."},
+		{StartingFEN, "e7e5", "Piece on e7 isn't of the correct colour (W)."},
+		{StartingFEN, "e2e5", "Not a legal move (the pawn on e2 can't move to e5)."},
+		{StartingFEN, "e2e4q", "only a pawn reaching the last rank can be promoted"},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8", "no promotion piece given"},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8", "no promotion piece given"},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7e8k", "Promotion piece 'k' not recognised (must be Q, R, B or N)."},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8=K", "can only promote to Q, R, B or N"},
+		{"4k3/8/8/8/4K3/8/8/R2r3R w - - 0 1", "Rxd1", "ambiguous"},
+		{"4k3/8/8/8/8/8/4r3/4K2N w - - 0 1", "h1g3", "your king would be in check"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		_, err := getMoveFromInput(p, test.input)
+		if err == nil {
+			t.Errorf("Expected error reading move %q in %s but got none", test.input, test.fen)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.contains) {
+			t.Errorf("Expected error reading move %q in %s to contain \"%s\", but got: %s", test.input, test.fen, test.contains, err)
+		}
+	}
+}
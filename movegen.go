@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var promotionPieceNames = []string{"Q", "R", "B", "N"}
+
+// errNoPromotionPiece is returned along with a pawn's move to the last rank when the piece it's
+// promoted to wasn't given, so that it can be asked for, or a queen chosen.
+var errNoPromotionPiece = errors.New("Not a legal move (no promotion piece given).")
+
+// parsePromotionPiece reads the piece a pawn is promoted to, given as its letter in either case,
+// e.g. q or N, or its name, e.g. queen. A pawn can only be promoted to a queen, rook, bishop or
+// knight, or in antichess, a king.
+func parsePromotionPiece(input string, v variant) (string, error) {
+	names := v.getPromotionPieceNames()
+	input = strings.TrimPrefix(strings.TrimSpace(input), "=")
+	if input == "" {
+		return "", fmt.Errorf("No promotion piece entered (must be %s).", listPieceNames(names))
+	}
+
+	for _, name := range names {
+		if strings.EqualFold(input, name) || strings.EqualFold(input, getPieceDescription(name)) {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("Promotion piece '%s' not recognised (must be %s).", input, listPieceNames(names))
+}
+
+type move struct {
+	fromSquare  square
+	toSquare    square
+	piece       gamePiece
+	promotion   string
+	captured    gamePiece
+	isCastling  bool
+	isEnPassant bool
+
+	// The square of the rook castled with, when castling.
+	rookSquare square
+
+	// Whether the piece is dropped from the mover's pocket in crazyhouse, rather than moved. A
+	// drop has no square it's moved from.
+	isDrop bool
+}
+
+// String returns the move in the long algebraic form used by UCI, e.g. e2e4 or e7e8q, or for a
+// drop, the piece and the square it's dropped on, e.g. N@f3.
+func (m move) String() string {
+	if m.isDrop {
+		return m.piece.getName() + "@" + getNotationForSquare(m.toSquare)
+	}
+
+	return getNotationForSquare(m.fromSquare) + getNotationForSquare(m.getNotationSquare()) + strings.ToLower(m.promotion)
+}
+
+// getNotationSquare returns the square the move is written as going to in long algebraic form.
+// That's the square moved to, except when castling in Chess960 doesn't move the king two files,
+// as it does in standard chess, when it's written as the king taking its own rook.
+func (m move) getNotationSquare() square {
+	if m.isCastling && abs(fromFileStr(m.toSquare.file)-fromFileStr(m.fromSquare.file)) != 2 {
+		return m.rookSquare
+	}
+
+	return m.toSquare
+}
+
+// isWrittenTo returns whether the move can be written in long algebraic form as going to the
+// square: the one getNotationSquare gives, or when castling, the rook's square.
+func (m move) isWrittenTo(sq square) bool {
+	return areSquaresEqual(m.getNotationSquare(), sq) || m.isCastling && areSquaresEqual(m.rookSquare, sq)
+}
+
+func (m move) isCapture() bool {
+	return m.captured != (gamePiece{})
+}
+
+// generateLegalMoves returns all the legal moves for the side to move in the position. Moves that
+// promote a pawn are returned once for each piece it can be promoted to. In crazyhouse, dropping
+// pieces from the side's pocket are moves too. Once a side has won, or the game is drawn, by a
+// variant's own rules, the game is over, so there are none.
+func generateLegalMoves(p position) []move {
+	if winner, _ := p.getVariantGoalWin(); winner != "" || p.getVariantDrawReason() != "" {
+		return nil
+	}
+
+	var moves []move
+	kingSquare, _ := p.board.getSquareForPiece(p.sideToMove, "K")
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if p.board.isRowColEmpty(i, j) || p.board[i][j].color != p.sideToMove {
+				continue
+			}
+
+			piece := p.board[i][j]
+			fromSquare := getSquareForRowCol(i, j)
+			for _, toSquare := range p.getLegalSquares(fromSquare) {
+				m := newMove(p, fromSquare, toSquare)
+				if !p.isLegal(m, kingSquare) {
+					continue
+				}
+
+				if pawnIsPromoted(piece, toSquare) {
+					for _, name := range p.variant.getPromotionPieceNames() {
+						m.promotion = name
+						moves = append(moves, m)
+					}
+					continue
+				}
+
+				moves = append(moves, m)
+			}
+		}
+	}
+
+	if p.variant == crazyhouse {
+		moves = append(moves, p.generateDrops(kingSquare)...)
+	}
+
+	if p.getTakingBehavior() == mustTake {
+		return getCapturesIfAny(moves)
+	}
+
+	return moves
+}
+
+// isLegal returns whether a move the piece can make by its movement is legal: that it doesn't
+// leave the mover's king, which is on kingSquare, in check, or in atomic, that it follows
+// atomic's rules. In antichess, there's no check, so any move is, and in Racing Kings, a move
+// can't give check either.
+func (p position) isLegal(m move, kingSquare square) bool {
+	switch p.variant {
+	case atomicChess:
+		return p.isAtomicMoveLegal(m)
+	case antichess:
+		return true
+	case racingKings:
+		return !wouldKingOnSquareBeInCheck(p, m, kingSquare) && !wouldGiveCheck(p, m)
+	}
+
+	return !wouldKingOnSquareBeInCheck(p, m, kingSquare)
+}
+
+// getLegalSquares returns the squares the piece on sq can move to in the position: those it can
+// move to by its normal movement, and for the side to move, by castling or taking en passant. As
+// for a piece's legal squares, moves that would leave its own king in check are included.
+func (p position) getLegalSquares(sq square) []square {
+	gp, err := p.board.getPieceAt(sq)
+	if err != nil {
+		return nil
+	}
+
+	squares := gp.getLegalSquares(p.board, sq, gp.color)
+	if gp.color != p.sideToMove {
+		return squares
+	}
+
+	switch gp.getName() {
+	case "P":
+		if !isNoSquare(p.enPassantSquare) && isSquareAttackedBy(p.board, gp, sq, p.enPassantSquare) {
+			squares = append(squares, p.enPassantSquare)
+		}
+	case "K":
+		for _, right := range getCastlingRights(gp.color) {
+			if p.canCastle(sq, right) {
+				squares = append(squares, p.getCastlingMove(sq, right).getNotationSquare())
+			}
+		}
+	}
+
+	return squares
+}
+
+// canCastle returns whether the side to move can castle with the given right, by its number as
+// for castlingRights.get.
+func (p position) canCastle(kingSquare square, right int) bool {
+	color := p.sideToMove
+	if !*p.castlingRights.get(right) {
+		return false
+	}
+
+	// Must have a rook to castle with. A castling right from FEN says there is one, but a
+	// position set up by hand may not.
+	m := p.getCastlingMove(kingSquare, right)
+	rookSquares := getCastledRookSquares(m)
+	if !hasPiece(p.board, rookSquares[0], "R", color) {
+		return false
+	}
+
+	// Can't be any blocking pieces on the squares the king and rook move across, other than the
+	// king and rook themselves, which in Chess960 may be in each other's way.
+	for _, path := range [][2]square{{kingSquare, m.toSquare}, rookSquares} {
+		for _, sq := range getSquaresOnRankFromTo(path[0], path[1]) {
+			if !p.board.isSquareEmpty(sq) && !areSquaresEqual(sq, kingSquare) && !areSquaresEqual(sq, rookSquares[0]) {
+				return false
+			}
+		}
+	}
+
+	// Can't castle out of, through or into check, so none of the squares the king moves across
+	// can be attacked. The rook may pass over an attacked square, as it can on the queenside. In
+	// atomic, a king is safe next to the other king.
+	otherKingSquare, _ := p.board.getSquareForPiece(switchColor(color), "K")
+	for _, sq := range getSquaresOnRankFromTo(kingSquare, m.toSquare) {
+		isSquareEnPrise, _ := isSquareEnPrise(p.board, sq, color)
+		if isSquareEnPrise && !(p.variant == atomicChess && areSquaresAdjacent(sq, otherKingSquare)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getCastlingMove returns the move of the king on kingSquare castling with the given right. The
+// king ends up on the g-file castling kingside, and the c-file castling queenside.
+func (p position) getCastlingMove(kingSquare square, right int) move {
+	m := move{fromSquare: kingSquare, toSquare: square{file: "G", rank: kingSquare.rank}, isCastling: true}
+	if right%2 == 1 {
+		m.toSquare.file = "C"
+	}
+	m.piece, _ = p.board.getPieceAt(kingSquare)
+	m.rookSquare = p.getCastlingRookSquare(right)
+	return m
+}
+
+// getSquaresOnRankFromTo returns the squares on a rank from one square to another, including both.
+func getSquaresOnRankFromTo(from square, to square) []square {
+	fromCol, toCol := fromFileStr(from.file), fromFileStr(to.file)
+	if fromCol > toCol {
+		fromCol, toCol = toCol, fromCol
+	}
+
+	var squares []square
+	for col := fromCol; col <= toCol; col++ {
+		squares = append(squares, square{file: toFileStr(col), rank: from.rank})
+	}
+
+	return squares
+}
+
+// newMove describes moving the piece on fromSquare to toSquare in the position, without a
+// promotion. A king moving two files to the g- or c-file with the right to castle that way, or
+// taking its own rook, as castling is written in Chess960, is castling.
+func newMove(p position, fromSquare square, toSquare square) move {
+	piece, _ := p.board.getPieceAt(fromSquare)
+	_, fromCol := getRowColForSquare(fromSquare)
+	_, toCol := getRowColForSquare(toSquare)
+
+	if piece.getName() == "K" {
+		for _, right := range getCastlingRights(piece.color) {
+			m := p.getCastlingMove(fromSquare, right)
+			if *p.castlingRights.get(right) && (areSquaresEqual(toSquare, m.rookSquare) ||
+				areSquaresEqual(toSquare, m.toSquare) && abs(toCol-fromCol) == 2) {
+				return m
+			}
+		}
+	}
+
+	m := move{fromSquare: fromSquare, toSquare: toSquare, piece: piece}
+	m.captured, _ = p.board.getPieceAt(toSquare)
+	m.isEnPassant = piece.getName() == "P" && fromCol != toCol && areSquaresEqual(toSquare, p.enPassantSquare)
+	if m.isEnPassant {
+		m.captured, _ = p.board.getPieceAt(square{file: toSquare.file, rank: fromSquare.rank})
+	}
+
+	return m
+}
+
+func (p position) isKingInCheck() bool {
+	switch p.variant {
+	case atomicChess:
+		return p.board.isKingInAtomicCheck(p.sideToMove)
+	case antichess:
+		return false
+	}
+
+	kingInCheck, _ := p.board.isKingInCheck(p.sideToMove)
+	return kingInCheck
+}
+
+func (p position) isCheckMate() bool {
+	return p.isKingInCheck() && len(generateLegalMoves(p)) == 0
+}
+
+func (p position) isStalemate() bool {
+	return !p.isKingInCheck() && len(generateLegalMoves(p)) == 0
+}
+
+// findLegalMove returns the legal move in the position from and to the given squares, with the
+// given promotion. Castling can be given as the king taking its own rook.
+func findLegalMove(p position, fromSquare square, toSquare square, promotion string) (move, error) {
+	for _, m := range generateLegalMoves(p) {
+		if areSquaresEqual(m.fromSquare, fromSquare) && m.isWrittenTo(toSquare) && m.promotion == promotion {
+			return m, nil
+		}
+	}
+
+	return move{}, fmt.Errorf("Not a legal move (%s%s%s).", getNotationForSquare(fromSquare), getNotationForSquare(toSquare), strings.ToLower(promotion))
+}
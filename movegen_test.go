@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGenerateLegalMoves(t *testing.T) {
+	tests := []struct {
+		fen           string
+		expectedCount int
+		description   string
+	}{
+		{StartingFEN, 20, "starting position"},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 20, "black reply to e4"},
+		{"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", 26, "white can castle both sides"},
+		{"4k3/8/8/8/8/8/8/R3K2R w - - 0 1", 24, "white has lost its castling rights"},
+		{"4k3/8/8/8/8/8/4r3/4K3 w - - 0 1", 3, "king in check must escape"},
+		{"4k3/8/8/8/8/8/8/2R1K2r w - - 0 1", 3, "king in check along the rank can't stay on it"},
+		{"4k3/4r3/8/8/8/8/4B3/4K3 w - - 0 1", 4, "pinned bishop can't move"},
+		{"k7/3P4/8/8/8/8/8/4K3 w - - 0 1", 9, "pawn promotes to four pieces"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", 7, "pawn can take en passant"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - - 0 1", 6, "pawn can't take en passant without the target square"},
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", 0, "stalemate"},
+	}
+
+	for _, test := range tests {
+		p, err := parseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		res := generateLegalMoves(p)
+		if len(res) != test.expectedCount {
+			t.Errorf("Expected %d legal moves for %s, but got: %d (%v)", test.expectedCount, test.description, len(res), res)
+		}
+	}
+}
+
+func TestGenerateLegalMovesDetails(t *testing.T) {
+	p, _ := parseFEN("r3k3/1P6/8/3pP3/8/8/8/R3K2R w KQq d6 0 1")
+	moves := map[string]move{}
+	for _, m := range generateLegalMoves(p) {
+		moves[m.String()] = m
+	}
+
+	m := moves["e1g1"]
+	if !m.isCastling || m.isCapture() || m.piece.getName() != "K" {
+		t.Errorf("Expected e1g1 to be castling, but got: %+v", m)
+	}
+
+	m = moves["e5d6"]
+	if !m.isEnPassant || m.captured.getName() != "P" || m.captured.color != "B" {
+		t.Errorf("Expected e5d6 to take a black pawn en passant, but got: %+v", m)
+	}
+
+	m = moves["b7a8n"]
+	if m.promotion != "N" || m.captured.getName() != "R" {
+		t.Errorf("Expected b7a8n to take a rook and promote to a knight, but got: %+v", m)
+	}
+
+	m = moves["a1a8"]
+	if m.isCastling || m.captured.getName() != "R" {
+		t.Errorf("Expected a1a8 to take a rook, but got: %+v", m)
+	}
+
+	if _, ok := moves["b7b8"]; ok {
+		t.Errorf("Expected pawn move to last rank to always include a promotion piece")
+	}
+}
+
+func TestParsePromotionPiece(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Q", "Q"},
+		{"n\n", "N"},
+		{"=R", "R"},
+		{"Bishop", "B"},
+		{"knight", "N"},
+		{"", ""},
+		{"K", ""},
+		{"P", ""},
+		{"queen please", ""},
+	}
+
+	for _, test := range tests {
+		res, err := parsePromotionPiece(test.input, standardChess)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("Expected an error reading promotion piece %q, but got: %s", test.input, res)
+			}
+			continue
+		}
+
+		if err != nil || res != test.expected {
+			t.Errorf("Expected promotion piece %q to be %s, but got: %s (%v)", test.input, test.expected, res, err)
+		}
+	}
+}
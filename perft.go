@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type perftDivision struct {
+	move  fmt.Stringer
+	nodes int
+}
+
+// perft counts the leaf nodes of the tree of legal moves from the position, to the given depth.
+// Comparing the counts with known ones is the standard way of testing move generation. The moves
+// are generated on bitboards, which the tests check against generateLegalMoves, except in variants,
+// whose rules only generateLegalMoves knows.
+func perft(p position, depth int) int {
+	if p.variant != standardChess {
+		return perftPosition(p, depth)
+	}
+
+	bp := newBitboardPosition(p)
+	return bp.perft(depth)
+}
+
+// perftPosition is perft using generateLegalMoves and position's makeMove, as perft was before
+// moves were generated on bitboards. It's used for variants, and for checking the two against
+// each other.
+func perftPosition(p position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+
+	moves := generateLegalMoves(p)
+	if depth == 1 {
+		return len(moves)
+	}
+
+	nodes := 0
+	for _, m := range moves {
+		u := p.makeMove(m)
+		nodes += perftPosition(p, depth-1)
+		p.unmakeMove(m, u)
+	}
+
+	return nodes
+}
+
+func (bp *bitboardPosition) perft(depth int) int {
+	if depth == 0 {
+		return 1
+	}
+
+	var buffer [maxMoves]bbMove
+	moves := bp.generateMoves(buffer[:0])
+	if depth == 1 {
+		return len(moves)
+	}
+
+	nodes := 0
+	for _, m := range moves {
+		u := bp.makeMove(m)
+		nodes += bp.perft(depth - 1)
+		bp.unmakeMove(m, u)
+	}
+
+	return nodes
+}
+
+// divide breaks down the perft count by the move played from the position, which helps to track
+// down which moves a count that doesn't match a known one comes from.
+func divide(p position, depth int) []perftDivision {
+	var divisions []perftDivision
+	if p.variant != standardChess {
+		for _, m := range generateLegalMoves(p) {
+			u := p.makeMove(m)
+			divisions = append(divisions, perftDivision{move: m, nodes: perftPosition(p, depth-1)})
+			p.unmakeMove(m, u)
+		}
+	} else {
+		bp := newBitboardPosition(p)
+		for _, m := range bp.generateMoves(nil) {
+			u := bp.makeMove(m)
+			divisions = append(divisions, perftDivision{move: m, nodes: bp.perft(depth - 1)})
+			bp.unmakeMove(m, u)
+		}
+	}
+
+	sort.Slice(divisions, func(i, j int) bool {
+		return divisions[i].move.String() < divisions[j].move.String()
+	})
+
+	return divisions
+}
+
+// runPerft prints the perft count for the position, broken down by move if showDivide is set.
+func runPerft(p position, depth int, showDivide bool) {
+	start := time.Now()
+	nodes := 0
+	if showDivide {
+		for _, d := range divide(p, depth) {
+			fmt.Printf("%s: %d\n", d.move, d.nodes)
+			nodes += d.nodes
+		}
+		fmt.Println()
+	} else {
+		nodes = perft(p, depth)
+	}
+
+	elapsed := time.Since(start)
+	fmt.Printf("Nodes: %d\n", nodes)
+	fmt.Printf("Time: %v (%.0f nodes/s)\n", elapsed.Round(time.Millisecond), float64(nodes)/elapsed.Seconds())
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+)
+
+// Positions and node counts from https://www.chessprogramming.org/Perft_Results
+var perftTests = []struct {
+	name   string
+	fen    string
+	counts []int
+}{
+	{"Starting position", StartingFEN, []int{20, 400, 8902, 197281}},
+	{"Kiwipete", "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", []int{48, 2039, 97862}},
+	{"Position 3", "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1", []int{14, 191, 2812, 43238}},
+	{"Position 4", "r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1", []int{6, 264, 9467}},
+	{"Position 4 mirrored", "r2q1rk1/pP1p2pp/Q4n2/bbp1p3/Np6/1B3NBn/pPPP1PPP/R3K2R b KQ - 0 1", []int{6, 264, 9467}},
+	{"Position 5", "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8", []int{44, 1486, 62379}},
+	{"Position 6", "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10", []int{46, 2079, 89890}},
+
+	// Chess960 positions, from https://www.chessprogramming.org/Chess960_Perft_Results
+	{"Chess960 position 1", "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9", []int{21, 528, 12189, 326672}},
+	{"Chess960 position 3", "b1q1rrkb/pppppppp/3nn3/8/P7/1PPP4/4PPPP/BQNNRKRB w GE - 1 9", []int{20, 479, 10471, 273318}},
+	{"Chess960 position 4", "qbbnnrkr/2pp2pp/p7/1p2pp2/8/P3PP2/1PPP1KPP/QBBNNR1R w hf - 0 9", []int{22, 593, 13440, 382958}},
+}
+
+// Counts over this are only checked when tests aren't run with -short.
+const perftShortMaxNodes = 50000
+
+func TestPerft(t *testing.T) {
+	for _, test := range perftTests {
+		p, err := parseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		for i, expected := range test.counts {
+			if testing.Short() && expected > perftShortMaxNodes {
+				continue
+			}
+
+			depth := i + 1
+			res := perft(p, depth)
+			if res != expected {
+				t.Errorf("Expected perft(%d) for %s to be %d, but got: %d", depth, test.name, expected, res)
+			}
+		}
+	}
+}
+
+func TestPerftMatchesPosition(t *testing.T) {
+	depth := 3
+	if testing.Short() {
+		depth = 2
+	}
+
+	for _, test := range perftTests {
+		p, _ := parseFEN(test.fen)
+		for _, d := range divide(p, depth) {
+			m, err := getUCIMove(p, d.move.String())
+			if err != nil {
+				t.Fatalf("Unexpected error finding %s in %s: %s", d.move, test.name, err)
+			}
+
+			u := p.makeMove(m)
+			if expected := perftPosition(p, depth-1); d.nodes != expected {
+				t.Errorf("Expected perft(%d) after %s in %s to be %d, but got: %d", depth-1, d.move, test.name, expected, d.nodes)
+			}
+			p.unmakeMove(m, u)
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	p, _ := parseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	res := divide(p, 2)
+
+	expectedCount := 48
+	if len(res) != expectedCount {
+		t.Fatalf("Expected divide to give %d moves, but got: %d", expectedCount, len(res))
+	}
+
+	// Some published counts from Kiwipete's breakdown.
+	expected := map[string]int{"e1g1": 43, "e1c1": 43, "e5f7": 44, "d5e6": 46, "f3f6": 39, "a2a4": 44}
+	total := 0
+	for _, d := range res {
+		total += d.nodes
+		if nodes, ok := expected[d.move.String()]; ok && nodes != d.nodes {
+			t.Errorf("Expected divide count for %s to be %d, but got: %d", d.move, nodes, d.nodes)
+		}
+	}
+
+	expectedCount = 2039
+	if total != expectedCount {
+		t.Errorf("Expected divide counts to total %d, but got: %d", expectedCount, total)
+	}
+}
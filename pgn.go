@@ -0,0 +1,465 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const pgnLineLength = 80
+
+// The Seven Tag Roster, in the order the PGN standard requires them to be exported.
+var sevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+type pgnGame struct {
+	// number is the game's place in the PGN file it was read from, counting games skipped for
+	// errors.
+	number        int
+	tags          map[string]string
+	startPosition position
+	moves         []pgnMove
+	result        string
+}
+
+type pgnMove struct {
+	san  string
+	move move
+}
+
+func newPGNGame(startPosition position) pgnGame {
+	g := pgnGame{
+		tags: map[string]string{
+			"Event": "Casual game",
+			"Site":  "?",
+			"Date":  time.Now().Format("2006.01.02"),
+			"Round": "-",
+			"White": "?",
+			"Black": "?",
+		},
+		startPosition: startPosition,
+		result:        "*",
+	}
+
+	// Games that don't start from the standard position, or their variant's, record where they
+	// did start.
+	if fen := startPosition.toFEN(); fen != newVariantPosition(startPosition.variant).toFEN() {
+		g.tags["SetUp"] = "1"
+		g.tags["FEN"] = fen
+	}
+	if startPosition.variant != standardChess {
+		g.tags["Variant"] = startPosition.variant.String()
+	} else if startPosition.chess960 {
+		g.tags["Variant"] = "Chess960"
+	}
+
+	return g
+}
+
+func (g *pgnGame) addMove(m pgnMove) {
+	g.moves = append(g.moves, m)
+}
+
+// setResult records how the game ended, as one of "1-0", "0-1", "1/2-1/2" or "*" (unfinished).
+func (g *pgnGame) setResult(result string) {
+	g.result = result
+}
+
+func getResultForWinner(color string) string {
+	if color == "W" {
+		return "1-0"
+	}
+
+	return "0-1"
+}
+
+// String returns the game in PGN export format.
+func (g pgnGame) String() string {
+	var sb strings.Builder
+
+	for _, name := range sevenTagRoster {
+		value := g.tags[name]
+		if name == "Result" {
+			value = g.result
+		} else if value == "" {
+			value = "?"
+		}
+		writePGNTag(&sb, name, value)
+	}
+
+	var otherNames []string
+	for name := range g.tags {
+		if !isSevenTagRosterTag(name) {
+			otherNames = append(otherNames, name)
+		}
+	}
+	sort.Strings(otherNames)
+	for _, name := range otherNames {
+		writePGNTag(&sb, name, g.tags[name])
+	}
+
+	sb.WriteString("\n")
+
+	// Movetext is a sequence of tokens, wrapped so no line goes over the maximum length.
+	var tokens []string
+	moveNumber := g.startPosition.fullmoveNumber
+	color := g.startPosition.sideToMove
+	for i, m := range g.moves {
+		if color == "W" {
+			tokens = append(tokens, fmt.Sprintf("%d.", moveNumber))
+		} else if i == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d...", moveNumber))
+		}
+
+		tokens = append(tokens, m.san)
+
+		if color == "B" {
+			moveNumber++
+		}
+		color = switchColor(color)
+	}
+	tokens = append(tokens, g.result)
+
+	lineLength := 0
+	for _, token := range tokens {
+		if lineLength > 0 && lineLength+1+len(token) >= pgnLineLength {
+			sb.WriteString("\n")
+			lineLength = 0
+		}
+
+		if lineLength > 0 {
+			sb.WriteString(" ")
+			lineLength++
+		}
+
+		sb.WriteString(token)
+		lineLength += len(token)
+	}
+
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func writePGNTag(sb *strings.Builder, name string, value string) {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	sb.WriteString(fmt.Sprintf("[%s \"%s\"]\n", name, value))
+}
+
+func isSevenTagRosterTag(name string) bool {
+	for _, n := range sevenTagRoster {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g pgnGame) writeToFile(path string) error {
+	return os.WriteFile(path, []byte(g.String()), 0644)
+}
+
+type pgnTokenKind int
+
+const (
+	pgnTagToken pgnTokenKind = iota
+	pgnSymbolToken
+	pgnNAGToken
+	pgnResultToken
+	pgnOpenVariationToken
+	pgnCloseVariationToken
+)
+
+type pgnToken struct {
+	kind  pgnTokenKind
+	value string
+	name  string
+	line  int
+}
+
+// readPGNFile reads all the games from a PGN file.
+func readPGNFile(path string) ([]pgnGame, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePGN(string(data))
+}
+
+// parsePGN reads all the games from PGN text. Comments, NAGs and variations are read but
+// discarded, and each move of the main line is checked for legality as it's played. A game with an
+// error is skipped up to the next Event tag, and the errors of all the games skipped are returned
+// along with the games read.
+func parsePGN(text string) ([]pgnGame, error) {
+	tokens, err := tokenizePGN(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var games []pgnGame
+	var errs []error
+	var r *pgnGameReader
+	gameNumber := 0
+	skipping := false
+	for _, token := range tokens {
+		if skipping {
+			if token.kind != pgnTagToken || token.name != "Event" {
+				continue
+			}
+			skipping = false
+		}
+
+		if r == nil {
+			gameNumber++
+			r = newPGNGameReader(gameNumber)
+		}
+
+		var err error
+		switch token.kind {
+		case pgnTagToken:
+			// Tags after movetext belong to the next game, so the current one ended without a result.
+			if r.inMovetext {
+				games = append(games, r.game)
+				gameNumber++
+				r = newPGNGameReader(gameNumber)
+			}
+			r.game.tags[token.name] = token.value
+		case pgnOpenVariationToken:
+			r.variationDepth++
+		case pgnCloseVariationToken:
+			if r.variationDepth == 0 {
+				err = fmt.Errorf("Game %d: unexpected ')' on line %d.", r.gameNumber, token.line)
+				break
+			}
+			r.variationDepth--
+		case pgnNAGToken:
+			continue
+		case pgnResultToken:
+			if r.variationDepth > 0 {
+				err = fmt.Errorf("Game %d: unterminated variation before result on line %d.", r.gameNumber, token.line)
+				break
+			}
+			if err = r.start(); err != nil {
+				break
+			}
+			r.game.result = token.value
+			games = append(games, r.game)
+			r = nil
+		case pgnSymbolToken:
+			if r.variationDepth > 0 {
+				continue
+			}
+			err = r.addMove(token)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+			r = nil
+			skipping = true
+		}
+	}
+
+	if r != nil {
+		if err := r.start(); err != nil {
+			errs = append(errs, err)
+		} else {
+			games = append(games, r.game)
+		}
+	}
+
+	return games, errors.Join(errs...)
+}
+
+type pgnGameReader struct {
+	game           pgnGame
+	gameNumber     int
+	inMovetext     bool
+	variationDepth int
+	position       position
+}
+
+func newPGNGameReader(gameNumber int) *pgnGameReader {
+	return &pgnGameReader{
+		game:       pgnGame{tags: map[string]string{}, result: "*", number: gameNumber},
+		gameNumber: gameNumber,
+	}
+}
+
+// start sets up the position the game's moves are played from, once all its tags are read.
+func (r *pgnGameReader) start() error {
+	if r.inMovetext {
+		return nil
+	}
+
+	r.inMovetext = true
+	// "From Position" isn't a variant: some programs write it with a FEN tag to mean standard
+	// chess from that position.
+	v := standardChess
+	if name, ok := r.game.tags["Variant"]; ok && !strings.EqualFold(name, "Chess960") && !strings.EqualFold(name, "From Position") {
+		var err error
+		if v, err = parseVariant(name); err != nil {
+			return fmt.Errorf("Game %d: %s", r.gameNumber, err)
+		}
+	}
+
+	r.game.startPosition = newVariantPosition(v)
+	if fen, ok := r.game.tags["FEN"]; ok {
+		p, err := parseVariantFEN(fen, v)
+		if err != nil {
+			return fmt.Errorf("Game %d: %s", r.gameNumber, err)
+		}
+		r.game.startPosition = p
+	}
+	if strings.EqualFold(r.game.tags["Variant"], "Chess960") {
+		r.game.startPosition.chess960 = true
+	}
+
+	r.position = r.game.startPosition
+	return nil
+}
+
+func (r *pgnGameReader) addMove(token pgnToken) error {
+	if err := r.start(); err != nil {
+		return err
+	}
+
+	// Move numbers may be separate tokens or joined to the move, e.g. "1." "e4" or "1.e4". Digits
+	// are only a move number when a '.' follows, or they're all there is, as castling may be
+	// written with zeros, e.g. 0-0.
+	san := token.value
+	if rest := strings.TrimLeft(san, "0123456789"); len(rest) < len(san) && (rest == "" || rest[0] == '.') {
+		san = strings.TrimLeft(rest, ".")
+	}
+	if san == "" {
+		return nil
+	}
+
+	ply := len(r.game.moves) + 1
+	m, err := resolveSAN(r.position, san)
+	if err != nil {
+		return fmt.Errorf("Game %d, ply %d (line %d): %s", r.gameNumber, ply, token.line, err)
+	}
+
+	r.game.addMove(pgnMove{san: getSAN(r.position, m), move: m})
+	r.position.makeMove(m)
+	return nil
+}
+
+func tokenizePGN(text string) ([]pgnToken, error) {
+	var tokens []pgnToken
+	runes := []rune(text)
+	line := 1
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\n':
+			line++
+		case unicode.IsSpace(c):
+			continue
+		case c == ';' || (c == '%' && (i == 0 || runes[i-1] == '\n')):
+			// Rest of line comment, or escaped line.
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case c == '{':
+			startLine := line
+			for i++; i < len(runes) && runes[i] != '}'; i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("Unterminated comment starting on line %d.", startLine)
+			}
+		case c == '[':
+			token, end, err := readPGNTag(runes, i, line)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i = end
+		case c == '(':
+			tokens = append(tokens, pgnToken{kind: pgnOpenVariationToken, line: line})
+		case c == ')':
+			tokens = append(tokens, pgnToken{kind: pgnCloseVariationToken, line: line})
+		default:
+			start := i
+			for i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && !strings.ContainsRune("{}[]();", runes[i+1]) {
+				i++
+			}
+			value := string(runes[start : i+1])
+			kind := pgnSymbolToken
+			if c == '$' {
+				kind = pgnNAGToken
+			} else if value == "1-0" || value == "0-1" || value == "1/2-1/2" || value == "*" {
+				kind = pgnResultToken
+			}
+			tokens = append(tokens, pgnToken{kind: kind, value: value, line: line})
+		}
+	}
+
+	return tokens, nil
+}
+
+// readPGNTag reads a tag pair such as [Event "F/S Return Match"] starting at the opening bracket,
+// returning the token and the index of the closing bracket.
+func readPGNTag(runes []rune, start int, line int) (pgnToken, int, error) {
+	i := start + 1
+	skipSpaces := func() {
+		for i < len(runes) && runes[i] != '\n' && unicode.IsSpace(runes[i]) {
+			i++
+		}
+	}
+
+	skipSpaces()
+	nameStart := i
+	for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+		i++
+	}
+	name := string(runes[nameStart:i])
+	if name == "" {
+		return pgnToken{}, i, fmt.Errorf("Tag on line %d has no name.", line)
+	}
+
+	skipSpaces()
+	if i >= len(runes) || runes[i] != '"' {
+		return pgnToken{}, i, fmt.Errorf("Tag %s on line %d has no quoted value.", name, line)
+	}
+
+	var value strings.Builder
+	for i++; i < len(runes) && runes[i] != '"'; i++ {
+		if runes[i] == '\\' && i+1 < len(runes) {
+			i++
+		}
+		if runes[i] == '\n' {
+			return pgnToken{}, i, fmt.Errorf("Tag %s on line %d has an unterminated value.", name, line)
+		}
+		value.WriteRune(runes[i])
+	}
+	if i >= len(runes) {
+		return pgnToken{}, i, fmt.Errorf("Tag %s on line %d has an unterminated value.", name, line)
+	}
+
+	i++
+	skipSpaces()
+	if i >= len(runes) || runes[i] != ']' {
+		return pgnToken{}, i, fmt.Errorf("Tag %s on line %d is missing a closing ']'.", name, line)
+	}
+
+	return pgnToken{kind: pgnTagToken, name: name, value: value.String(), line: line}, i, nil
+}
+
+// getPositionAfter returns the position after the first n moves of the game have been played.
+func (g pgnGame) getPositionAfter(n int) position {
+	p := g.startPosition
+	for _, m := range g.moves[:n] {
+		p.makeMove(m.move)
+	}
+
+	return p
+}
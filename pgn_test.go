@@ -0,0 +1,255 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPGNGameString(t *testing.T) {
+	g := newPGNGame(newPosition())
+	g.tags["Date"] = "2024.01.02"
+	g.tags["White"] = `Andy "The Rook" Butland`
+	for _, san := range []string{"e4", "e5", "Bc4", "Nc6", "Qh5", "Nf6", "Qxf7#"} {
+		g.addMove(pgnMove{san: san})
+	}
+	g.setResult("1-0")
+
+	expected := `[Event "Casual game"]
+[Site "?"]
+[Date "2024.01.02"]
+[Round "-"]
+[White "Andy \"The Rook\" Butland"]
+[Black "?"]
+[Result "1-0"]
+
+1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0
+`
+	if g.String() != expected {
+		t.Errorf("Expected PGN:\n%s\nbut got:\n%s", expected, g.String())
+	}
+}
+
+func TestPGNGameStringFromPosition(t *testing.T) {
+	fen := "4k3/8/8/8/8/8/4P3/4K3 b - - 0 40"
+	p, _ := parseFEN(fen)
+	g := newPGNGame(p)
+	g.addMove(pgnMove{san: "Kd7"})
+	g.addMove(pgnMove{san: "e4"})
+	g.setResult("1/2-1/2")
+
+	res := g.String()
+	if !strings.Contains(res, "[SetUp \"1\"]\n") || !strings.Contains(res, "[FEN \""+fen+"\"]\n") {
+		t.Errorf("Expected PGN to include SetUp and FEN tags, but got:\n%s", res)
+	}
+
+	if !strings.HasSuffix(res, "\n40... Kd7 41. e4 1/2-1/2\n") {
+		t.Errorf("Expected PGN movetext to start with black's move number, but got:\n%s", res)
+	}
+}
+
+func TestPGNGameStringWrapsLines(t *testing.T) {
+	g := newPGNGame(newPosition())
+	for i := 0; i < 40; i++ {
+		g.addMove(pgnMove{san: "Nf3"})
+		g.addMove(pgnMove{san: "Nf6"})
+		g.addMove(pgnMove{san: "Ng1"})
+		g.addMove(pgnMove{san: "Ng8"})
+	}
+
+	movetext := strings.SplitN(g.String(), "\n\n", 2)[1]
+	for _, line := range strings.Split(strings.TrimSpace(movetext), "\n") {
+		if len(line) >= pgnLineLength {
+			t.Errorf("Expected PGN movetext lines to be less than %d characters, but got: %s", pgnLineLength, line)
+		}
+	}
+}
+
+const operaGamePGN = `[Event "Paris"]
+[Site "Paris FRA"]
+[Date "1858.??.??"]
+[Round "?"]
+[White "Paul Morphy"]
+[Black "Duke Karl / Count Isouard"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 d6 3. d4 Bg4 {This is a weak move already.} 4. dxe5 Bxf3 5. Qxf3
+dxe5 6. Bc4 Nf6 7. Qb3 Qe7 8. Nc3 c6 9. Bg5 b5 $6 (9... Qb4+ 10. Qxb4 (10. Kf1)
+10... Nxb4) 10. Nxb5! cxb5 11. Bxb5+ Nbd7 12. O-O-O Rd8 13. Rxd7 Rxd7 14. Rd1 Qe6
+15. Bxd7+ Nxd7 16. Qb8+ ; the queen sacrifice
+Nxb8 17. Rd8# 1-0
+`
+
+func TestParsePGN(t *testing.T) {
+	pgn := operaGamePGN + `
+% An escaped line, ignored.
+[Event "Promotion"]
+[SetUp "1"]
+[FEN "8/4P1k1/8/8/8/8/8/4K3 w - - 0 60"]
+
+60.e8=N+ Kf7 61. Nd6+ *
+
+[Event "No result"]
+
+1. d4 d5
+`
+	games, err := parsePGN(pgn)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing PGN: %s", err)
+	}
+
+	expectedCount := 3
+	if len(games) != expectedCount {
+		t.Fatalf("Expected %d games, but got: %d", expectedCount, len(games))
+	}
+
+	g := games[0]
+	if g.tags["White"] != "Paul Morphy" || g.tags["Black"] != "Duke Karl / Count Isouard" || g.result != "1-0" {
+		t.Errorf("Unexpected tags or result read for first game: %v %s", g.tags, g.result)
+	}
+
+	expectedCount = 33
+	if len(g.moves) != expectedCount {
+		t.Errorf("Expected first game to have %d moves, but got: %d", expectedCount, len(g.moves))
+	}
+
+	expectedMoves := map[int]string{20: "Bxb5+", 21: "Nbd7", 22: "O-O-O", 32: "Rd8#"}
+	for i, san := range expectedMoves {
+		if g.moves[i].san != san {
+			t.Errorf("Expected move %d to be %s, but got: %s", i+1, san, g.moves[i].san)
+		}
+	}
+
+	if !g.getPositionAfter(len(g.moves)).isCheckMate() {
+		t.Errorf("Expected black to be in check-mate at the end of the first game")
+	}
+
+	// Exporting the game again gives the same moves.
+	reparsed, err := parsePGN(g.String())
+	if err != nil || len(reparsed) != 1 || reparsed[0].String() != g.String() {
+		t.Errorf("Expected exported game to parse to the same game, but got error: %v", err)
+	}
+
+	g = games[1]
+	if g.startPosition.fullmoveNumber != 60 || len(g.moves) != 3 || g.moves[0].move.promotion != "N" || g.result != "*" {
+		t.Errorf("Unexpected start position or moves for second game: %+v", g)
+	}
+
+	if !strings.Contains(g.String(), "60. e8=N+ Kf7 61. Nd6+ *") {
+		t.Errorf("Unexpected movetext exported for second game:\n%s", g.String())
+	}
+
+	g = games[2]
+	if g.tags["Event"] != "No result" || len(g.moves) != 2 || g.result != "*" {
+		t.Errorf("Unexpected tags or moves for third game: %+v", g)
+	}
+}
+
+func TestParsePGNFromPosition(t *testing.T) {
+	pgn := `[Event "From position"]
+[Variant "From Position"]
+[FEN "8/4P1k1/8/8/8/8/8/4K3 w - - 0 60"]
+
+60. e8=Q Kf6 *
+`
+	games, err := parsePGN(pgn)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing PGN: %s", err)
+	}
+
+	g := games[0]
+	if g.startPosition.variant != standardChess || g.startPosition.fullmoveNumber != 60 || len(g.moves) != 2 {
+		t.Errorf("Expected the game to be standard chess from the FEN tag's position, but got: %+v", g)
+	}
+}
+
+func TestParsePGNZeroCastling(t *testing.T) {
+	pgn := `[Event "Castling with zeros"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 d6 4. d3 Be6 5. Nc3 Qd7 6. 0-0 0-0-0 7.0-0 *
+`
+	games, err := parsePGN(strings.Replace(pgn, " 7.0-0", "", 1))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing PGN: %s", err)
+	}
+
+	moves := games[0].moves
+	if len(moves) != 12 || moves[10].san != "O-O" || moves[11].san != "O-O-O" {
+		t.Errorf("Expected the game to end with O-O O-O-O, but got: %+v", moves)
+	}
+
+	if _, err := parsePGN(pgn); err == nil || !strings.Contains(err.Error(), "ply 13") {
+		t.Errorf("Expected castling written after a move number with no space to be read as castling, and be illegal, but got: %v", err)
+	}
+}
+
+func TestParsePGNErrors(t *testing.T) {
+	tests := []struct {
+		pgn      string
+		contains string
+	}{
+		{"1. e4 e5 2. Ke3 *", "Game 1, ply 3 (line 1): Move 'Ke3' not legal (no white king can move to e3)."},
+		{"1. e4 *\n\n1. d4 e5 2. Nf3 e4 3. Nd2 *", "Game 2, ply 5 (line 3): Move 'Nd2' is ambiguous (knights on f3, b1 can all move to d2)."},
+		{"1. e4 e5 2. Bc4 Nc6 3. Bxf8 *", "Game 1, ply 5 (line 1): Move 'Bxf8' not legal"},
+		{"[FEN \"8/8/8/8/8/8/8/8 w - - 0 1\"]\n1. e4 *", "Game 1: Invalid FEN piece placement"},
+		{"1. e4 (1. d4 *", "Game 1: unterminated variation"},
+		{"1. e4 { unterminated", "Unterminated comment starting on line 1."},
+		{"[Event \"Unterminated]\n", "Tag Event on line 1 has an unterminated value."},
+		{"1. e4 e5 )", "Game 1: unexpected ')' on line 1."},
+	}
+
+	for _, test := range tests {
+		_, err := parsePGN(test.pgn)
+		if err == nil {
+			t.Errorf("Expected error parsing PGN '%s' but got none", test.pgn)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.contains) {
+			t.Errorf("Expected error parsing PGN '%s' to contain \"%s\", but got: %s", test.pgn, test.contains, err)
+		}
+	}
+}
+
+func TestParsePGNSkipsBadGames(t *testing.T) {
+	pgn := `[Event "First"]
+
+1. e4 e5 *
+
+[Event "Illegal move"]
+
+1. e4 e5 2. Ke3 Nc6 *
+
+[Event "Third"]
+
+1. d4 d5 *
+
+[Event "Unexpected bracket"]
+
+1. e4 ) e5 *
+
+[Event "Fifth"]
+
+1. c4 *
+`
+	games, err := parsePGN(pgn)
+	if err == nil {
+		t.Fatalf("Expected errors parsing PGN but got none")
+	}
+
+	for _, contains := range []string{"Game 2, ply 3 (line 7): Move 'Ke3' not legal", "Game 4: unexpected ')' on line 15."} {
+		if !strings.Contains(err.Error(), contains) {
+			t.Errorf("Expected error parsing PGN to contain \"%s\", but got: %s", contains, err)
+		}
+	}
+
+	expectedEvents := map[int]string{1: "First", 3: "Third", 5: "Fifth"}
+	if len(games) != len(expectedEvents) {
+		t.Fatalf("Expected %d games, but got: %d", len(expectedEvents), len(games))
+	}
+
+	for _, g := range games {
+		if expectedEvents[g.number] != g.tags["Event"] {
+			t.Errorf("Expected game %d to be %s, but got: %s", g.number, expectedEvents[g.number], g.tags["Event"])
+		}
+	}
+}
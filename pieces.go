@@ -8,12 +8,14 @@ const (
 	cannotTake takingBehavior = iota
 	canTake
 	mustTake
-	mustTakeEnPassant
 )
 
+// piece describes how a type of piece moves. Its legal squares are those it can move to by its
+// normal movement, while moves that depend on the state of the game, castling and taking en
+// passant, are added for the position (see position.getLegalSquares).
 type piece interface {
 	getName() string
-	getLegalSquares(b board, sq square, color string, moved bool) []square
+	getLegalSquares(b board, sq square, color string) []square
 }
 
 type gamePiece struct {
@@ -21,6 +23,10 @@ type gamePiece struct {
 	color         string
 	moved         bool
 	numberOfMoves int
+
+	// Whether the piece is a pawn that was promoted, which in crazyhouse goes back to being a pawn
+	// when it's captured.
+	promoted bool
 }
 
 func (gp gamePiece) String() string {
@@ -45,27 +51,26 @@ func (p bishop) getName() string { return "B" }
 func (p queen) getName() string  { return "Q" }
 func (p king) getName() string   { return "K" }
 
-func (p pawn) getLegalSquares(b board, sq square, color string, moved bool) []square {
+func (p pawn) getLegalSquares(b board, sq square, color string) []square {
 	var squares []square
 	var appended bool
 	var direction int
-	var secondRank int
+	var firstRank, secondRank int
 
 	if color == "W" {
 		direction = 1
-		secondRank = 2
+		firstRank, secondRank = 1, 2
 	} else {
 		direction = -1
-		secondRank = 7
+		firstRank, secondRank = 8, 7
 	}
 
 	// Single move forward - allowed if no blocking piece.
-	if sq.rank >= 2 && sq.rank <= 7 {
-		appended, _, squares = appendLegalSquare(squares, b, p, color, sq, 1*direction, 0, cannotTake)
-	}
+	appended, _, squares = appendLegalSquare(squares, b, p, color, sq, 1*direction, 0, cannotTake)
 
-	// Double move forward - allowed if single move was allowed, and on second rank.
-	if appended && sq.rank == secondRank {
+	// Double move forward - allowed if single move was allowed, and on second rank, or in horde,
+	// the only variant with pawns on it, the first.
+	if appended && (sq.rank == secondRank || sq.rank == firstRank) {
 		appended, _, squares = appendLegalSquare(squares, b, p, color, sq, 2*direction, 0, cannotTake)
 	}
 
@@ -73,14 +78,10 @@ func (p pawn) getLegalSquares(b board, sq square, color string, moved bool) []sq
 	_, _, squares = appendLegalSquare(squares, b, p, color, sq, 1*direction, 1, mustTake)
 	_, _, squares = appendLegalSquare(squares, b, p, color, sq, 1*direction, -1, mustTake)
 
-	// En passant taking moves
-	_, _, squares = appendLegalSquare(squares, b, p, color, sq, 1*direction, 1, mustTakeEnPassant)
-	_, _, squares = appendLegalSquare(squares, b, p, color, sq, 1*direction, -1, mustTakeEnPassant)
-
 	return squares
 }
 
-func (p rook) getLegalSquares(b board, sq square, color string, moved bool) []square {
+func (p rook) getLegalSquares(b board, sq square, color string) []square {
 	return getLegalSquaresForRook(b, p, sq, color)
 }
 
@@ -89,7 +90,7 @@ func getLegalSquaresForRook(b board, p piece, sq square, color string) []square
 	var appended, willTakePiece bool
 
 	// Vertically up from current position.
-	for i := sq.rank + 1; i < BoardSize; i++ {
+	for i := sq.rank + 1; i <= BoardSize; i++ {
 		appended, willTakePiece, squares = appendLegalSquare(squares, b, p, color, sq, i-sq.rank, 0, canTake)
 		if !appended || (appended && willTakePiece) {
 			break
@@ -124,7 +125,7 @@ func getLegalSquaresForRook(b board, p piece, sq square, color string) []square
 	return squares
 }
 
-func (p knight) getLegalSquares(b board, sq square, color string, moved bool) []square {
+func (p knight) getLegalSquares(b board, sq square, color string) []square {
 	var squares []square
 
 	_, _, squares = appendLegalSquare(squares, b, p, color, sq, 2, 1, canTake)
@@ -139,7 +140,7 @@ func (p knight) getLegalSquares(b board, sq square, color string, moved bool) []
 	return squares
 }
 
-func (p bishop) getLegalSquares(b board, sq square, color string, moved bool) []square {
+func (p bishop) getLegalSquares(b board, sq square, color string) []square {
 	return getLegalSquaresForBishop(b, p, sq, color)
 }
 
@@ -215,14 +216,14 @@ func getLegalSquaresForBishop(b board, p piece, sq square, color string) []squar
 	return squares
 }
 
-func (p queen) getLegalSquares(b board, sq square, color string, moved bool) []square {
+func (p queen) getLegalSquares(b board, sq square, color string) []square {
 	// Queen legal moves are effectively rook + bishop.
 	squares := getLegalSquaresForRook(b, p, sq, color)
 	squares = append(squares, getLegalSquaresForBishop(b, p, sq, color)...)
 	return squares
 }
 
-func (p king) getLegalSquares(b board, sq square, color string, moved bool) []square {
+func (p king) getLegalSquares(b board, sq square, color string) []square {
 	var squares []square
 
 	// Single square moves
@@ -235,57 +236,9 @@ func (p king) getLegalSquares(b board, sq square, color string, moved bool) []sq
 	_, _, squares = appendLegalSquare(squares, b, p, color, sq, 0, -1, canTake)
 	_, _, squares = appendLegalSquare(squares, b, p, color, sq, 1, -1, canTake)
 
-	// Castling
-	// - king that has moved cannot castle
-	if moved {
-		return squares
-	}
-
-	rookSquares := getRookSquaresForKing(b, sq)
-	if canCastle(b, sq, rookSquares[0], color) {
-		_, _, squares = appendLegalSquare(squares, b, p, color, sq, 0, -2, cannotTake)
-	}
-	if canCastle(b, sq, rookSquares[1], color) {
-		_, _, squares = appendLegalSquare(squares, b, p, color, sq, 0, 2, cannotTake)
-	}
-
 	return squares
 }
 
-func getRookSquaresForKing(b board, kingSquare square) [2]square {
-	result := [2]square{}
-	result[0] = square{file: toFileStr(0), rank: kingSquare.rank}
-	result[1] = square{file: toFileStr(BoardSize - 1), rank: kingSquare.rank}
-	return result
-}
-
-func canCastle(b board, kingSquare square, rookSquare square, color string) bool {
-	// Must have an unmoved rook to castle with.
-	if b.isSquareEmpty(rookSquare) {
-		return false
-	}
-
-	piece, _ := b.getPieceAt(rookSquare)
-	if piece.getName() != "R" || piece.moved {
-		return false
-	}
-
-	// Can't be any blocking pieces.
-	if !b.areEmptySquaresBetween(kingSquare, rookSquare) {
-		return false
-	}
-
-	// Can't castle through check
-	for _, sq := range getSquaresBetween(kingSquare, rookSquare) {
-		isSquareEnPrise, _ := isSquareEnPrise(b, sq, color)
-		if isSquareEnPrise {
-			return false
-		}
-	}
-
-	return true
-}
-
 func appendLegalSquare(squares []square, b board, p piece, color string, sq square, rankOffset int, fileOffset int, tb takingBehavior) (bool, bool, []square) {
 
 	if sq.rank+rankOffset <= 0 ||
@@ -303,25 +256,6 @@ func appendLegalSquare(squares []square, b board, p piece, color string, sq squa
 			return false, false, squares
 		}
 
-		// Can move to square en passant only if piece is a pawn, it's moving to the 6th rank,
-		// and an opposing pawn that's made the last move is on the 5th rank.
-		if tb == mustTakeEnPassant {
-			if p.getName() != "P" ||
-				!((color == "W" && sq.rank == 5) || (color == "B" && sq.rank == 4)) {
-				return false, false, squares
-			}
-
-			enPassantTakingSquare := square{rank: sq.rank, file: toFileStr(fromFileStr(sq.file) + fileOffset)}
-			if b.isSquareEmpty(enPassantTakingSquare) {
-				return false, false, squares
-			}
-
-			pieceToTakeEnPassant, _ := b.getPieceAt(enPassantTakingSquare)
-			if pieceToTakeEnPassant.getName() != "P" || pieceToTakeEnPassant.numberOfMoves != 1 {
-				return false, false, squares
-			}
-		}
-
 		// Otherwise if OK to move to empty square.
 		return true, false, append(squares, newSquare)
 	}
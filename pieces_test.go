@@ -15,7 +15,7 @@ func TestPawnGetLegalSquares(t *testing.T) {
 
 	// Test: white pawn on second rank can move 1 or 2 squares
 	sq = square{file: "E", rank: 2}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 2
 	if len(res) != expectedCount {
 		t.Errorf("Expected white pawn on second rank to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -23,7 +23,7 @@ func TestPawnGetLegalSquares(t *testing.T) {
 
 	// Test: white pawn on third rank can move 1 square
 	sq = square{file: "E", rank: 3}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 1
 	if len(res) != expectedCount {
 		t.Errorf("Expected white pawn on third rank to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -31,7 +31,7 @@ func TestPawnGetLegalSquares(t *testing.T) {
 
 	// Test: black pawn on second rank can move 1 or 2 squares
 	sq = square{file: "E", rank: 7}
-	res = p.getLegalSquares(b, sq, "B", false)
+	res = p.getLegalSquares(b, sq, "B")
 	expectedCount = 2
 	if len(res) != expectedCount {
 		t.Errorf("Expected black pawn on second rank to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -39,7 +39,7 @@ func TestPawnGetLegalSquares(t *testing.T) {
 
 	// Test: black pawn on third rank can move 1 square
 	sq = square{file: "E", rank: 6}
-	res = p.getLegalSquares(b, sq, "B", true)
+	res = p.getLegalSquares(b, sq, "B")
 	expectedCount = 1
 	if len(res) != expectedCount {
 		t.Errorf("Expected black pawn on third rank to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -48,7 +48,7 @@ func TestPawnGetLegalSquares(t *testing.T) {
 	// Test: pawn can't move forward if there's a blocking piece
 	b.movePiece(square{file: "E", rank: 7}, square{file: "E", rank: 3})
 	sq = square{file: "E", rank: 2}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 0
 	if len(res) != expectedCount {
 		t.Errorf("Expected white pawn on second rank with blocking piece to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -58,51 +58,12 @@ func TestPawnGetLegalSquares(t *testing.T) {
 	// Test: pawn can take diagonally
 	b.movePiece(square{file: "D", rank: 7}, square{file: "D", rank: 3})
 	sq = square{file: "E", rank: 2}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 3
 	if len(res) != expectedCount {
 		t.Errorf("Expected white pawn on second rank with takeable piece to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
 	}
 	b.init()
-
-	// Test: pawn can take en passant
-	b.movePiece(square{file: "E", rank: 2}, square{file: "E", rank: 4})
-	b.movePiece(square{file: "A", rank: 7}, square{file: "A", rank: 6})
-	b.movePiece(square{file: "E", rank: 4}, square{file: "E", rank: 5})
-	b.movePiece(square{file: "F", rank: 7}, square{file: "F", rank: 5})
-	sq = square{file: "E", rank: 5}
-	res = p.getLegalSquares(b, sq, "W", false)
-	expectedCount = 2
-	if len(res) != expectedCount {
-		t.Errorf("Expected white pawn that can take en passant to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
-	}
-	b.init()
-
-	// Test: pawn cannot take en passant if there's no pawn to take
-	b.movePiece(square{file: "E", rank: 2}, square{file: "E", rank: 4})
-	b.movePiece(square{file: "A", rank: 7}, square{file: "A", rank: 6})
-	b.movePiece(square{file: "E", rank: 4}, square{file: "E", rank: 5})
-	b.movePiece(square{file: "B", rank: 7}, square{file: "B", rank: 5})
-	sq = square{file: "E", rank: 5}
-	res = p.getLegalSquares(b, sq, "W", false)
-	expectedCount = 1
-	if len(res) != expectedCount {
-		t.Errorf("Expected white pawn that with no pawn to take en passant to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
-	}
-	b.init()
-
-	// Test: pawn cannot take en passant if there is a pawn to take but it's not just moved from it's inital square
-	b.movePiece(square{file: "E", rank: 2}, square{file: "E", rank: 4})
-	b.movePiece(square{file: "F", rank: 7}, square{file: "F", rank: 6})
-	b.movePiece(square{file: "E", rank: 4}, square{file: "E", rank: 5})
-	b.movePiece(square{file: "F", rank: 6}, square{file: "F", rank: 5})
-	sq = square{file: "E", rank: 5}
-	res = p.getLegalSquares(b, sq, "W", false)
-	expectedCount = 1
-	if len(res) != expectedCount {
-		t.Errorf("Expected white pawn with pawn that could take en passent if it had just moved to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
-	}
-	b.init()
 }
 
 func TestRookGetLegalSquares(t *testing.T) {
@@ -116,7 +77,7 @@ func TestRookGetLegalSquares(t *testing.T) {
 
 	// Test: white rook in starting position has no legal squares
 	sq = square{file: "A", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 0
 	if len(res) != expectedCount {
 		t.Errorf("Expected white rook in starting position to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -128,18 +89,29 @@ func TestRookGetLegalSquares(t *testing.T) {
 	// - 7 horizontally (all empty)
 	b.movePiece(square{file: "A", rank: 1}, square{file: "B", rank: 4})
 	sq = square{file: "B", rank: 4}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 11
 	if len(res) != expectedCount {
 		t.Errorf("Expected white rook with spaces around to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
 	}
 	b.init()
 
+	// Test: white rook can move up to the eighth rank (taking the opponent's rook)
+	b.movePiece(square{file: "A", rank: 2}, square{file: "B", rank: 3})
+	b.movePiece(square{file: "A", rank: 7}, square{file: "B", rank: 6})
+	sq = square{file: "A", rank: 1}
+	res = p.getLegalSquares(b, sq, "W")
+	expectedCount = 7
+	if len(res) != expectedCount {
+		t.Errorf("Expected white rook with open file to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
+	}
+	b.init()
+
 	// Test: black rook in initial position with spaces in front due to pawn move around has legal moves:
 	// - 2 vertical above (two empty, vacated by pawn)
 	b.movePiece(square{file: "H", rank: 7}, square{file: "H", rank: 5})
 	sq = square{file: "H", rank: 8}
-	res = p.getLegalSquares(b, sq, "B", false)
+	res = p.getLegalSquares(b, sq, "B")
 	expectedCount = 2
 	if len(res) != expectedCount {
 		t.Errorf("Expected black rook in initial position with spaces in front due to pawn move to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -158,7 +130,7 @@ func TestKnightGetLegalSquares(t *testing.T) {
 
 	// Test: white knight in starting position has 2 legal squares
 	sq = square{file: "B", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 2
 	if len(res) != expectedCount {
 		t.Errorf("Expected white knight in starting position to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -167,7 +139,7 @@ func TestKnightGetLegalSquares(t *testing.T) {
 	// Test: white knight with spaces around (on B4 of otherwise initialised board) has legal moves:
 	b.movePiece(square{file: "B", rank: 1}, square{file: "B", rank: 4})
 	sq = square{file: "B", rank: 4}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 4
 	if len(res) != expectedCount {
 		t.Errorf("Expected white knight with spaces around to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -177,7 +149,7 @@ func TestKnightGetLegalSquares(t *testing.T) {
 	// Test: white knight with spaces around (on B5 of otherwise initialised board) has legal moves:
 	b.movePiece(square{file: "B", rank: 1}, square{file: "B", rank: 5})
 	sq = square{file: "B", rank: 5}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 6
 	if len(res) != expectedCount {
 		t.Errorf("Expected white knight with spaces around to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -196,7 +168,7 @@ func TestBishopGetLegalSquares(t *testing.T) {
 
 	// Test: white bishop in starting position has no legal squares
 	sq = square{file: "C", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 0
 	if len(res) != expectedCount {
 		t.Errorf("Expected white bishop in starting position to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -209,7 +181,7 @@ func TestBishopGetLegalSquares(t *testing.T) {
 	// - 1 down/left (empty)
 	b.movePiece(square{file: "C", rank: 1}, square{file: "B", rank: 4})
 	sq = square{file: "B", rank: 4}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 6
 	if len(res) != expectedCount {
 		t.Errorf("Expected white bishop with spaces around to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -220,7 +192,7 @@ func TestBishopGetLegalSquares(t *testing.T) {
 	// - 5 up/left
 	b.movePiece(square{file: "E", rank: 2}, square{file: "E", rank: 4})
 	sq = square{file: "F", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 5
 	if len(res) != expectedCount {
 		t.Errorf("Expected white bishop in initial position with spaces available due to queen pawn move to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -231,7 +203,7 @@ func TestBishopGetLegalSquares(t *testing.T) {
 	// - 5 down/right
 	b.movePiece(square{file: "D", rank: 7}, square{file: "D", rank: 5})
 	sq = square{file: "C", rank: 8}
-	res = p.getLegalSquares(b, sq, "B", false)
+	res = p.getLegalSquares(b, sq, "B")
 	expectedCount = 5
 	if len(res) != expectedCount {
 		t.Errorf("Expected black bishop in initial position with spaces available due to queen pawn move to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -250,7 +222,7 @@ func TestQueenGetLegalSquares(t *testing.T) {
 
 	// Test: white queen in starting position has no legal squares
 	sq = square{file: "D", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 0
 	if len(res) != expectedCount {
 		t.Errorf("Expected white queen in starting position to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -266,7 +238,7 @@ func TestQueenGetLegalSquares(t *testing.T) {
 	// - 1 down/left (empty)
 	b.movePiece(square{file: "D", rank: 1}, square{file: "B", rank: 4})
 	sq = square{file: "B", rank: 4}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 17
 	if len(res) != expectedCount {
 		t.Errorf("Expected white queen with spaces around to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -278,7 +250,7 @@ func TestQueenGetLegalSquares(t *testing.T) {
 	b.movePiece(square{file: "F", rank: 7}, square{file: "E", rank: 6})
 	b.movePiece(square{file: "D", rank: 1}, square{file: "H", rank: 5})
 	sq = square{file: "H", rank: 5}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 18
 	if len(res) != expectedCount {
 		t.Errorf("Expected white queen with spaces around to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -296,7 +268,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 
 	// Test: white king in starting position has no legal squares
 	sq = square{file: "E", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 0
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king in starting position to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -306,7 +278,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	// - 8 empty squares around
 	b.movePiece(square{file: "E", rank: 1}, square{file: "B", rank: 4})
 	sq = square{file: "B", rank: 4}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 8
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king with spaces around to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -318,7 +290,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	// - 3 blocked by own pawns
 	b.movePiece(square{file: "E", rank: 1}, square{file: "B", rank: 3})
 	sq = square{file: "B", rank: 3}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = p.getLegalSquares(b, sq, "W")
 	expectedCount = 5
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king with spaces around to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -330,7 +302,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	b.movePiece(square{file: "G", rank: 1}, square{file: "F", rank: 3})
 	b.movePiece(square{file: "F", rank: 1}, square{file: "E", rank: 2})
 	sq = square{file: "E", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = newPositionFromBoard(b, "W").getLegalSquares(sq)
 	expectedCount = 2
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king that can legally castle on one side to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -342,7 +314,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	b.movePiece(square{file: "G", rank: 8}, square{file: "F", rank: 6})
 	b.movePiece(square{file: "F", rank: 8}, square{file: "E", rank: 7})
 	sq = square{file: "E", rank: 8}
-	res = p.getLegalSquares(b, sq, "B", false)
+	res = newPositionFromBoard(b, "B").getLegalSquares(sq)
 	expectedCount = 2
 	if len(res) != expectedCount {
 		t.Errorf("Expected black king that can legally castle on one side to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -358,7 +330,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	b.movePiece(square{file: "C", rank: 1}, square{file: "D", rank: 2})
 	b.movePiece(square{file: "D", rank: 1}, square{file: "F", rank: 3})
 	sq = square{file: "E", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = newPositionFromBoard(b, "W").getLegalSquares(sq)
 	expectedCount = 4
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king that can legally castle on both sides to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -369,7 +341,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	b.movePiece(square{file: "E", rank: 2}, square{file: "E", rank: 4})
 	b.movePiece(square{file: "F", rank: 1}, square{file: "E", rank: 2})
 	sq = square{file: "E", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = newPositionFromBoard(b, "W").getLegalSquares(sq)
 	expectedCount = 1
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king that cannot castle due to blocking pice to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -383,7 +355,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	b.movePiece(square{file: "E", rank: 1}, square{file: "F", rank: 1})
 	b.movePiece(square{file: "F", rank: 1}, square{file: "E", rank: 1})
 	sq = square{file: "E", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = newPositionFromBoard(b, "W").getLegalSquares(sq)
 	expectedCount = 1
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king that cannot castle due to having moved to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -397,7 +369,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	b.movePiece(square{file: "H", rank: 2}, square{file: "H", rank: 3})
 	b.movePiece(square{file: "H", rank: 1}, square{file: "H", rank: 2})
 	sq = square{file: "E", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = newPositionFromBoard(b, "W").getLegalSquares(sq)
 	expectedCount = 1
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king that cannot castle due to rook not being on starting square to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -412,7 +384,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	b.movePiece(square{file: "H", rank: 1}, square{file: "H", rank: 2})
 	b.movePiece(square{file: "H", rank: 2}, square{file: "H", rank: 1})
 	sq = square{file: "E", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", true)
+	res = newPositionFromBoard(b, "W").getLegalSquares(sq)
 	expectedCount = 1
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king that cannot castle due to rook being starting square but having moved to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -425,7 +397,7 @@ func TestKingGetLegalSquares(t *testing.T) {
 	b.movePiece(square{file: "F", rank: 1}, square{file: "B", rank: 5})
 	b.movePiece(square{file: "C", rank: 8}, square{file: "C", rank: 4})
 	sq = square{file: "E", rank: 1}
-	res = p.getLegalSquares(b, sq, "W", false)
+	res = newPositionFromBoard(b, "W").getLegalSquares(sq)
 	expectedCount = 2
 	if len(res) != expectedCount {
 		t.Errorf("Expected white king that can legally castle on one side but would castle through check to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The keys given for these positions in the Polyglot book format's description.
+func TestGetPolyglotKey(t *testing.T) {
+	tests := []struct {
+		moves    []string
+		expected uint64
+	}{
+		{nil, 0x463b96181691fc9c},
+		{[]string{"e4"}, 0x823c9b50fd114196},
+		{[]string{"e4", "d5"}, 0x0756b94461c50fb0},
+		{[]string{"e4", "d5", "e5"}, 0x662fafb965db29d4},
+		{[]string{"e4", "d5", "e5", "f5"}, 0x22a48b5a8e47ff78},
+		{[]string{"e4", "d5", "e5", "f5", "Ke2"}, 0x652a607ca3f242c1},
+		{[]string{"e4", "d5", "e5", "f5", "Ke2", "Kf7"}, 0x00fdd303c946bdd9},
+		{[]string{"a4", "b5", "h4", "b4", "c4"}, 0x3c8123ea7b067637},
+		{[]string{"a4", "b5", "h4", "b4", "c4", "bxc3", "Ra3"}, 0x5c3f9b829b279560},
+	}
+
+	for _, test := range tests {
+		p := newPosition()
+		playMoves(t, &p, test.moves...)
+		if res := getPolyglotKey(p); res != test.expected {
+			t.Errorf("Expected key after %v to be %016x, but got: %016x", test.moves, test.expected, res)
+		}
+	}
+}
+
+func TestPolyglotMoveCodes(t *testing.T) {
+	tests := []struct {
+		fen  string
+		san  string
+		code uint16
+	}{
+		{StartingFEN, "e4", 12<<6 | 28},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O", 4<<6 | 7},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O-O", 4<<6 | 0},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "O-O", 60<<6 | 63},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8=N", 1<<12 | 52<<6 | 60},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8=Q", 4<<12 | 52<<6 | 60},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		m, err := resolveSAN(p, test.san)
+		if err != nil {
+			t.Fatalf("Unexpected error playing %s in %s: %s", test.san, test.fen, err)
+		}
+
+		if res := getPolyglotMoveCode(m); res != test.code {
+			t.Errorf("Expected %s in %s to be stored as %04x, but got: %04x", test.san, test.fen, test.code, res)
+		}
+
+		res, err := getPolyglotMove(p, test.code)
+		if err != nil || res.String() != m.String() {
+			t.Errorf("Expected %04x in %s to be %s, but got: %s (%v)", test.code, test.fen, m, res, err)
+		}
+	}
+}
+
+func TestPolyglotBook(t *testing.T) {
+	games, err := parsePGN("1. e4 e5 2. Nf3 Nc6 *\n\n1. e4 c5 2. Nf3 *\n\n1. d4 d5 *\n\n1. e4 e5 2. Nf3 Nf6 *\n")
+	if err != nil {
+		t.Fatalf("Unexpected error reading games: %s", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "book.bin")
+	if err := writePolyglotBook(path, buildPolyglotBook(games, 2, 3)); err != nil {
+		t.Fatalf("Unexpected error writing book: %s", err)
+	}
+
+	book, err := readPolyglotBook(path, "best")
+	if err != nil {
+		t.Fatalf("Unexpected error reading book: %s", err)
+	}
+
+	// d4 and c5 are played in only one game each, and no moves after the third ply go in the book.
+	tests := []struct {
+		moves    []string
+		expected []string
+		best     string
+	}{
+		{nil, []string{"e2e4 3"}, "e2e4"},
+		{[]string{"e4"}, []string{"e7e5 2"}, "e7e5"},
+		{[]string{"e4", "e5"}, []string{"g1f3 2"}, "g1f3"},
+		{[]string{"e4", "e5", "Nf3"}, nil, ""},
+		{[]string{"d4"}, nil, ""},
+	}
+
+	for _, test := range tests {
+		p := newPosition()
+		playMoves(t, &p, test.moves...)
+		var res []string
+		for _, bm := range book.getMoves(p) {
+			res = append(res, fmt.Sprintf("%s %d", bm.move, bm.weight))
+		}
+
+		if strings.Join(res, ", ") != strings.Join(test.expected, ", ") {
+			t.Errorf("Expected book moves after %v to be %v, but got: %v", test.moves, test.expected, res)
+		}
+
+		if m, ok := book.pickMove(p); ok != (test.best != "") || ok && m.String() != test.best {
+			t.Errorf("Expected the best book move after %v to be %q, but got: %s (%t)", test.moves, test.best, m, ok)
+		}
+	}
+}
+
+func TestPolyglotBookPickRandom(t *testing.T) {
+	p := newPosition()
+	book := &polyglotBook{
+		entries: []polyglotEntry{
+			{key: getPolyglotKey(p), move: 12<<6 | 28, weight: 3},
+			{key: getPolyglotKey(p), move: 11<<6 | 27, weight: 1},
+			{key: getPolyglotKey(p), move: 10<<6 | 26, weight: 0},
+		},
+		pickRandom: true,
+		rng:        rand.New(rand.NewSource(1)),
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		m, _ := book.pickMove(p)
+		counts[m.String()]++
+	}
+
+	if counts["e2e4"] < 650 || counts["e2e4"] > 850 || counts["d2d4"] < 150 || counts["c2c4"] > 0 {
+		t.Errorf("Expected moves to be picked in proportion to their weights, 3:1:0, but got: %v", counts)
+	}
+}
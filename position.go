@@ -0,0 +1,280 @@
+package main
+
+import "fmt"
+
+type castlingRights struct {
+	whiteKingside  bool
+	whiteQueenside bool
+	blackKingside  bool
+	blackQueenside bool
+}
+
+type position struct {
+	board           board
+	sideToMove      string
+	castlingRights  castlingRights
+	enPassantSquare square
+	halfmoveClock   int
+	fullmoveNumber  int
+	hash            uint64
+
+	// The files of the rooks castling is with, by castling right, if they're not the h- and
+	// a-files of standard chess, and whether the game is Chess960, where they may not be.
+	castlingFiles [4]string
+	chess960      bool
+
+	// The variant whose rules the game is played by, in crazyhouse, the pieces each side has
+	// captured and can drop, and in three-check, the checks each side has given, by colour index.
+	variant variant
+	pockets [2]pocket
+	checks  [2]int
+}
+
+func newPosition() position {
+	p := position{sideToMove: "W", fullmoveNumber: 1}
+	p.board.init()
+	p.castlingRights = castlingRights{true, true, true, true}
+	p.hash = p.getHash()
+	return p
+}
+
+// newPositionFromBoard wraps a board set up by hand (e.g. with movePiece or addPieceAt), deriving
+// castling rights from whether the kings and rooks have moved. The board doesn't record the last
+// move, so no pawn can be taken en passant.
+func newPositionFromBoard(b board, sideToMove string) position {
+	p := position{board: b, sideToMove: sideToMove, fullmoveNumber: 1}
+	p.castlingRights = castlingRights{
+		whiteKingside:  hasUnmovedPiece(b, square{file: "E", rank: 1}, "K", "W") && hasUnmovedPiece(b, square{file: "H", rank: 1}, "R", "W"),
+		whiteQueenside: hasUnmovedPiece(b, square{file: "E", rank: 1}, "K", "W") && hasUnmovedPiece(b, square{file: "A", rank: 1}, "R", "W"),
+		blackKingside:  hasUnmovedPiece(b, square{file: "E", rank: 8}, "K", "B") && hasUnmovedPiece(b, square{file: "H", rank: 8}, "R", "B"),
+		blackQueenside: hasUnmovedPiece(b, square{file: "E", rank: 8}, "K", "B") && hasUnmovedPiece(b, square{file: "A", rank: 8}, "R", "B"),
+	}
+	p.hash = p.getHash()
+	return p
+}
+
+func hasUnmovedPiece(b board, sq square, name string, color string) bool {
+	gp, err := b.getPieceAt(sq)
+	return err == nil && gp.getName() == name && gp.color == color && !gp.moved
+}
+
+// get returns the castling right with the given number, in the order of the bits a
+// bitboardPosition holds them as: white kingside, white queenside, black kingside, black queenside.
+func (cr *castlingRights) get(right int) *bool {
+	return [...]*bool{&cr.whiteKingside, &cr.whiteQueenside, &cr.blackKingside, &cr.blackQueenside}[right]
+}
+
+func (cr castlingRights) any(color string) bool {
+	if color == "W" {
+		return cr.whiteKingside || cr.whiteQueenside
+	}
+
+	return cr.blackKingside || cr.blackQueenside
+}
+
+// getCastlingRookSquare returns the square of the rook that castling with the given right is with,
+// by its number as for castlingRights.get.
+func (p position) getCastlingRookSquare(right int) square {
+	sq := square{file: p.castlingFiles[right], rank: 1}
+	if sq.file == "" {
+		sq.file = "H"
+		if right%2 == 1 {
+			sq.file = "A"
+		}
+	}
+	if right >= 2 {
+		sq.rank = BoardSize
+	}
+
+	return sq
+}
+
+// getCastlingRights returns the numbers of the castling rights a side could have.
+func getCastlingRights(color string) [2]int {
+	if color == "W" {
+		return [2]int{0, 1}
+	}
+
+	return [2]int{2, 3}
+}
+
+// print prints the position's board, with the pockets in crazyhouse, and the checks each side has
+// given in three-check.
+func (p position) print() {
+	var notes [2]string
+	for color, name := range []string{"W", "B"} {
+		switch p.variant {
+		case crazyhouse:
+			notes[color] = fmt.Sprintf("%s pocket: %s", name, p.pockets[color])
+		case threeCheck:
+			notes[color] = fmt.Sprintf("%s checks: %d/%d", name, p.checks[color], threeCheckChecks)
+		}
+	}
+
+	p.board.print(notes)
+}
+
+func isNoSquare(sq square) bool {
+	return sq == (square{})
+}
+
+// moveUndo is the state a move loses that can't be worked out from the move itself, which
+// unmakeMove needs to take the move back.
+type moveUndo struct {
+	castlingRights  castlingRights
+	enPassantSquare square
+	halfmoveClock   int
+	castledRook     gamePiece
+	pockets         [2]pocket
+	checks          [2]int
+	hash            uint64
+
+	// In atomic, the pieces on the squares a capture explodes, in the order getExplosionSquares
+	// gives them, from before the capture.
+	explosion [9]gamePiece
+}
+
+// makeMove plays a move on the position's board, and updates the state that goes with it: the
+// side to move, castling rights, en passant square, move clocks and hash, in crazyhouse, the
+// pockets, and in three-check, the checks given. It returns what's needed to take the move back
+// with unmakeMove.
+func (p *position) makeMove(m move) moveUndo {
+	fromSquare, toSquare := m.fromSquare, m.toSquare
+	piece := m.piece
+
+	u := moveUndo{castlingRights: p.castlingRights, enPassantSquare: p.enPassantSquare, halfmoveClock: p.halfmoveClock, pockets: p.pockets, checks: p.checks, hash: p.hash}
+	if m.isDrop {
+		pk := p.getPocket(piece.color)
+		p.hash ^= getZobristPocketKey(piece.color, piece.getName(), pk.count(piece.getName())-1)
+		pk.remove(piece.getName())
+	} else {
+		p.hash ^= getZobristPieceKey(piece, fromSquare)
+	}
+	if m.isCapture() {
+		capturedSquare := toSquare
+		if m.isEnPassant {
+			capturedSquare = square{file: toSquare.file, rank: fromSquare.rank}
+		}
+		p.hash ^= getZobristPieceKey(m.captured, capturedSquare)
+
+		if p.variant == crazyhouse {
+			name := getCapturedPocketPiece(m.captured)
+			pk := p.getPocket(piece.color)
+			p.hash ^= getZobristPocketKey(piece.color, name, pk.count(name))
+			pk.add(name)
+		}
+	}
+	if m.isCastling {
+		rookSquares := getCastledRookSquares(m)
+		u.castledRook, _ = p.board.getPieceAt(rookSquares[0])
+		p.hash ^= getZobristPieceKey(u.castledRook, rookSquares[0]) ^ getZobristPieceKey(u.castledRook, rookSquares[1])
+	}
+	if p.canTakeEnPassant() {
+		p.hash ^= zobristEnPassant[fromFileStr(p.enPassantSquare.file)]
+	}
+
+	isExplosion := p.variant == atomicChess && m.isCapture()
+	if isExplosion {
+		for i, sq := range getExplosionSquares(toSquare) {
+			u.explosion[i], _ = p.board.getPieceAt(sq)
+		}
+	}
+
+	p.board.playMove(m)
+	if p.variant == crazyhouse && m.promotion != "" {
+		row, col := getRowColForSquare(toSquare)
+		p.board[row][col].promoted = true
+	}
+	movedPiece, _ := p.board.getPieceAt(toSquare)
+	p.hash ^= getZobristPieceKey(movedPiece, toSquare)
+
+	// In atomic, the capture blows up the capturing piece and every piece around it but pawns.
+	// Castling rights are lost with the king or rook they're with.
+	if isExplosion {
+		for _, sq := range getExplosionSquares(toSquare) {
+			gp, err := p.board.getPieceAt(sq)
+			if err != nil || gp.getName() == "P" && !areSquaresEqual(sq, toSquare) {
+				continue
+			}
+
+			p.hash ^= getZobristPieceKey(gp, sq)
+			if gp.getName() == "K" {
+				for _, right := range getCastlingRights(gp.color) {
+					*p.castlingRights.get(right) = false
+				}
+			}
+			for right := 0; right < 4; right++ {
+				if areSquaresEqual(sq, p.getCastlingRookSquare(right)) {
+					*p.castlingRights.get(right) = false
+				}
+			}
+		}
+		p.board.explode(toSquare)
+	}
+
+	if piece.getName() == "P" || m.isCapture() {
+		p.halfmoveClock = 0
+	} else {
+		p.halfmoveClock++
+	}
+
+	// A pawn moving two squares from the first rank in horde can't be taken en passant.
+	p.enPassantSquare = square{}
+	if piece.getName() == "P" && !m.isDrop && (fromSquare.rank == 2 && toSquare.rank == 4 || fromSquare.rank == 7 && toSquare.rank == 5) {
+		p.enPassantSquare = square{file: fromSquare.file, rank: (fromSquare.rank + toSquare.rank) / 2}
+	}
+
+	// Moving a king or rook, or taking a rook, loses the castling rights that depend on it.
+	if piece.getName() == "K" {
+		for _, right := range getCastlingRights(piece.color) {
+			*p.castlingRights.get(right) = false
+		}
+	}
+	for right := 0; right < 4; right++ {
+		rookSquare := p.getCastlingRookSquare(right)
+		if areSquaresEqual(fromSquare, rookSquare) || areSquaresEqual(toSquare, rookSquare) {
+			*p.castlingRights.get(right) = false
+		}
+	}
+
+	if p.sideToMove == "B" {
+		p.fullmoveNumber++
+	}
+	p.sideToMove = switchColor(p.sideToMove)
+
+	p.hash ^= zobristCastling[u.castlingRights.getBits()] ^ zobristCastling[p.castlingRights.getBits()] ^ zobristBlackToMove
+	if p.canTakeEnPassant() {
+		p.hash ^= zobristEnPassant[fromFileStr(p.enPassantSquare.file)]
+	}
+
+	if p.variant == threeCheck && p.isKingInCheck() {
+		checks := p.getChecks(piece.color)
+		p.hash ^= getZobristCheckKey(piece.color, *checks)
+		*checks++
+	}
+
+	return u
+}
+
+// unmakeMove takes back the move that was the last one made, restoring the position to exactly
+// how it was before, including the moved flags and move counts of the pieces.
+func (p *position) unmakeMove(m move, u moveUndo) {
+	p.sideToMove = switchColor(p.sideToMove)
+	if p.sideToMove == "B" {
+		p.fullmoveNumber--
+	}
+	p.castlingRights = u.castlingRights
+	p.enPassantSquare = u.enPassantSquare
+	p.halfmoveClock = u.halfmoveClock
+	p.pockets = u.pockets
+	p.checks = u.checks
+	p.hash = u.hash
+
+	p.board.unplayMove(m, u.castledRook)
+	if p.variant == atomicChess && m.isCapture() {
+		for i, sq := range getExplosionSquares(m.toSquare) {
+			row, col := getRowColForSquare(sq)
+			p.board[row][col] = u.explosion[i]
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+func playMoves(t *testing.T, p *position, moves ...string) {
+	for _, san := range moves {
+		m, err := resolveSAN(*p, san)
+		if err != nil {
+			t.Fatalf("Unexpected error playing %s: %s", san, err)
+		}
+		p.makeMove(m)
+	}
+}
+
+func TestPositionGetLegalSquaresEnPassant(t *testing.T) {
+	tests := []struct {
+		moves         []string
+		expectedCount int
+		description   string
+	}{
+		{[]string{"e4", "a6", "e5", "f5"}, 2, "pawn can take en passant"},
+		{[]string{"e4", "a6", "e5", "b5"}, 1, "pawn can't take en passant if there's no pawn to take"},
+		{[]string{"e4", "f6", "e5", "f5"}, 1, "pawn can't take en passant a pawn that moved one square at a time"},
+		{[]string{"e4", "f5", "e5", "a6"}, 1, "pawn can't take en passant a pawn that didn't just move"},
+		{[]string{"e4", "a6", "e5", "f5", "h3", "h6"}, 1, "pawn can't take en passant a pawn that double-stepped several turns ago"},
+	}
+
+	for _, test := range tests {
+		p := newPosition()
+		playMoves(t, &p, test.moves...)
+		res := p.getLegalSquares(square{file: "E", rank: 5})
+		if len(res) != test.expectedCount {
+			t.Errorf("Expected %d legal moves when %s, but got: %d (%v)", test.expectedCount, test.description, len(res), res)
+		}
+	}
+}
+
+func TestPositionMakeMove(t *testing.T) {
+	// Taking en passant removes the pawn taken.
+	p := newPosition()
+	playMoves(t, &p, "e4", "a6", "e5", "d5", "exd6")
+	expected := "rnbqkbnr/1pp1pppp/p2P4/8/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 3"
+	if p.toFEN() != expected {
+		t.Errorf("Expected FEN after taking en passant to be %s, but got: %s", expected, p.toFEN())
+	}
+
+	// Castling moves the rook too.
+	p = newPosition()
+	playMoves(t, &p, "e4", "e5", "Nf3", "Nc6", "Bc4", "Bc5", "O-O")
+	expected = "r1bqk1nr/pppp1ppp/2n5/2b1p3/2B1P3/5N2/PPPP1PPP/RNBQ1RK1 b kq - 5 4"
+	if p.toFEN() != expected {
+		t.Errorf("Expected FEN after castling to be %s, but got: %s", expected, p.toFEN())
+	}
+
+	// A rook that moves and returns no longer has its castling right, though it hasn't moved
+	// as far as the board shows.
+	p, _ = parseFEN("4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1")
+	playMoves(t, &p, "Rg1", "Kd8", "Rh1", "Ke8")
+	res := p.getLegalSquares(square{file: "E", rank: 1})
+	expectedCount := 6
+	if len(res) != expectedCount {
+		t.Errorf("Expected king that can only castle queenside to have %d legal moves, but got: %d (%v)", expectedCount, len(res), res)
+	}
+}
+
+func TestPositionUnmakeMove(t *testing.T) {
+	fens := []string{
+		StartingFEN,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/1P6/8/3pP3/8/8/6p1/R3K2R w KQkq d6 0 1",
+		"r3k2r/1P6/8/8/3pP3/8/6p1/R3K2R b KQkq e3 5 20",
+	}
+
+	for _, fen := range fens {
+		p, _ := parseFEN(fen)
+		for _, m := range generateLegalMoves(p) {
+			next := p
+			u := next.makeMove(m)
+			for _, reply := range generateLegalMoves(next) {
+				after := next
+				ru := after.makeMove(reply)
+				after.unmakeMove(reply, ru)
+				if after != next {
+					t.Errorf("Expected unmaking %v after %v from %s to restore the position, but got: %s", reply, m, fen, after.toFEN())
+				}
+			}
+
+			next.unmakeMove(m, u)
+			if next != p {
+				t.Errorf("Expected unmaking %v from %s to restore the position, but got: %s", m, fen, next.toFEN())
+			}
+		}
+	}
+}
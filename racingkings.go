@@ -0,0 +1,50 @@
+package main
+
+// getRacingKingsWin returns the side that has won the race to the eighth rank in Racing Kings, and
+// how, or an empty string if neither has yet. Black getting there first wins straight away, but
+// when white does, black gets one more move to draw by getting there too, unless it can't.
+func (p position) getRacingKingsWin() (string, string) {
+	whiteHome, blackHome := p.hasKingOnLastRank("W"), p.hasKingOnLastRank("B")
+	if blackHome && !whiteHome {
+		return "B", "The B king has reached the eighth rank"
+	}
+
+	if whiteHome && !blackHome && (p.sideToMove == "W" || !p.canKingReachLastRank("B")) {
+		return "W", "The W king has reached the eighth rank"
+	}
+
+	return "", ""
+}
+
+// hasKingOnLastRank returns whether the side's king is on the eighth rank, which is the last rank
+// for both sides in Racing Kings.
+func (p position) hasKingOnLastRank(color string) bool {
+	kingSquare, err := p.board.getSquareForPiece(color, "K")
+	return err == nil && kingSquare.rank == BoardSize
+}
+
+// canKingReachLastRank returns whether the side to move, which is the given side, has a legal
+// move taking its king to the eighth rank.
+func (p position) canKingReachLastRank(color string) bool {
+	kingSquare, err := p.board.getSquareForPiece(color, "K")
+	if err != nil {
+		return false
+	}
+
+	for _, sq := range p.getLegalSquares(kingSquare) {
+		if sq.rank == BoardSize && p.isLegal(newMove(p, kingSquare, sq), kingSquare) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wouldGiveCheck returns whether making the move would put the other side's king in check, which
+// isn't allowed in Racing Kings.
+func wouldGiveCheck(p position, m move) bool {
+	tempBoard := p.board
+	tempBoard.playMove(m)
+	inCheck, _ := tempBoard.isKingInCheck(switchColor(m.piece.color))
+	return inCheck
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// replay steps through a game read from a PGN file, printing the board after each move.
+func replay(path string, gameNumber int) error {
+	if path == "" {
+		return errors.New("No PGN file given to replay.")
+	}
+
+	games, err := readPGNFile(path)
+	if len(games) == 0 && err != nil {
+		return err
+	}
+
+	// Games skipped for errors keep their numbers, so the game is found by number rather than by
+	// its place in the games read.
+	i := slices.IndexFunc(games, func(g pgnGame) bool { return g.number == gameNumber })
+	if i < 0 {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("Game %d not found (%s has %d games).", gameNumber, path, len(games))
+	}
+
+	game := games[i]
+	fmt.Printf("%s v %s, %s %s (%s)\n", game.tags["White"], game.tags["Black"], game.tags["Event"], game.tags["Date"], game.result)
+
+	ply := 0
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		game.getPositionAfter(ply).print()
+		if ply > 0 {
+			fmt.Printf("%s\n", getMoveText(game, ply-1))
+		}
+		if ply == len(game.moves) {
+			fmt.Printf("End of game: %s\n", game.result)
+		}
+
+		fmt.Printf("Move %d of %d. Enter for next, p for previous, s for start, e for end, q to quit: ", ply, len(game.moves))
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return nil
+		}
+
+		switch strings.ToLower(strings.TrimSpace(input)) {
+		case "", "n":
+			if ply < len(game.moves) {
+				ply++
+			}
+		case "p":
+			if ply > 0 {
+				ply--
+			}
+		case "s":
+			ply = 0
+		case "e":
+			ply = len(game.moves)
+		case "q":
+			return nil
+		}
+	}
+}
+
+// getMoveText returns the move with its number, e.g. "12. Nf3" or "12... Nf6".
+func getMoveText(g pgnGame, i int) string {
+	// Count plies from the start position's move number, so games starting with black to move work.
+	ply := i
+	if g.startPosition.sideToMove == "B" {
+		ply++
+	}
+
+	moveNumber := g.startPosition.fullmoveNumber + ply/2
+	if ply%2 == 0 {
+		return fmt.Sprintf("%d. %s", moveNumber, g.moves[i].san)
+	}
+
+	return fmt.Sprintf("%d... %s", moveNumber, g.moves[i].san)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// getSAN returns the Standard Algebraic Notation for a legal move in the position. A move that wins
+// by a variant's own rules is marked as mate.
+func getSAN(p position, m move) string {
+	var san string
+	if m.isDrop {
+		san = m.String()
+	} else if m.isCastling {
+		if m.toSquare.file == "G" {
+			san = "O-O"
+		} else {
+			san = "O-O-O"
+		}
+	} else if m.piece.getName() == "P" {
+		if m.isCapture() {
+			san = strings.ToLower(m.fromSquare.file) + "x"
+		}
+		san += getNotationForSquare(m.toSquare)
+		if m.promotion != "" {
+			san += "=" + m.promotion
+		}
+	} else {
+		san = m.piece.getName() + getSANDisambiguation(p, m)
+		if m.isCapture() {
+			san += "x"
+		}
+		san += getNotationForSquare(m.toSquare)
+	}
+
+	after := p
+	after.makeMove(m)
+	// Only a move that wins is marked as mate: in antichess, leaving the other side without
+	// pieces or moves loses.
+	if winner, _ := after.getVariantWin(); after.isCheckMate() || winner == p.sideToMove {
+		san += "#"
+	} else if after.isKingInCheck() {
+		san += "+"
+	}
+
+	return san
+}
+
+// getSANDisambiguation returns the file, rank or square of the moving piece that's needed to tell
+// it apart from other pieces of the same type and colour that could legally move to the same
+// square. Returns an empty string if there are no such pieces.
+func getSANDisambiguation(p position, m move) string {
+	var others []square
+	for _, other := range generateLegalMoves(p) {
+		if !other.isDrop && other.piece.getName() == m.piece.getName() && areSquaresEqual(other.toSquare, m.toSquare) &&
+			!areSquaresEqual(other.fromSquare, m.fromSquare) {
+			others = append(others, other.fromSquare)
+		}
+	}
+
+	if len(others) == 0 {
+		return ""
+	}
+
+	sameFile, sameRank := false, false
+	for _, sq := range others {
+		sameFile = sameFile || sq.file == m.fromSquare.file
+		sameRank = sameRank || sq.rank == m.fromSquare.rank
+	}
+
+	if !sameFile {
+		return strings.ToLower(m.fromSquare.file)
+	}
+
+	if !sameRank {
+		return fmt.Sprintf("%d", m.fromSquare.rank)
+	}
+
+	return getNotationForSquare(m.fromSquare)
+}
+
+type sanMove struct {
+	name       string
+	fromFile   string
+	fromRank   int
+	toSquare   square
+	promotion  string
+	isCapture  bool
+	isCastling bool
+	isLong     bool
+	isDrop     bool
+}
+
+// parseSAN breaks a move written in Standard Algebraic Notation into its parts, without checking
+// it against any position. Check and mate indicators and move annotations such as "!?" are
+// accepted and ignored. A crazyhouse drop is written as the piece, @ and the square, e.g. N@f3,
+// where the P of a pawn may be left off.
+func parseSAN(san string) (sanMove, error) {
+	s := strings.TrimRight(san, "+#!?")
+	if s == "" {
+		return sanMove{}, fmt.Errorf("Move '%s' not valid.", san)
+	}
+
+	switch s {
+	case "O-O", "0-0":
+		return sanMove{name: "K", isCastling: true}, nil
+	case "O-O-O", "0-0-0":
+		return sanMove{name: "K", isCastling: true, isLong: true}, nil
+	}
+
+	if name, to, ok := strings.Cut(s, "@"); ok {
+		if name == "" {
+			name = "P"
+		}
+		if len(name) != 1 || !strings.Contains(pocketPieceNames, name) {
+			return sanMove{}, fmt.Errorf("Move '%s' not valid (can only drop Q, R, B, N or P).", san)
+		}
+
+		toSquare, err := getSquareFromNotation(to)
+		if err != nil {
+			return sanMove{}, fmt.Errorf("Move '%s' not valid (no destination square).", san)
+		}
+
+		return sanMove{name: name, toSquare: toSquare, isDrop: true}, nil
+	}
+
+	m := sanMove{name: "P"}
+
+	if i := strings.Index(s, "="); i >= 0 {
+		m.promotion = s[i+1:]
+		s = s[:i]
+	}
+
+	if strings.ContainsAny(s[0:1], "KQRBN") {
+		m.name = s[0:1]
+		s = s[1:]
+	}
+
+	if len(s) < 2 {
+		return sanMove{}, fmt.Errorf("Move '%s' not valid (no destination square).", san)
+	}
+
+	toSquare, err := getSquareFromNotation(s[len(s)-2:])
+	if err != nil {
+		return sanMove{}, fmt.Errorf("Move '%s' not valid (no destination square).", san)
+	}
+	m.toSquare = toSquare
+	s = s[:len(s)-2]
+
+	if strings.HasSuffix(s, "x") {
+		m.isCapture = true
+		s = s[:len(s)-1]
+	}
+
+	// Anything left must be the file and/or rank the piece is moving from.
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'h' && m.fromFile == "" && m.fromRank == 0:
+			m.fromFile = strings.ToUpper(string(c))
+		case c >= '1' && c <= '8' && m.fromRank == 0:
+			m.fromRank = int(c - '0')
+		default:
+			return sanMove{}, fmt.Errorf("Move '%s' not valid.", san)
+		}
+	}
+
+	if m.name == "P" && m.fromFile == "" {
+		if m.isCapture {
+			return sanMove{}, fmt.Errorf("Move '%s' not valid (pawn captures must give the file the pawn is moving from).", san)
+		}
+
+		m.fromFile = m.toSquare.file
+	}
+
+	if m.promotion != "" && m.name != "P" {
+		return sanMove{}, fmt.Errorf("Move '%s' not valid (only pawns can be promoted).", san)
+	}
+
+	return m, nil
+}
+
+// resolveSAN finds the legal move in the position that a move written in Standard Algebraic
+// Notation describes.
+func resolveSAN(p position, san string) (move, error) {
+	m, err := resolveSANMove(p, san)
+	if err == errNoPromotionPiece {
+		return move{}, fmt.Errorf("Move '%s' not valid (a pawn reaching the last rank must be promoted, e.g. %s=Q).", san, getNotationForSquare(m.toSquare))
+	}
+
+	return m, err
+}
+
+// resolveSANMove is resolveSAN, except that a pawn's move to the last rank without the piece it's
+// promoted to is returned with errNoPromotionPiece, so that the piece can be asked for separately.
+func resolveSANMove(p position, san string) (move, error) {
+	sm, err := parseSAN(san)
+	if err != nil {
+		return move{}, err
+	}
+
+	if names := p.variant.getPromotionPieceNames(); sm.promotion != "" && !slices.Contains(names, sm.promotion) {
+		return move{}, fmt.Errorf("Move '%s' not valid (can only promote to %s).", san, listPieceNames(names))
+	}
+
+	color := p.sideToMove
+	moves := generateLegalMoves(p)
+	var candidates []move
+	for _, m := range moves {
+		if m.piece.getName() != sm.name || m.isCastling != sm.isCastling || m.isDrop != sm.isDrop {
+			continue
+		}
+
+		if sm.isCastling {
+			if isLong := m.toSquare.file == "C"; isLong == sm.isLong {
+				candidates = append(candidates, m)
+			}
+			continue
+		}
+
+		if areSquaresEqual(m.toSquare, sm.toSquare) &&
+			(sm.fromFile == "" || sm.fromFile == m.fromSquare.file) && (sm.fromRank == 0 || sm.fromRank == m.fromSquare.rank) {
+			candidates = append(candidates, m)
+		}
+	}
+
+	if len(candidates) == 0 {
+		if sm.isCastling {
+			side := "kingside"
+			if sm.isLong {
+				side = "queenside"
+			}
+			return move{}, fmt.Errorf("Move '%s' not legal (the %s king can't castle %s).", san, getColorName(color), side)
+		}
+
+		if sm.isDrop {
+			return move{}, fmt.Errorf("Move '%s' not legal (no %s %s can be dropped on %s).", san, getColorName(color), getPieceDescription(sm.name), getNotationForSquare(sm.toSquare))
+		}
+
+		if !sm.isCapture && p.isCaptureCompulsory(moves) {
+			return move{}, fmt.Errorf("Move '%s' not legal (a capture can be made, so one must be).", san)
+		}
+
+		return move{}, fmt.Errorf("Move '%s' not legal (no %s %s can move to %s).", san, getColorName(color), getPieceDescription(sm.name), getNotationForSquare(sm.toSquare))
+	}
+
+	// Promotions are generated once for each promotion piece, so they have to be told apart
+	// from moves by different pieces.
+	var from []string
+	for _, m := range candidates {
+		if len(from) == 0 || from[len(from)-1] != getNotationForSquare(m.fromSquare) {
+			from = append(from, getNotationForSquare(m.fromSquare))
+		}
+	}
+
+	if len(from) > 1 {
+		return move{}, fmt.Errorf("Move '%s' is ambiguous (%ss on %s can all move to %s).", san, getPieceDescription(sm.name), strings.Join(from, ", "), getNotationForSquare(sm.toSquare))
+	}
+
+	isPromotion := candidates[0].promotion != ""
+	if isPromotion && sm.promotion == "" {
+		m := candidates[0]
+		m.promotion = ""
+		return m, errNoPromotionPiece
+	}
+
+	if !isPromotion && sm.promotion != "" {
+		return move{}, fmt.Errorf("Move '%s' not valid (a pawn can only be promoted on the last rank).", san)
+	}
+
+	for _, m := range candidates {
+		if m.promotion == sm.promotion {
+			return m, nil
+		}
+	}
+
+	return candidates[0], nil
+}
+
+func getColorName(color string) string {
+	if color == "W" {
+		return "white"
+	}
+
+	return "black"
+}
+
+func getPieceDescription(name string) string {
+	switch name {
+	case "K":
+		return "king"
+	case "Q":
+		return "queen"
+	case "R":
+		return "rook"
+	case "B":
+		return "bishop"
+	case "N":
+		return "knight"
+	default:
+		return "pawn"
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetSAN(t *testing.T) {
+	tests := []struct {
+		fen       string
+		from      string
+		to        string
+		promotion string
+		expected  string
+	}{
+		{StartingFEN, "e2", "e4", "", "e4"},
+		{StartingFEN, "g1", "f3", "", "Nf3"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", "e4", "d5", "", "exd5"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "e5", "f6", "", "exf6"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "e1", "g1", "", "O-O"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "e8", "c8", "", "O-O-O"},
+		{"4k3/8/8/8/8/8/8/R2RK3 w - - 0 1", "a1", "b1", "", "Rab1"},
+		{"4k3/8/8/8/4K3/8/8/R2r3R w - - 0 1", "a1", "d1", "", "Raxd1"},
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "a1", "a3", "", "R1a3"},
+		{"2k5/8/8/8/4Q2Q/8/8/K6Q w - - 0 1", "h4", "e1", "", "Qh4e1"},
+		{"4k3/8/8/8/8/2Q1Q3/8/2Q1K3 w - - 0 1", "e3", "d2", "", "Qed2"},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7", "e8", "Q", "e8=Q+"},
+		{"3r1k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e7", "d8", "N", "exd8=N"},
+		{"rnbqkbnr/ppppp2p/5p2/6p1/3PP3/8/PPP2PPP/RNBQKBNR w KQkq g6 0 3", "d1", "h5", "", "Qh5#"},
+		{"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2", "f1", "b5", "", "Bb5"},
+	}
+
+	for _, test := range tests {
+		p, err := parseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		from, _ := getSquareFromNotation(test.from)
+		to, _ := getSquareFromNotation(test.to)
+		m, err := findLegalMove(p, from, to, test.promotion)
+		if err != nil {
+			t.Errorf("Unexpected error finding move %s%s%s in %s: %s", test.from, test.to, test.promotion, test.fen, err)
+			continue
+		}
+
+		res := getSAN(p, m)
+		if res != test.expected {
+			t.Errorf("Expected SAN for %s%s%s in %s to be %s, but got: %s", test.from, test.to, test.promotion, test.fen, test.expected, res)
+		}
+	}
+}
+
+func TestResolveSAN(t *testing.T) {
+	tests := []struct {
+		fen       string
+		san       string
+		from      string
+		to        string
+		promotion string
+	}{
+		{StartingFEN, "e4", "e2", "e4", ""},
+		{StartingFEN, "Nf3", "g1", "f3", ""},
+		{StartingFEN, "Nf3!?", "g1", "f3", ""},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", "exd5", "e4", "d5", ""},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O", "e1", "g1", ""},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "0-0-0", "e8", "c8", ""},
+		{"4k3/8/8/8/4K3/8/8/R2r3R w - - 0 1", "Raxd1", "a1", "d1", ""},
+		{"2k5/8/8/8/4Q2Q/8/8/K6Q w - - 0 1", "Qh4e1", "h4", "e1", ""},
+		{"3r1k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "exd8=N", "e7", "d8", "N"},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8=Q+", "e7", "e8", "Q"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		m, err := resolveSAN(p, test.san)
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s in %s: %s", test.san, test.fen, err)
+			continue
+		}
+
+		if getNotationForSquare(m.fromSquare) != test.from || getNotationForSquare(m.toSquare) != test.to || m.promotion != test.promotion {
+			t.Errorf("Expected %s in %s to resolve to %s%s%s, but got: %v", test.san, test.fen, test.from, test.to, test.promotion, m)
+		}
+	}
+}
+
+func TestResolveSANErrors(t *testing.T) {
+	tests := []struct {
+		fen      string
+		san      string
+		contains string
+	}{
+		{StartingFEN, "e5", "no white pawn can move to e5"},
+		{StartingFEN, "Nd2", "no white knight can move to d2"},
+		{StartingFEN, "O-O", "the white king can't castle kingside"},
+		{StartingFEN, "Zf3", "not valid"},
+		{StartingFEN, "xe4", "not valid"},
+		{StartingFEN, "e4=Q", "can only be promoted on the last rank"},
+		{"4k3/8/8/8/4K3/8/8/R2r3R w - - 0 1", "Rxd1", "ambiguous (rooks on a1, h1 can all move to d1)"},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8", "must be promoted"},
+		{"5k2/4P3/8/8/8/8/8/4K3 w - - 0 1", "e8=K", "can only promote to Q, R, B or N"},
+		{"4k3/8/8/8/8/8/4r3/4K2N w - - 0 1", "Ng3", "no white knight can move to g3"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		_, err := resolveSAN(p, test.san)
+		if err == nil {
+			t.Errorf("Expected error resolving %s in %s but got none", test.san, test.fen)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.contains) {
+			t.Errorf("Expected error resolving %s in %s to contain \"%s\", but got: %s", test.san, test.fen, test.contains, err)
+		}
+	}
+}
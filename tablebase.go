@@ -0,0 +1,1092 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Syzygy endgame tablebases give the result of every position with few enough pieces, with
+// perfect play. Each set of pieces has two files: a .rtbw file with the win/draw/loss (WDL)
+// result, and a .rtbz file with the distance to zeroing (DTZ), the number of plies to the next
+// capture or pawn move on the way to the result, which is what's needed to make progress towards
+// a win without falling foul of the fifty-move rule. The files are compressed, and read here as
+// Stockfish and Ronald de Man's original prober read them.
+
+// tbMaxPieces is the most pieces any Syzygy table has.
+const tbMaxPieces = 7
+
+// WDL results, from the side to move's point of view. A cursed win is one that can't be won
+// within the fifty-move rule, and a blessed loss one that can be drawn by it.
+const (
+	tbLoss        = -2
+	tbBlessedLoss = -1
+	tbDraw        = 0
+	tbCursedWin   = 1
+	tbWin         = 2
+)
+
+// Flags for each table in a file.
+const (
+	tbFlagSideToMove  = 1
+	tbFlagMapped      = 2
+	tbFlagWinPlies    = 4
+	tbFlagLossPlies   = 8
+	tbFlagWide        = 16
+	tbFlagSingleValue = 128
+)
+
+var (
+	tbWDLMagic = []byte{0x71, 0xe8, 0x23, 0x5d}
+	tbDTZMagic = []byte{0xd7, 0x66, 0x0c, 0xa5}
+
+	tbNamePattern = regexp.MustCompile(`^K[QRBNP]*vK[QRBNP]*$`)
+)
+
+// Tables for working out the index of a position in a table. Squares below the a1-h8 diagonal are
+// numbered 0-27 by mapB1H1H7, and squares in the a1-d1-d4 triangle 0-9 by mapA1D1D4. mapKK numbers
+// the 462 ways to place the kings with the first in the triangle. mapPawns numbers the squares a
+// pawn can be on, most towards the edge and lowest first, leadPawnIdx the ways to place the leading
+// pawns with the first on a square, and leadPawnsSize the ways with the first on each file.
+var (
+	mapB1H1H7     [64]int
+	mapA1D1D4     [64]int
+	mapKK         [10][64]int
+	mapPawns      [64]int
+	binomial      [tbMaxPieces][64]uint64
+	leadPawnIdx   [tbMaxPieces][64]uint64
+	leadPawnsSize [tbMaxPieces][4]uint64
+)
+
+func init() {
+	code := 0
+	for sq := 0; sq < 64; sq++ {
+		if getDiagonalOffset(sq) < 0 {
+			mapB1H1H7[sq] = code
+			code++
+		}
+	}
+
+	// Squares on the diagonal come after those below it.
+	var diagonal []int
+	code = 0
+	for sq := 0; sq <= 27; sq++ {
+		if sq%8 > 3 {
+			continue
+		}
+
+		if getDiagonalOffset(sq) < 0 {
+			mapA1D1D4[sq] = code
+			code++
+		} else if getDiagonalOffset(sq) == 0 {
+			diagonal = append(diagonal, sq)
+		}
+	}
+	for _, sq := range diagonal {
+		mapA1D1D4[sq] = code
+		code++
+	}
+
+	// With the first king on the diagonal, the second is never above it, and positions with both
+	// on the diagonal come last.
+	var bothOnDiagonal [][2]int
+	code = 0
+	for idx := 0; idx < 10; idx++ {
+		for sq1 := 0; sq1 <= 27; sq1++ {
+			if sq1%8 > 3 || mapA1D1D4[sq1] != idx || idx == 0 && sq1 != 1 {
+				continue
+			}
+
+			for sq2 := 0; sq2 < 64; sq2++ {
+				switch {
+				case sq1 == sq2 || kingAttacks[sq1]&(1<<uint(sq2)) != 0:
+					continue
+				case getDiagonalOffset(sq1) == 0 && getDiagonalOffset(sq2) > 0:
+					continue
+				case getDiagonalOffset(sq1) == 0 && getDiagonalOffset(sq2) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, [2]int{idx, sq2})
+				default:
+					mapKK[idx][sq2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, kings := range bothOnDiagonal {
+		mapKK[kings[0]][kings[1]] = code
+		code++
+	}
+
+	binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < tbMaxPieces && k <= n; k++ {
+			if k > 0 {
+				binomial[k][n] += binomial[k-1][n-1]
+			}
+			if k < n {
+				binomial[k][n] += binomial[k][n-1]
+			}
+		}
+	}
+
+	available := 47
+	for count := 1; count < tbMaxPieces; count++ {
+		for file := 0; file < 4; file++ {
+			var idx uint64
+			for rank := 1; rank < 7; rank++ {
+				sq := rank*8 + file
+				if count == 1 {
+					mapPawns[sq] = available
+					mapPawns[sq^7] = available - 1
+					available -= 2
+				}
+
+				leadPawnIdx[count][sq] = idx
+				idx += binomial[count-1][mapPawns[sq]]
+			}
+			leadPawnsSize[count][file] = idx
+		}
+	}
+}
+
+// getDiagonalOffset returns how far above the a1-h8 diagonal a square is, negative if it's below.
+func getDiagonalOffset(sq int) int {
+	return sq/8 - sq%8
+}
+
+// tablebase is a set of Syzygy tables, found in one or more directories. Each file is read the
+// first time it's needed.
+type tablebase struct {
+	tables    map[string]*tbTable
+	maxPieces int
+}
+
+// tbTable is the pair of files for a set of pieces. Its key is its name, e.g. KRvK, with white's
+// pieces first, and key2 the same with the colours swapped, which share the table.
+type tbTable struct {
+	key             string
+	key2            string
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	pawnCount       [2]int
+	wdl             tbFile
+	dtz             tbFile
+}
+
+type tbFile struct {
+	path   string
+	once   sync.Once
+	err    error
+	data   []byte
+	sides  int
+	pairs  [2][4]tbPairs
+	dtzMap int
+}
+
+// tbPairs is a table of positions compressed by recursive pairing: each symbol stands for a pair
+// of symbols or a value, and the symbols are Huffman coded in blocks. Positions with pawns have a
+// table for each file the leading pawn can be on, and for each side to move unless the table is
+// symmetric or it's a DTZ table. Positions are mapped to their index in the table by placing the
+// pieces in groups, in the order given by pieces.
+type tbPairs struct {
+	flags           uint8
+	constValue      int
+	blockSize       uint
+	idxBits         uint
+	numBlocks       int
+	blockLengthSize int
+	numIndices      uint64
+	minLen          int
+	lowestSym       int
+	btree           int
+	base            []uint64
+	symLen          []int
+	sparseIndex     int
+	blockLength     int
+	blocks          int
+	pieces          [tbMaxPieces]int
+	groupLen        [tbMaxPieces + 1]int
+	groupIdx        [tbMaxPieces + 1]uint64
+	mapIdx          [4]int
+}
+
+// newTablebase finds the tables in the given directories, separated as in the PATH environment
+// variable.
+func newTablebase(dirs string) (*tablebase, error) {
+	tb := &tablebase{tables: map[string]*tbTable{}}
+	for _, dir := range filepath.SplitList(dirs) {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.rtbw"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range paths {
+			name := strings.TrimSuffix(filepath.Base(path), ".rtbw")
+			if !tbNamePattern.MatchString(name) || len(name)-1 > tbMaxPieces {
+				continue
+			}
+
+			t := newTBTable(name)
+			t.wdl.path = path
+			t.dtz.path = strings.TrimSuffix(path, ".rtbw") + ".rtbz"
+			tb.tables[t.key] = t
+			tb.tables[t.key2] = t
+			if t.pieceCount > tb.maxPieces {
+				tb.maxPieces = t.pieceCount
+			}
+		}
+	}
+
+	if len(tb.tables) == 0 {
+		return nil, fmt.Errorf("No Syzygy tables found in %s.", dirs)
+	}
+
+	return tb, nil
+}
+
+func newTBTable(name string) *tbTable {
+	sides := strings.Split(name, "v")
+	t := &tbTable{key: name, key2: sides[1] + "v" + sides[0], pieceCount: len(name) - 1}
+	t.hasPawns = strings.Contains(name, "P")
+	for _, side := range sides {
+		for _, pieceName := range "QRBN" {
+			if strings.Count(side, string(pieceName)) == 1 {
+				t.hasUniquePieces = true
+			}
+		}
+	}
+
+	// The leading pawns are those of the side with fewer pawns, unless it has none, which gives
+	// the better compression.
+	whitePawns, blackPawns := strings.Count(sides[0], "P"), strings.Count(sides[1], "P")
+	t.pawnCount = [2]int{whitePawns, blackPawns}
+	if blackPawns > 0 && (whitePawns == 0 || blackPawns < whitePawns) {
+		t.pawnCount = [2]int{blackPawns, whitePawns}
+	}
+
+	return t
+}
+
+// getMaterialKey returns the name of the table for the pieces in the position, e.g. KRvK, with
+// white's pieces first.
+func getMaterialKey(bp *bitboardPosition) string {
+	var key strings.Builder
+	for color := white; color <= black; color++ {
+		if color == black {
+			key.WriteByte('v')
+		}
+		for _, pieceType := range []int{kingType, queenType, rookType, bishopType, knightType, pawnType} {
+			for i := bits.OnesCount64(uint64(bp.pieces[color][pieceType])); i > 0; i-- {
+				key.WriteByte(pieceTypeNames[pieceType])
+			}
+		}
+	}
+
+	return key.String()
+}
+
+// load reads and sets up the file, the first time it's called.
+func (f *tbFile) load(t *tbTable, isWDL bool) error {
+	f.once.Do(func() {
+		f.err = f.read(t, isWDL)
+		if f.err != nil {
+			f.data = nil
+		}
+	})
+
+	return f.err
+}
+
+func (f *tbFile) read(t *tbTable, isWDL bool) error {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	magic := tbDTZMagic
+	if isWDL {
+		magic = tbWDLMagic
+	}
+
+	if len(data)%64 != 16 || string(data[:4]) != string(magic) {
+		return fmt.Errorf("%s isn't a valid Syzygy table.", f.path)
+	}
+
+	f.data = data
+	f.sides = 1
+	if isWDL && t.key != t.key2 {
+		f.sides = 2
+	}
+
+	files := 1
+	if t.hasPawns {
+		files = 4
+	}
+
+	// After the magic and a byte of flags come the order the groups of pieces are encoded in and
+	// the pieces themselves, for each file and side to move.
+	pos := 5
+	bothPawns := t.hasPawns && t.pawnCount[1] > 0
+	for file := 0; file < files; file++ {
+		order := [2][2]int{{int(data[pos] & 0xf), 0xf}, {int(data[pos] >> 4), 0xf}}
+		if bothPawns {
+			order[0][1], order[1][1] = int(data[pos+1]&0xf), int(data[pos+1]>>4)
+			pos++
+		}
+		pos++
+
+		for k := 0; k < t.pieceCount; k++ {
+			f.pairs[0][file].pieces[k] = int(data[pos] & 0xf)
+			f.pairs[1][file].pieces[k] = int(data[pos] >> 4)
+			pos++
+		}
+
+		for i := 0; i < f.sides; i++ {
+			f.pairs[i][file].setGroups(t, order[i], file)
+		}
+	}
+	pos += pos & 1
+
+	for file := 0; file < files; file++ {
+		for i := 0; i < f.sides; i++ {
+			pos = f.setSizes(&f.pairs[i][file], pos, isWDL)
+		}
+	}
+
+	if !isWDL {
+		pos = f.setDTZMap(pos, files)
+	}
+
+	for file := 0; file < files; file++ {
+		for i := 0; i < f.sides; i++ {
+			f.pairs[i][file].sparseIndex = pos
+			pos += int(f.pairs[i][file].numIndices) * 6
+		}
+	}
+
+	for file := 0; file < files; file++ {
+		for i := 0; i < f.sides; i++ {
+			f.pairs[i][file].blockLength = pos
+			pos += f.pairs[i][file].blockLengthSize * 2
+		}
+	}
+
+	// The blocks of each table start on a 64 byte boundary.
+	for file := 0; file < files; file++ {
+		for i := 0; i < f.sides; i++ {
+			if d := &f.pairs[i][file]; d.numBlocks > 0 {
+				pos = (pos + 0x3f) &^ 0x3f
+				d.blocks = pos
+				pos += d.numBlocks << d.blockSize
+			}
+		}
+	}
+
+	if pos > len(data) {
+		return fmt.Errorf("%s isn't a valid Syzygy table.", f.path)
+	}
+
+	return nil
+}
+
+// setGroups works out how the pieces are grouped: the first group is the leading pawns, the kings,
+// or the kings and another piece if there's a piece of which there's only one, and the rest are
+// pieces of the same type and colour. A position's index is made up of the index of each group's
+// placement, in the given order, multiplied by the number of placements of the groups after it.
+func (d *tbPairs) setGroups(t *tbTable, order [2]int, file int) {
+	firstLen := 2
+	if t.hasPawns {
+		firstLen = 0
+	} else if t.hasUniquePieces {
+		firstLen = 3
+	}
+
+	n := 0
+	d.groupLen[0] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0
+
+	bothPawns := t.hasPawns && t.pawnCount[1] > 0
+	next := 1
+	freeSquares := 64 - d.groupLen[0]
+	if bothPawns {
+		next = 2
+		freeSquares -= d.groupLen[1]
+	}
+
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch {
+		case k == order[0]:
+			d.groupIdx[0] = idx
+			switch {
+			case t.hasPawns:
+				idx *= leadPawnsSize[d.groupLen[0]][file]
+			case t.hasUniquePieces:
+				idx *= 31332
+			default:
+				idx *= 462
+			}
+		case k == order[1]:
+			d.groupIdx[1] = idx
+			idx *= binomial[d.groupLen[1]][48-d.groupLen[0]]
+		default:
+			d.groupIdx[next] = idx
+			idx *= binomial[d.groupLen[next]][freeSquares]
+			freeSquares -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx
+}
+
+// size returns the number of positions in the table, which is the index of the group after the
+// last.
+func (d *tbPairs) size() uint64 {
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	return d.groupIdx[n]
+}
+
+// setSizes reads the header of a compressed table, returning where the next one starts.
+func (f *tbFile) setSizes(d *tbPairs, pos int, isWDL bool) int {
+	data := f.data
+	d.flags = data[pos]
+	if d.flags&tbFlagSingleValue != 0 {
+		if isWDL {
+			d.constValue = int(data[pos+1])
+		}
+		return pos + 2
+	}
+
+	d.blockSize = uint(data[pos+1])
+	d.idxBits = uint(data[pos+2])
+	span := uint64(1) << d.idxBits
+	d.numIndices = (d.size() + span - 1) / span
+	d.numBlocks = int(binary.LittleEndian.Uint32(data[pos+4:]))
+	d.blockLengthSize = d.numBlocks + int(data[pos+3])
+	maxLen, minLen := int(data[pos+8]), int(data[pos+9])
+	d.minLen = minLen
+	d.lowestSym = pos + 10
+
+	// The lowest symbol of each code length gives the Huffman codes' bases.
+	d.base = make([]uint64, maxLen-minLen+1)
+	for i := len(d.base) - 2; i >= 0; i-- {
+		d.base[i] = (d.base[i+1] + uint64(f.readUint16(d.lowestSym+2*i)) - uint64(f.readUint16(d.lowestSym+2*i+2))) / 2
+	}
+	for i := range d.base {
+		d.base[i] <<= uint(64 - i - minLen)
+	}
+
+	pos = d.lowestSym + 2*len(d.base)
+	d.symLen = make([]int, f.readUint16(pos))
+	d.btree = pos + 2
+	visited := make([]bool, len(d.symLen))
+	for sym := range d.symLen {
+		if !visited[sym] {
+			f.setSymLen(d, sym, visited)
+		}
+	}
+
+	return d.btree + 3*len(d.symLen) + len(d.symLen)&1
+}
+
+// setSymLen works out how many values, less one, a symbol stands for.
+func (f *tbFile) setSymLen(d *tbPairs, sym int, visited []bool) {
+	visited[sym] = true
+	left, right := f.getSymbolPair(d, sym)
+	if right == 0xfff {
+		return
+	}
+
+	for _, s := range []int{left, right} {
+		if !visited[s] {
+			f.setSymLen(d, s, visited)
+		}
+	}
+	d.symLen[sym] = d.symLen[left] + d.symLen[right] + 1
+}
+
+// getSymbolPair returns the two symbols a symbol stands for. If it stands for a value instead, the
+// value is the first, and the second is 0xfff.
+func (f *tbFile) getSymbolPair(d *tbPairs, sym int) (int, int) {
+	b := f.data[d.btree+3*sym:]
+	return int(b[1]&0xf)<<8 | int(b[0]), int(b[2])<<4 | int(b[1]>>4)
+}
+
+// setDTZMap reads the maps DTZ tables may have from their stored values to the real ones, which
+// differ for each WDL result.
+func (f *tbFile) setDTZMap(pos int, files int) int {
+	f.dtzMap = pos
+	for file := 0; file < files; file++ {
+		d := &f.pairs[0][file]
+		if d.flags&tbFlagMapped == 0 {
+			continue
+		}
+
+		for i := 0; i < 4; i++ {
+			if d.flags&tbFlagWide != 0 {
+				pos += pos & 1
+				d.mapIdx[i] = (pos-f.dtzMap)/2 + 1
+				pos += 2*int(f.readUint16(pos)) + 2
+			} else {
+				d.mapIdx[i] = pos - f.dtzMap + 1
+				pos += int(f.data[pos]) + 1
+			}
+		}
+	}
+
+	return pos + pos&1
+}
+
+func (f *tbFile) readUint16(pos int) uint16 {
+	return binary.LittleEndian.Uint16(f.data[pos:])
+}
+
+// decompress returns the value stored at the given index of a table.
+func (f *tbFile) decompress(d *tbPairs, idx uint64) int {
+	if d.flags&tbFlagSingleValue != 0 {
+		return d.constValue
+	}
+
+	// The sparse index gives the block and offset in it of every span'th index, and the blocks'
+	// lengths lead from there to the index wanted.
+	span := uint64(1) << d.idxBits
+	entry := d.sparseIndex + 6*int(idx/span)
+	block := int(binary.LittleEndian.Uint32(f.data[entry:]))
+	offset := int(f.readUint16(entry+4)) + int(idx%span) - int(span/2)
+	for offset < 0 {
+		block--
+		offset += int(f.readUint16(d.blockLength+2*block)) + 1
+	}
+	for offset > int(f.readUint16(d.blockLength+2*block)) {
+		offset -= int(f.readUint16(d.blockLength+2*block)) + 1
+		block++
+	}
+
+	// Read symbols from the block until reaching the one that stands for the value at the offset.
+	pos := d.blocks + block<<d.blockSize
+	buf := binary.BigEndian.Uint64(f.data[pos:])
+	pos += 8
+	bufSize := 64
+	var sym int
+	for {
+		length := 0
+		for buf < d.base[length] {
+			length++
+		}
+
+		sym = int((buf-d.base[length])>>uint(64-length-d.minLen)) + int(f.readUint16(d.lowestSym+2*length))
+		if offset < d.symLen[sym]+1 {
+			break
+		}
+
+		offset -= d.symLen[sym] + 1
+		length += d.minLen
+		buf <<= uint(length)
+		bufSize -= length
+		if bufSize <= 32 {
+			bufSize += 32
+			buf |= uint64(binary.BigEndian.Uint32(f.data[pos:])) << uint(64-bufSize)
+			pos += 4
+		}
+	}
+
+	// Then expand the symbol into the pair it stands for until reaching a value.
+	for d.symLen[sym] != 0 {
+		left, right := f.getSymbolPair(d, sym)
+		if offset < d.symLen[left]+1 {
+			sym = left
+		} else {
+			offset -= d.symLen[left] + 1
+			sym = right
+		}
+	}
+
+	value, _ := f.getSymbolPair(d, sym)
+	return value
+}
+
+// tbProbeState says how a probe went: whether the table gave the result, or the result came from
+// a zeroing move instead, or the position must be probed from the other side's point of view.
+type tbProbeState int
+
+const (
+	tbProbeFailed tbProbeState = iota
+	tbProbeOK
+	tbProbeChangeSideToMove
+	tbProbeZeroingBestMove
+)
+
+// probeTable looks up the position's value in its WDL or DTZ table. For DTZ, the position's WDL
+// result must be given.
+func (tb *tablebase) probeTable(bp *bitboardPosition, isWDL bool, wdl int) (int, tbProbeState) {
+	if bits.OnesCount64(uint64(bp.occupied[white]|bp.occupied[black])) == 2 {
+		return tbDraw, tbProbeOK
+	}
+
+	key := getMaterialKey(bp)
+	t := tb.tables[key]
+	if t == nil {
+		return 0, tbProbeFailed
+	}
+
+	f := &t.dtz
+	if isWDL {
+		f = &t.wdl
+	}
+	if f.load(t, isWDL) != nil {
+		return 0, tbProbeFailed
+	}
+
+	d, idx := f.getIndex(t, bp, key, isWDL)
+	if d == nil {
+		return 0, tbProbeChangeSideToMove
+	}
+
+	value := f.decompress(d, idx)
+	if isWDL {
+		return value - 2, tbProbeOK
+	}
+
+	return f.getDTZ(d, value, wdl), tbProbeOK
+}
+
+// getIndex returns the compressed table a position is in, and its index there, given the name of
+// the table for its pieces with white's first. The table is nil if the file is a DTZ file for the
+// other side to move.
+func (f *tbFile) getIndex(t *tbTable, bp *bitboardPosition, key string, isWDL bool) (*tbPairs, uint64) {
+	// Tables are for white having the pieces of the first part of the table's name, and symmetric
+	// tables only for white to move, so otherwise the colours are swapped and the board flipped.
+	flip := key != t.key || t.key == t.key2 && bp.sideToMove == black
+	flipColor, flipSquares, sideToMove := 0, 0, bp.sideToMove
+	if flip {
+		flipColor, flipSquares, sideToMove = 8, 56, sideToMove^1
+	}
+
+	var squares, pieces [tbMaxPieces]int
+	size := 0
+	var leadPawns bitboard
+	file := 0
+	if t.hasPawns {
+		// The leading pawn is the one nearest the edge and then the lowest, and which file it's on
+		// decides which table the position is in.
+		color := (f.pairs[0][0].pieces[0] ^ flipColor) >> 3
+		leadPawns = bp.pieces[color][pawnType]
+		for b := leadPawns; b != 0; size++ {
+			squares[size] = popLowestSquare(&b) ^ flipSquares
+		}
+
+		lead := 0
+		for i := 1; i < size; i++ {
+			if mapPawns[squares[i]] > mapPawns[squares[lead]] {
+				lead = i
+			}
+		}
+		squares[0], squares[lead] = squares[lead], squares[0]
+		file = squares[0] % 8
+		if file > 3 {
+			file = 7 - file
+		}
+	}
+	leadPawnsCount := size
+
+	// DTZ tables are only for one side to move.
+	if !isWDL && f.pairs[0][file].flags&tbFlagSideToMove != uint8(sideToMove) && (t.key != t.key2 || t.hasPawns) {
+		return nil, 0
+	}
+
+	for b := (bp.occupied[white] | bp.occupied[black]) &^ leadPawns; b != 0; size++ {
+		sq := popLowestSquare(&b)
+		squares[size] = sq ^ flipSquares
+		pc := bp.squares[sq]
+		pieces[size] = (pc.color()*8 + pc.pieceType() + 1) ^ flipColor
+	}
+
+	d := &f.pairs[sideToMove%f.sides][file]
+
+	// Put the pieces in the order the table has them in.
+	for i := leadPawnsCount; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// Mirror the board so that the first piece is on the a-d files.
+	if squares[0]%8 > 3 {
+		for i := 0; i < size; i++ {
+			squares[i] ^= 7
+		}
+	}
+
+	var idx uint64
+	if t.hasPawns {
+		idx = leadPawnIdx[leadPawnsCount][squares[0]]
+		others := squares[1:leadPawnsCount]
+		sort.SliceStable(others, func(i, j int) bool { return mapPawns[others[i]] < mapPawns[others[j]] })
+		for i := 1; i < leadPawnsCount; i++ {
+			idx += binomial[i][mapPawns[squares[i]]]
+		}
+	} else {
+		idx = getPiecesIndex(t, d, squares[:size])
+	}
+
+	// Then add the index of each of the other groups, placed on the squares the earlier groups
+	// don't take up.
+	idx *= d.groupIdx[0]
+	start := d.groupLen[0]
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[start : start+d.groupLen[next]]
+		sort.Ints(group)
+
+		var n uint64
+		for i, sq := range group {
+			adjust := 0
+			for _, earlier := range squares[:start] {
+				if sq > earlier {
+					adjust++
+				}
+			}
+			if remainingPawns {
+				adjust += 8
+			}
+			n += binomial[i+1][sq-adjust]
+		}
+
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		start += d.groupLen[next]
+	}
+
+	return d, idx
+}
+
+// getPiecesIndex returns the index of the placement of the first group of pieces in a table
+// without pawns, mirroring the board so that the first piece is in the a1-d1-d4 triangle.
+func getPiecesIndex(t *tbTable, d *tbPairs, squares []int) uint64 {
+	if squares[0]/8 > 3 {
+		for i := range squares {
+			squares[i] ^= 56
+		}
+	}
+
+	// The first piece of the group that's off the a1-h8 diagonal goes below it.
+	for i := 0; i < d.groupLen[0]; i++ {
+		offset := getDiagonalOffset(squares[i])
+		if offset == 0 {
+			continue
+		}
+
+		if offset > 0 {
+			for j := i; j < len(squares); j++ {
+				squares[j] = (squares[j]>>3 | squares[j]<<3) & 63
+			}
+		}
+		break
+	}
+
+	if !t.hasUniquePieces {
+		return uint64(mapKK[mapA1D1D4[squares[0]]][squares[1]])
+	}
+
+	adjust1 := 0
+	if squares[1] > squares[0] {
+		adjust1 = 1
+	}
+	adjust2 := 0
+	if squares[2] > squares[0] {
+		adjust2++
+	}
+	if squares[2] > squares[1] {
+		adjust2++
+	}
+
+	switch {
+	case getDiagonalOffset(squares[0]) != 0:
+		return uint64((mapA1D1D4[squares[0]]*63+squares[1]-adjust1)*62 + squares[2] - adjust2)
+	case getDiagonalOffset(squares[1]) != 0:
+		return uint64((6*63+squares[0]/8*28+mapB1H1H7[squares[1]])*62 + squares[2] - adjust2)
+	case getDiagonalOffset(squares[2]) != 0:
+		return uint64(6*63*62 + 4*28*62 + squares[0]/8*7*28 + (squares[1]/8-adjust1)*28 + mapB1H1H7[squares[2]])
+	}
+
+	return uint64(6*63*62 + 4*28*62 + 4*7*28 + squares[0]/8*7*6 + (squares[1]/8-adjust1)*6 + squares[2]/8 - adjust2)
+}
+
+// getDTZ converts a value from a DTZ table to plies, for a position with the given WDL result.
+func (f *tbFile) getDTZ(d *tbPairs, value int, wdl int) int {
+	if d.flags&tbFlagMapped != 0 {
+		i := d.mapIdx[[]int{1, 3, 0, 2, 0}[wdl+2]] + value
+		if d.flags&tbFlagWide != 0 {
+			value = int(f.readUint16(f.dtzMap + 2*i))
+		} else {
+			value = int(f.data[f.dtzMap+i])
+		}
+	}
+
+	if wdl == tbWin && d.flags&tbFlagWinPlies == 0 || wdl == tbLoss && d.flags&tbFlagLossPlies == 0 ||
+		wdl == tbCursedWin || wdl == tbBlessedLoss {
+		value *= 2
+	}
+
+	return value + 1
+}
+
+// canProbe returns whether the position might be in the tablebase. Tables are only for positions
+// without castling rights.
+func (tb *tablebase) canProbe(bp *bitboardPosition) bool {
+	return bp.castlingRights == 0 && bits.OnesCount64(uint64(bp.occupied[white]|bp.occupied[black])) <= tb.maxPieces
+}
+
+// search returns the position's WDL result. Tables may store any value for a position in which a
+// capture, or with checkZeroing a pawn move, wins, as the generator doesn't need one, and may store
+// a loss rather than a draw for one in which a capture draws, so captures are searched as well,
+// and the best of their results and the table's is the real result. The state says if a zeroing
+// move is the best, as DTZ tables can't be relied on then.
+func (tb *tablebase) search(bp *bitboardPosition, checkZeroing bool) (int, tbProbeState) {
+	var buffer [maxMoves]bbMove
+	moves := bp.generateMoves(buffer[:0])
+	best := tbLoss
+	searched := 0
+	for _, m := range moves {
+		if !bp.isCapture(m) && (!checkZeroing || bp.squares[m.from()].pieceType() != pawnType) {
+			continue
+		}
+
+		searched++
+		u := bp.makeMove(m)
+		value, state := tb.search(bp, false)
+		value = -value
+		bp.unmakeMove(m, u)
+		if state == tbProbeFailed {
+			return 0, tbProbeFailed
+		}
+
+		if value > best {
+			best = value
+			if value >= tbWin {
+				return value, tbProbeZeroingBestMove
+			}
+		}
+	}
+
+	// If all the moves have been searched, the table isn't needed, and may even be wrong, as it
+	// doesn't know about en passant.
+	noMoreMoves := searched > 0 && searched == len(moves)
+	value := best
+	if !noMoreMoves {
+		var state tbProbeState
+		if value, state = tb.probeTable(bp, true, 0); state == tbProbeFailed {
+			return 0, tbProbeFailed
+		}
+	}
+
+	if best >= value {
+		if best > tbDraw || noMoreMoves {
+			return best, tbProbeZeroingBestMove
+		}
+		return best, tbProbeOK
+	}
+
+	return value, tbProbeOK
+}
+
+// probeWDL returns the position's WDL result from the side to move's point of view, if it's in
+// the tablebase.
+func (tb *tablebase) probeWDL(bp *bitboardPosition) (int, bool) {
+	if !tb.canProbe(bp) {
+		return 0, false
+	}
+
+	wdl, state := tb.search(bp, false)
+	return wdl, state != tbProbeFailed
+}
+
+// getZeroingDTZ returns the DTZ of a position in which the best move is a zeroing move, with the
+// given WDL result.
+func getZeroingDTZ(wdl int) int {
+	switch wdl {
+	case tbWin:
+		return 1
+	case tbCursedWin:
+		return 101
+	case tbBlessedLoss:
+		return -101
+	case tbLoss:
+		return -1
+	}
+
+	return 0
+}
+
+// probeDTZ returns the position's DTZ, if it's in the tablebase: the number of plies to the next
+// zeroing move with best play, positive if the side to move wins and negative if it loses, and
+// more than 100 plies from zero if the fifty-move rule will draw the game. It's 0 for a draw.
+func (tb *tablebase) probeDTZ(bp *bitboardPosition) (int, bool) {
+	if !tb.canProbe(bp) {
+		return 0, false
+	}
+
+	dtz, state := tb.getDTZ(bp)
+	return dtz, state != tbProbeFailed
+}
+
+func (tb *tablebase) getDTZ(bp *bitboardPosition) (int, tbProbeState) {
+	wdl, state := tb.search(bp, true)
+	if state == tbProbeFailed || wdl == tbDraw {
+		return 0, state
+	}
+
+	if state == tbProbeZeroingBestMove {
+		return getZeroingDTZ(wdl), state
+	}
+
+	dtz, state := tb.probeTable(bp, false, wdl)
+	if state == tbProbeFailed {
+		return 0, state
+	}
+
+	if state != tbProbeChangeSideToMove {
+		if wdl == tbCursedWin || wdl == tbBlessedLoss {
+			dtz += 100
+		}
+		if wdl < 0 {
+			dtz = -dtz
+		}
+		return dtz, state
+	}
+
+	// The table only has the other side to move, so search a ply for the best DTZ.
+	var buffer, replies [maxMoves]bbMove
+	moves := bp.generateMoves(buffer[:0])
+	minDTZ := 0xffff
+	for _, m := range moves {
+		zeroing := bp.isCapture(m) || bp.squares[m.from()].pieceType() == pawnType
+		u := bp.makeMove(m)
+		if zeroing {
+			// The DTZ of a zeroing move is that before making it, with the result after it.
+			value, s := tb.search(bp, false)
+			dtz, state = -getZeroingDTZ(value), s
+		} else {
+			dtz, state = tb.getDTZ(bp)
+			dtz = -dtz
+		}
+
+		// A mating move is always the best.
+		if dtz == 1 && bp.isKingInCheck() && len(bp.generateMoves(replies[:0])) == 0 {
+			minDTZ = 1
+		}
+
+		if !zeroing {
+			if dtz > 0 {
+				dtz++
+			} else if dtz < 0 {
+				dtz--
+			}
+		}
+
+		if dtz < minDTZ && (dtz > 0) == (wdl > 0) && dtz != 0 {
+			minDTZ = dtz
+		}
+		bp.unmakeMove(m, u)
+
+		if state == tbProbeFailed {
+			return 0, tbProbeFailed
+		}
+	}
+
+	// With no legal moves, the position is mate.
+	if minDTZ == 0xffff {
+		return -1, tbProbeOK
+	}
+
+	return minDTZ, tbProbeOK
+}
+
+// getBestMove returns the best move in the position according to the DTZ tables, with its DTZ
+// counted from the position, if the position is in the tablebase.
+func (tb *tablebase) getBestMove(bp *bitboardPosition) (bbMove, int, bool) {
+	if !tb.canProbe(bp) {
+		return 0, 0, false
+	}
+
+	var buffer, replies [maxMoves]bbMove
+	moves := bp.generateMoves(buffer[:0])
+	var bestMove bbMove
+	bestDTZ := 0
+	for _, m := range moves {
+		u := bp.makeMove(m)
+		var dtz int
+		var ok bool
+		if bp.halfmoveClock == 0 {
+			var wdl int
+			wdl, ok = tb.probeWDL(bp)
+			dtz = getZeroingDTZ(-wdl)
+		} else {
+			dtz, ok = tb.probeDTZ(bp)
+			dtz = -dtz
+			if dtz > 0 {
+				dtz++
+			} else if dtz < 0 {
+				dtz--
+			}
+		}
+
+		if dtz == 2 && bp.isKingInCheck() && len(bp.generateMoves(replies[:0])) == 0 {
+			dtz = 1
+		}
+		bp.unmakeMove(m, u)
+
+		if !ok {
+			return 0, 0, false
+		}
+
+		if bestMove == 0 || getDTZRank(dtz, bp.halfmoveClock) > getDTZRank(bestDTZ, bp.halfmoveClock) {
+			bestMove, bestDTZ = m, dtz
+		}
+	}
+
+	return bestMove, bestDTZ, bestMove != 0
+}
+
+// getDTZRank ranks a move by its DTZ, given the halfmove clock: first wins, quickest first, then
+// wins the fifty-move rule will draw, then draws, then losses it will draw, then other losses,
+// slowest first.
+func getDTZRank(dtz int, halfmoveClock int) int {
+	const maxDTZ = 1 << 16
+	switch {
+	case dtz > 0 && dtz+halfmoveClock <= fiftyMoveRuleHalfmoves:
+		return 3*maxDTZ - dtz
+	case dtz > 0:
+		return 2*maxDTZ - dtz
+	case dtz < 0 && -dtz+halfmoveClock > fiftyMoveRuleHalfmoves:
+		return -2*maxDTZ - dtz
+	case dtz < 0:
+		return -3*maxDTZ - dtz
+	}
+
+	return 0
+}
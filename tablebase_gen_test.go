@@ -0,0 +1,887 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The tables in testdata/syzygy are made here, by solving each set of pieces and writing the
+// results in the Syzygy format, with the values Huffman coded in pairs as the published tables
+// are. Run the tests with -update-tablebases to write them again.
+var updateTablebases = flag.Bool("update-tablebases", false, "write the Syzygy tables in testdata/syzygy")
+
+// tbSolution is the WDL result and DTZ of every position with a set of pieces, white's first. A
+// position's state is the squares of the pieces, in the order of the name, and the side to move.
+type tbSolution struct {
+	name   string
+	pieces []bbPiece
+	legal  []bool
+	wdl    []int8
+	dtz    []int16
+}
+
+// tbSuccessor is a position a move leads to in the same table.
+type tbSuccessor struct {
+	state   int32
+	zeroing bool
+}
+
+func newTBSolution(name string) *tbSolution {
+	s := &tbSolution{name: name, pieces: getTBPieces(name)}
+	size := 2 << uint(6*len(s.pieces))
+	s.legal = make([]bool, size)
+	s.wdl = make([]int8, size)
+	s.dtz = make([]int16, size)
+	return s
+}
+
+// getTBPieces returns the pieces of a table, in the order of its name.
+func getTBPieces(name string) []bbPiece {
+	var pieces []bbPiece
+	for color, side := range strings.Split(name, "v") {
+		for _, pieceName := range side {
+			pieces = append(pieces, newBBPiece(color, strings.IndexRune(pieceTypeNames, pieceName)))
+		}
+	}
+	return pieces
+}
+
+// getState returns the state of a position with the solution's pieces. Only one piece of each type
+// and colour is allowed.
+func (s *tbSolution) getState(bp *bitboardPosition) int {
+	state := bp.sideToMove
+	for _, pc := range s.pieces {
+		b := bp.pieces[pc.color()][pc.pieceType()]
+		state = state*64 + popLowestSquare(&b)
+	}
+	return state
+}
+
+// getPosition returns the position for a state, and whether it's legal: no two pieces are on the
+// same square, no pawn is on the first or last rank, and the side that's just moved isn't in check.
+func (s *tbSolution) getPosition(state int) (bitboardPosition, bool) {
+	bp := bitboardPosition{enPassant: -1}
+	for i := len(s.pieces) - 1; i >= 0; i-- {
+		sq := state % 64
+		state /= 64
+		if bp.squares[sq] != 0 || s.pieces[i].pieceType() == pawnType && (sq < 8 || sq >= 56) {
+			return bp, false
+		}
+		bp.putPiece(sq, s.pieces[i])
+	}
+
+	bp.sideToMove = state
+	return bp, !bp.isSquareAttacked(bp.kingSquare(1-bp.sideToMove), bp.sideToMove)
+}
+
+// solveTBTable works out the WDL result and DTZ of every position with a set of pieces. Moves that
+// leave the table must lead to a table that's already solved, or to one that's always drawn.
+func solveTBTable(t *testing.T, name string, solved map[string]*tbSolution) *tbSolution {
+	s := newTBSolution(name)
+	successors := make([][]tbSuccessor, len(s.legal))
+	mated := make([]bool, len(s.legal))
+
+	// The best result of the moves that leave the table, all of which are zeroing, for the side
+	// making them, or tbLoss-1 if there are none.
+	exits := make([]int8, len(s.legal))
+
+	var buffer [maxMoves]bbMove
+	for state := range s.legal {
+		bp, legal := s.getPosition(state)
+		if !legal {
+			continue
+		}
+
+		s.legal[state] = true
+		exits[state] = tbLoss - 1
+		moves := bp.generateMoves(buffer[:0])
+		mated[state] = len(moves) == 0 && bp.isKingInCheck()
+		for _, m := range moves {
+			capture := bp.isCapture(m)
+			zeroing := capture || bp.squares[m.from()].pieceType() == pawnType
+			u := bp.makeMove(m)
+			if !capture && m.promotion() == 0 {
+				successors[state] = append(successors[state], tbSuccessor{int32(s.getState(&bp)), zeroing})
+			} else {
+				exits[state] = max(exits[state], -getSolvedWDL(t, name, solved, &bp))
+			}
+			bp.unmakeMove(m, u)
+		}
+	}
+
+	// A position is won if a move leads to a lost one, and lost if every move leads to a won one.
+	// Those that are neither once nothing changes are drawn.
+	known := make([]bool, len(s.legal))
+	var unknown []int
+	for state, legal := range s.legal {
+		if legal {
+			unknown = append(unknown, state)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		remaining := unknown[:0]
+		for _, state := range unknown {
+			best, allKnown := exits[state], true
+			for _, next := range successors[state] {
+				if !known[next.state] {
+					allKnown = false
+				} else if -s.wdl[next.state] > best {
+					best = -s.wdl[next.state]
+				}
+			}
+
+			if best == tbWin || allKnown {
+				switch {
+				case best >= tbLoss:
+				case mated[state]:
+					best = tbLoss
+				default:
+					best = tbDraw
+				}
+				s.wdl[state], known[state], changed = best, true, true
+			} else {
+				remaining = append(remaining, state)
+			}
+		}
+		unknown = remaining
+	}
+
+	// The DTZ of a won position is one more than the shortest DTZ of the lost positions its moves
+	// lead to, or 1 if a zeroing move wins or a move mates. That of a lost position is one more
+	// than the longest of the won positions its moves lead to, or 1 if it only has zeroing moves.
+	// Positions are found in order of their DTZ, those with each DTZ from those with the DTZ before.
+	var decisive []int
+	for state, legal := range s.legal {
+		if legal && s.wdl[state] != tbDraw {
+			decisive = append(decisive, state)
+		}
+	}
+	for dtz := int16(1); len(decisive) > 0; dtz++ {
+		var won, lost []int
+		remaining := decisive[:0]
+		for _, state := range decisive {
+			if s.wdl[state] == tbWin {
+				win := dtz == 1 && exits[state] == tbWin
+				for _, next := range successors[state] {
+					if s.wdl[next.state] == tbLoss && (dtz == 1 && (next.zeroing || mated[next.state]) ||
+						dtz > 1 && !next.zeroing && -s.dtz[next.state] == dtz-1) {
+						win = true
+					}
+				}
+
+				if win {
+					won = append(won, state)
+				} else {
+					remaining = append(remaining, state)
+				}
+				continue
+			}
+
+			longest := int16(1)
+			for _, next := range successors[state] {
+				switch {
+				case next.zeroing:
+				case s.dtz[next.state] == 0:
+					longest = -1
+				case longest > 0 && s.dtz[next.state]+1 > longest:
+					longest = s.dtz[next.state] + 1
+				}
+			}
+
+			if longest == dtz {
+				lost = append(lost, state)
+			} else {
+				remaining = append(remaining, state)
+			}
+		}
+
+		if len(won)+len(lost) == 0 {
+			break
+		}
+		for _, state := range won {
+			s.dtz[state] = dtz
+		}
+		for _, state := range lost {
+			s.dtz[state] = -dtz
+		}
+		decisive = remaining
+	}
+
+	s.checkDTZ(t)
+	return s
+}
+
+// getSolvedWDL returns the WDL result of a position a move out of a table leads to, from the
+// tables already solved. They're solved for white having the pieces of the first part of their
+// names, so a position where black has those is looked up with the colours swapped.
+func getSolvedWDL(t *testing.T, name string, solved map[string]*tbSolution, bp *bitboardPosition) int8 {
+	key := getMaterialKey(bp)
+	if key == "KvK" {
+		return tbDraw
+	}
+
+	if s := solved[key]; s != nil {
+		return s.wdl[s.getState(bp)]
+	}
+
+	sides := strings.Split(key, "v")
+	s := solved[sides[1]+"v"+sides[0]]
+	if s == nil {
+		t.Fatalf("Can't solve %s before %s.", name, key)
+	}
+
+	swapped := bitboardPosition{enPassant: -1, sideToMove: 1 - bp.sideToMove}
+	for sq, pc := range bp.squares {
+		if pc != 0 {
+			swapped.putPiece(sq^56, newBBPiece(1-pc.color(), pc.pieceType()))
+		}
+	}
+	return s.wdl[s.getState(&swapped)]
+}
+
+// solveTBTableBackwards solves a table without pawns as solveTBTable does, but by taking moves back
+// from the positions whose results are known, as there isn't the memory to keep the moves of every
+// position with four pieces. Without pawns, the only zeroing moves are captures, which all leave
+// the table.
+func solveTBTableBackwards(t *testing.T, name string, solved map[string]*tbSolution) *tbSolution {
+	s := newTBSolution(name)
+
+	// The number of each position's moves that stay in the table and aren't yet known to lose, the
+	// best result of those that leave it, as in solveTBTable, and whether it's mate.
+	remaining := make([]uint8, len(s.legal))
+	exits := make([]int8, len(s.legal))
+	mated := make([]bool, len(s.legal))
+
+	var buffer [maxMoves]bbMove
+	for state := range s.legal {
+		bp, legal := s.getPosition(state)
+		if !legal {
+			continue
+		}
+
+		s.legal[state] = true
+		exits[state] = tbLoss - 1
+		moves := bp.generateMoves(buffer[:0])
+		mated[state] = len(moves) == 0 && bp.isKingInCheck()
+		for _, m := range moves {
+			if !bp.isCapture(m) {
+				remaining[state]++
+				continue
+			}
+
+			u := bp.makeMove(m)
+			exits[state] = max(exits[state], -getSolvedWDL(t, name, solved, &bp))
+			bp.unmakeMove(m, u)
+		}
+	}
+
+	// Positions are found in order of their DTZ. A position is won with one more than the DTZ of
+	// the first lost position found that a move leads to, and lost with one more than the DTZ of
+	// the last won one, once all its moves are known to lead to won positions.
+	var found [][]int32
+	setResult := func(state int, wdl int8, dtz int16) {
+		s.wdl[state], s.dtz[state] = wdl, dtz
+		level := int(max(dtz, -dtz))
+		for len(found) <= level {
+			found = append(found, nil)
+		}
+		found[level] = append(found[level], int32(state))
+	}
+
+	for state, legal := range s.legal {
+		switch {
+		case !legal:
+		case mated[state] || remaining[state] == 0 && exits[state] == tbLoss:
+			setResult(state, tbLoss, -1)
+		case exits[state] == tbWin:
+			setResult(state, tbWin, 1)
+		}
+	}
+
+	// A move that mates wins with a DTZ of 1, though the DTZ of the position it leads to is -1.
+	if len(found) > 1 {
+		for _, state := range found[1] {
+			if !mated[state] {
+				continue
+			}
+			s.forEachUnmove(int(state), func(prev int) {
+				if s.dtz[prev] == 0 {
+					setResult(prev, tbWin, 1)
+				}
+			})
+		}
+	}
+
+	for level := 1; level < len(found); level++ {
+		for _, state := range found[level] {
+			won := s.wdl[state] == tbWin
+			s.forEachUnmove(int(state), func(prev int) {
+				switch {
+				case s.dtz[prev] != 0:
+				case !won:
+					setResult(prev, tbWin, int16(level+1))
+				default:
+					remaining[prev]--
+					if remaining[prev] == 0 && exits[prev] < tbDraw {
+						setResult(prev, tbLoss, -int16(level+1))
+					}
+				}
+			})
+		}
+		found[level] = nil
+	}
+
+	s.checkDTZ(t)
+	return s
+}
+
+// forEachUnmove calls f with the state of each legal position with a move that leads to the given
+// one without a capture, in a table without pawns.
+func (s *tbSolution) forEachUnmove(state int, f func(int)) {
+	n := len(s.pieces)
+	var squares [tbMaxPieces]int
+	var occupied bitboard
+	for i := n - 1; i >= 0; i-- {
+		squares[i] = state >> uint(6*(n-1-i)) & 63
+		occupied |= 1 << uint(squares[i])
+	}
+
+	// The side that's just moved is the side to move before the move.
+	sideToMove := state >> uint(6*n)
+	swapSide := (1 - 2*sideToMove) << uint(6*n)
+	for i, pc := range s.pieces {
+		if pc.color() == sideToMove {
+			continue
+		}
+
+		sq := squares[i]
+		var targets bitboard
+		switch pc.pieceType() {
+		case knightType:
+			targets = knightAttacks[sq]
+		case bishopType:
+			targets = bishopAttacks(sq, occupied)
+		case rookType:
+			targets = rookAttacks(sq, occupied)
+		case queenType:
+			targets = bishopAttacks(sq, occupied) | rookAttacks(sq, occupied)
+		case kingType:
+			targets = kingAttacks[sq]
+		}
+
+		shift := uint(6 * (n - 1 - i))
+		for b := targets &^ occupied; b != 0; {
+			prev := state + swapSide + (popLowestSquare(&b)-sq)<<shift
+			if s.legal[prev] {
+				f(prev)
+			}
+		}
+	}
+}
+
+// checkDTZ fails the test if a won or lost position has a DTZ the tables can't hold.
+func (s *tbSolution) checkDTZ(t *testing.T) {
+	for state, legal := range s.legal {
+		if legal && s.wdl[state] != tbDraw && (s.dtz[state] == 0 || s.dtz[state] > 100 || s.dtz[state] < -100) {
+			t.Fatalf("Position %d of %s has WDL %d but DTZ %d, which the tables can't hold.", state, s.name, s.wdl[state], s.dtz[state])
+		}
+	}
+}
+
+// getTBFileData returns the WDL or DTZ file for a solved set of pieces. The pieces are in the
+// tables in the order of the name, with any pawn first, and the DTZ file is for white to move, in
+// plies. The DTZ values of tables with more than three pieces are mapped, as the published tables'
+// mostly are, and those of the others aren't, so that both are read.
+func getTBFileData(t *testing.T, s *tbSolution, isWDL bool) []byte {
+	tbl := newTBTable(s.name)
+	f, magic := &tbl.dtz, tbDTZMagic
+	if isWDL {
+		f, magic = &tbl.wdl, tbWDLMagic
+	}
+
+	f.sides = 1
+	if isWDL && tbl.key != tbl.key2 {
+		f.sides = 2
+	}
+
+	files := 1
+	if tbl.hasPawns {
+		files = 4
+	}
+
+	var pieces []int
+	for _, pc := range s.pieces {
+		pieces = append(pieces, pc.color()*8+pc.pieceType()+1)
+	}
+	sort.SliceStable(pieces, func(i, j int) bool { return pieces[i]&7 == 1 && pieces[j]&7 != 1 })
+
+	data := append([]byte{}, magic...)
+	data = append(data, byte(f.sides-1))
+	if tbl.hasPawns {
+		data[4] |= 2
+	}
+	for file := 0; file < files; file++ {
+		data = append(data, 0)
+		for k, piece := range pieces {
+			data = append(data, byte(piece|piece<<4))
+			f.pairs[0][file].pieces[k] = piece
+			f.pairs[1][file].pieces[k] = piece
+		}
+		for i := 0; i < f.sides; i++ {
+			f.pairs[i][file].setGroups(tbl, [2]int{0, 0xf}, file)
+		}
+	}
+	data = append(data, make([]byte, len(data)&1)...)
+
+	// Positions that can't arise are stored as draws.
+	var values [2][4][]int
+	var set [2][4][]bool
+	for file := 0; file < files; file++ {
+		for i := 0; i < f.sides; i++ {
+			values[i][file] = make([]int, f.pairs[i][file].size())
+			set[i][file] = make([]bool, len(values[i][file]))
+			if isWDL {
+				for idx := range values[i][file] {
+					values[i][file][idx] = tbDraw + 2
+				}
+			}
+		}
+	}
+
+	for state, legal := range s.legal {
+		if !legal {
+			continue
+		}
+
+		bp, _ := s.getPosition(state)
+		d, idx := f.getIndex(tbl, &bp, s.name, isWDL)
+		if d == nil {
+			continue
+		}
+
+		value := int(s.wdl[state]) + 2
+		if !isWDL {
+			value = int(s.dtz[state])
+		}
+
+		for file := 0; file < files; file++ {
+			for i := 0; i < f.sides; i++ {
+				if d != &f.pairs[i][file] {
+					continue
+				}
+
+				if set[i][file][idx] && values[i][file][idx] != value {
+					t.Fatalf("Positions of %s with index %d have values %d and %d.", s.name, idx, values[i][file][idx], value)
+				}
+				values[i][file][idx], set[i][file][idx] = value, true
+			}
+		}
+	}
+
+	flags := uint8(0)
+	if !isWDL {
+		flags = tbFlagWinPlies | tbFlagLossPlies
+		if tbl.pieceCount > 3 {
+			flags |= tbFlagMapped
+		}
+	}
+
+	var tables []tbEncoding
+	var dtzMaps []byte
+	for file := 0; file < files; file++ {
+		for i := 0; i < f.sides; i++ {
+			if !isWDL {
+				dtzMaps = append(dtzMaps, storeTBDTZValues(t, values[i][file], flags&tbFlagMapped != 0)...)
+			}
+			enc := encodeTBValues(t, values[i][file], flags, isWDL)
+			data = append(data, enc.header...)
+			tables = append(tables, enc)
+		}
+	}
+	data = append(data, dtzMaps...)
+	data = append(data, make([]byte, len(data)&1)...)
+	for _, enc := range tables {
+		data = append(data, enc.sparseIndex...)
+	}
+	for _, enc := range tables {
+		data = append(data, enc.blockLengths...)
+	}
+	for _, enc := range tables {
+		if len(enc.blocks) > 0 {
+			data = append(data, make([]byte, -len(data)&0x3f)...)
+			data = append(data, enc.blocks...)
+		}
+	}
+
+	// The file ends with 16 bytes for a checksum, which isn't read, so it's left empty.
+	data = append(data, make([]byte, -len(data)&0x3f)...)
+	return append(data, make([]byte, 16)...)
+}
+
+// storeTBDTZValues replaces a table's DTZ values with those stored for them, and returns its
+// maps, if it's mapped. A stored value is one less than the DTZ's size, or with maps, where that
+// is in the map for the position's result. There are maps for wins, losses, cursed wins and
+// blessed losses, in that order, each of the values most common first.
+func storeTBDTZValues(t *testing.T, values []int, mapped bool) []byte {
+	var counts [4]map[int]int
+	for i := range counts {
+		counts[i] = map[int]int{}
+	}
+	for _, dtz := range values {
+		switch {
+		case dtz > 0:
+			counts[0][dtz-1]++
+		case dtz < 0:
+			counts[1][-dtz-1]++
+		}
+	}
+
+	var maps []byte
+	var stored [4]map[int]int
+	for i, c := range counts {
+		mapValues := make([]int, 0, len(c))
+		for value := range c {
+			mapValues = append(mapValues, value)
+		}
+		sort.Slice(mapValues, func(j, k int) bool {
+			return c[mapValues[j]] > c[mapValues[k]] || c[mapValues[j]] == c[mapValues[k]] && mapValues[j] < mapValues[k]
+		})
+
+		stored[i] = map[int]int{}
+		maps = append(maps, byte(len(mapValues)))
+		for j, value := range mapValues {
+			if value > 0xff {
+				t.Fatalf("DTZ %d is too big for a map.", value+1)
+			}
+			stored[i][value] = j
+			maps = append(maps, byte(value))
+		}
+	}
+
+	for idx, dtz := range values {
+		value := max(dtz, -dtz) - 1
+		switch {
+		case dtz == 0:
+			value = 0
+		case mapped && dtz > 0:
+			value = stored[0][value]
+		case mapped:
+			value = stored[1][value]
+		}
+		values[idx] = value
+	}
+
+	if !mapped {
+		return nil
+	}
+	return maps
+}
+
+// tbEncoding is a compressed table, in the parts the file keeps apart.
+type tbEncoding struct {
+	header       []byte
+	sparseIndex  []byte
+	blockLengths []byte
+	blocks       []byte
+}
+
+// Blocks are 64 bytes, with a sparse index entry for every 1024 positions. Pairs of symbols are
+// given symbols of their own until there are tbGenMaxSymbols, or no pair is common enough to be
+// worth one.
+const (
+	tbGenBlockSize    = 6
+	tbGenIdxBits      = 10
+	tbGenMaxSymbols   = 512
+	tbGenMinPairCount = 8
+)
+
+// tbSymbol is a value, or a pair of symbols that come one after the other, and the number of
+// values it stands for, which a prober can't handle more than 256 of.
+type tbSymbol struct {
+	value  int
+	pair   [2]int
+	length int
+}
+
+// encodeTBValues compresses a table's values. Each value is a symbol, and the pair of symbols that
+// most often come one after the other is repeatedly made a symbol too, so that the symbols stand
+// for runs of values. The symbols are then Huffman coded.
+func encodeTBValues(t *testing.T, values []int, flags uint8, isWDL bool) tbEncoding {
+	var symbols []tbSymbol
+	ids := map[int]int{}
+	text := make([]int, len(values))
+	for idx, value := range values {
+		id, ok := ids[value]
+		if !ok {
+			id = len(symbols)
+			ids[value] = id
+			symbols = append(symbols, tbSymbol{value: value, pair: [2]int{-1, -1}, length: 1})
+		}
+		text[idx] = id
+	}
+
+	// A table with only one value keeps it in the header, though DTZ tables can only keep a 0.
+	if len(symbols) == 1 && (isWDL || values[0] == 0) {
+		return tbEncoding{header: []byte{flags | tbFlagSingleValue, byte(values[0])}}
+	}
+
+	for len(symbols) < tbGenMaxSymbols {
+		// A run of the same symbol has half as many pairs of it that don't overlap.
+		counts := map[[2]int]int{}
+		for i := 0; i+1 < len(text); i++ {
+			pair := [2]int{text[i], text[i+1]}
+			counts[pair]++
+			if pair[0] == pair[1] && i+2 < len(text) && text[i+2] == pair[0] {
+				i++
+			}
+		}
+
+		best, bestCount := [2]int{}, tbGenMinPairCount-1
+		for pair, count := range counts {
+			if symbols[pair[0]].length+symbols[pair[1]].length > 256 {
+				continue
+			}
+			if count > bestCount || count == bestCount && (pair[0] < best[0] || pair[0] == best[0] && pair[1] < best[1]) {
+				best, bestCount = pair, count
+			}
+		}
+		if bestCount < tbGenMinPairCount {
+			break
+		}
+
+		id := len(symbols)
+		symbols = append(symbols, tbSymbol{pair: best, length: symbols[best[0]].length + symbols[best[1]].length})
+		paired := text[:0]
+		for i := 0; i < len(text); i++ {
+			if i+1 < len(text) && text[i] == best[0] && text[i+1] == best[1] {
+				paired = append(paired, id)
+				i++
+			} else {
+				paired = append(paired, text[i])
+			}
+		}
+		text = paired
+	}
+
+	// Symbols that are only part of others still need a code, as a prober works out how many values
+	// each symbol stands for from all of them.
+	counts := map[int]int{}
+	order := make([]int, len(symbols))
+	for id := range symbols {
+		counts[id] = 1
+		order[id] = id
+	}
+	for _, id := range text {
+		counts[id]++
+	}
+	lengths := getHuffmanLengths(order, counts)
+
+	// Symbols are numbered longest code first, and the codes of each length follow on from those of
+	// the next longest, so that the lowest symbol of each length is all a prober needs.
+	sort.SliceStable(order, func(i, j int) bool { return lengths[order[i]] > lengths[order[j]] })
+	minLen, maxLen := lengths[order[len(order)-1]], lengths[order[0]]
+	if maxLen > 32 {
+		t.Fatalf("Huffman codes of %d bits are too long.", maxLen)
+	}
+
+	numbers := make([]int, len(symbols))
+	for sym, id := range order {
+		numbers[id] = sym
+	}
+
+	lowestSym := make([]int, maxLen-minLen+1)
+	for i := range lowestSym {
+		for _, id := range order {
+			if lengths[id] > i+minLen {
+				lowestSym[i]++
+			}
+		}
+	}
+
+	base := make([]uint64, len(lowestSym))
+	for i := len(base) - 2; i >= 0; i-- {
+		if (base[i+1]+uint64(lowestSym[i]-lowestSym[i+1]))%2 != 0 {
+			t.Fatalf("Huffman codes of %d bits aren't complete.", i+1+minLen)
+		}
+		base[i] = (base[i+1] + uint64(lowestSym[i]-lowestSym[i+1])) / 2
+	}
+
+	codes := make([]uint64, len(symbols))
+	for sym, id := range order {
+		i := lengths[id] - minLen
+		codes[id] = base[i] + uint64(sym-lowestSym[i])
+	}
+
+	var enc tbEncoding
+	var blockStarts []int
+	blockBytes := 1 << tbGenBlockSize
+	bitPos := 0
+	idx := 0
+	for _, id := range text {
+		length := lengths[id]
+		if len(blockStarts) == 0 || bitPos+length > 8*blockBytes || idx+symbols[id].length-blockStarts[len(blockStarts)-1] > 1<<16 {
+			blockStarts = append(blockStarts, idx)
+			enc.blocks = append(enc.blocks, make([]byte, blockBytes)...)
+			bitPos = 0
+		}
+
+		block := enc.blocks[len(enc.blocks)-blockBytes:]
+		for b := length - 1; b >= 0; b-- {
+			if codes[id]>>uint(b)&1 != 0 {
+				block[bitPos/8] |= 0x80 >> uint(bitPos%8)
+			}
+			bitPos++
+		}
+		idx += symbols[id].length
+	}
+
+	// The last block length entry is padding, for sparse index entries past the end of the table.
+	for block, start := range blockStarts {
+		end := len(values)
+		if block+1 < len(blockStarts) {
+			end = blockStarts[block+1]
+		}
+		enc.blockLengths = binary.LittleEndian.AppendUint16(enc.blockLengths, uint16(end-start-1))
+	}
+	enc.blockLengths = append(enc.blockLengths, 0, 0)
+
+	// Each sparse index entry is the block and offset in it of the position halfway through its
+	// span.
+	span := 1 << tbGenIdxBits
+	for idx := span / 2; idx-span/2 < len(values); idx += span {
+		block := sort.Search(len(blockStarts), func(i int) bool { return blockStarts[i] > idx }) - 1
+		offset := idx - blockStarts[block]
+		if idx >= len(values) {
+			block, offset = len(blockStarts), idx-len(values)
+		}
+		enc.sparseIndex = binary.LittleEndian.AppendUint32(enc.sparseIndex, uint32(block))
+		enc.sparseIndex = binary.LittleEndian.AppendUint16(enc.sparseIndex, uint16(offset))
+	}
+
+	// A symbol that's a value is stored as the value and 0xfff, and a pair as its two symbols.
+	enc.header = []byte{flags, tbGenBlockSize, tbGenIdxBits, 1}
+	enc.header = binary.LittleEndian.AppendUint32(enc.header, uint32(len(blockStarts)))
+	enc.header = append(enc.header, byte(maxLen), byte(minLen))
+	for _, sym := range lowestSym {
+		enc.header = binary.LittleEndian.AppendUint16(enc.header, uint16(sym))
+	}
+	enc.header = binary.LittleEndian.AppendUint16(enc.header, uint16(len(symbols)))
+	for _, id := range order {
+		left, right := symbols[id].value, 0xfff
+		if symbols[id].pair[0] >= 0 {
+			left, right = numbers[symbols[id].pair[0]], numbers[symbols[id].pair[1]]
+		}
+		enc.header = append(enc.header, byte(left), byte(left>>8&0xf|right<<4&0xf0), byte(right>>4))
+	}
+	enc.header = append(enc.header, make([]byte, len(symbols)&1)...)
+	return enc
+}
+
+// getHuffmanLengths returns the length of each symbol's Huffman code, made by repeatedly joining
+// the two least common groups of symbols. A lone symbol still needs a bit.
+func getHuffmanLengths(symbols []int, counts map[int]int) map[int]int {
+	lengths := map[int]int{}
+	type group struct {
+		count   int
+		symbols []int
+	}
+
+	var groups []group
+	for _, value := range symbols {
+		groups = append(groups, group{counts[value], []int{value}})
+		lengths[value] = 0
+	}
+	if len(groups) == 1 {
+		lengths[symbols[0]] = 1
+	}
+
+	for len(groups) > 1 {
+		sort.SliceStable(groups, func(i, j int) bool { return groups[i].count < groups[j].count })
+		joined := group{groups[0].count + groups[1].count, append(append([]int{}, groups[0].symbols...), groups[1].symbols...)}
+		for _, value := range joined.symbols {
+			lengths[value]++
+		}
+		groups = append([]group{joined}, groups[2:]...)
+	}
+
+	return lengths
+}
+
+// writeTBFiles writes the WDL and DTZ files for a solved set of pieces to testdata/syzygy, or with
+// check, checks they're already there.
+func writeTBFiles(t *testing.T, s *tbSolution, check bool) {
+	dir := filepath.Join("testdata", "syzygy")
+	for _, ext := range []string{".rtbw", ".rtbz"} {
+		data := getTBFileData(t, s, ext == ".rtbw")
+		path := filepath.Join(dir, s.name+ext)
+		if check {
+			if existing, err := os.ReadFile(path); err != nil || !bytes.Equal(existing, data) {
+				t.Errorf("Expected %s to be the table made here. Run the tests with -update-tablebases to write it again.", path)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestTablebaseFixtures checks the tables in testdata/syzygy are those made here, and that probing
+// them gives each position's result and DTZ. The tables with four pieces take minutes to solve, so
+// they're only solved to write them again, and TestTablebaseFourPieces checks them otherwise.
+func TestTablebaseFixtures(t *testing.T) {
+	solved := map[string]*tbSolution{}
+	for _, name := range []string{"KQvK", "KRvK", "KBvK", "KNvK", "KPvK"} {
+		solved[name] = solveTBTable(t, name, solved)
+		writeTBFiles(t, solved[name], !*updateTablebases)
+	}
+
+	// The tables with four pieces are solved backwards, which should give the same results for
+	// those with three.
+	for _, name := range []string{"KQvK", "KRvK"} {
+		s := solveTBTableBackwards(t, name, solved)
+		if !slices.Equal(s.wdl, solved[name].wdl) || !slices.Equal(s.dtz, solved[name].dtz) {
+			t.Errorf("Expected solving %s backwards to give the same results", name)
+		}
+	}
+
+	if *updateTablebases {
+		for _, name := range []string{"KQvKR", "KRvKR"} {
+			writeTBFiles(t, solveTBTableBackwards(t, name, solved), false)
+		}
+	}
+
+	// Probing every position takes a while, so only some are.
+	step := 11
+	if testing.Short() {
+		step = 101
+	}
+
+	tb := getTestTablebase(t)
+	for _, s := range solved {
+		for state := 0; state < len(s.legal); state += step {
+			if !s.legal[state] {
+				continue
+			}
+
+			bp, _ := s.getPosition(state)
+			wdl, wdlFound := tb.probeWDL(&bp)
+			dtz, dtzFound := tb.probeDTZ(&bp)
+			if !wdlFound || !dtzFound || wdl != int(s.wdl[state]) || dtz != int(s.dtz[state]) {
+				t.Fatalf("Expected WDL %d and DTZ %d for %s position %d, but got: %d (%t) and %d (%t)", s.wdl[state], s.dtz[state], s.name, state, wdl, wdlFound, dtz, dtzFound)
+			}
+		}
+	}
+}
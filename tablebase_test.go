@@ -0,0 +1,238 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTablebaseIndexTables(t *testing.T) {
+	// There are 462 ways to place the kings with the first in the a1-d1-d4 triangle.
+	seen := map[int]bool{}
+	for idx := 0; idx < 10; idx++ {
+		for sq := 0; sq < 64; sq++ {
+			seen[mapKK[idx][sq]] = true
+		}
+	}
+	for code := 0; code < 462; code++ {
+		if !seen[code] {
+			t.Fatalf("Expected king placement %d to be used", code)
+		}
+	}
+
+	if binomial[2][5] != 10 || binomial[3][48] != 17296 {
+		t.Errorf("Expected binomial coefficients 10 and 17296, but got: %d and %d", binomial[2][5], binomial[3][48])
+	}
+
+	// A single leading pawn can be on any of six ranks of its file, and the first is the one
+	// nearest the edge and then the lowest.
+	if leadPawnsSize[1][0] != 6 || mapPawns[getSquareIndex(square{"A", 2})] != 47 || mapPawns[getSquareIndex(square{"H", 2})] != 46 {
+		t.Errorf("Expected the pawn tables to start at a2, then h2")
+	}
+}
+
+func TestGetMaterialKey(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected string
+	}{
+		{"4k3/8/8/8/8/8/8/4KQ2 w - - 0 1", "KQvK"},
+		{"4k3/4p3/8/8/8/8/8/1N2K1R1 b - - 0 1", "KRNvKP"},
+		{"4kq2/8/8/8/8/8/8/4K3 w - - 0 1", "KvKQ"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		bp := newBitboardPosition(p)
+		if res := getMaterialKey(&bp); res != test.expected {
+			t.Errorf("Expected material key of %s to be %s, but got: %s", test.fen, test.expected, res)
+		}
+	}
+}
+
+func TestNewTablebaseNoTables(t *testing.T) {
+	if _, err := newTablebase(t.TempDir()); err == nil {
+		t.Errorf("Expected an error for a directory without tables")
+	}
+}
+
+// writeSingleValueTable writes a KQvK WDL table that has the same stored value for every position
+// with each side to move, which tests reading and probing tables without needing real ones.
+func writeSingleValueTable(t *testing.T, dir string, whiteToMove byte, blackToMove byte) {
+	data := append([]byte{}, tbWDLMagic...)
+	data = append(data,
+		1,    // The table is split by side to move.
+		0x00, // The pieces are encoded as one group.
+		0xe6, // White king, with black's king for black to move.
+		0x6e, // Black king, with white's king.
+		0xd5, // White queen, with black's queen.
+		0,    // Padding.
+		tbFlagSingleValue, whiteToMove,
+		tbFlagSingleValue, blackToMove)
+	data = append(data, make([]byte, 16-len(data))...)
+
+	if err := os.WriteFile(filepath.Join(dir, "KQvK.rtbw"), data, 0644); err != nil {
+		t.Fatalf("Unexpected error writing table: %s", err)
+	}
+}
+
+func TestTablebaseProbeWDL(t *testing.T) {
+	dir := t.TempDir()
+	writeSingleValueTable(t, dir, tbWin+2, tbLoss+2)
+	tb, err := newTablebase(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error finding tables: %s", err)
+	}
+
+	tests := []struct {
+		fen      string
+		expected int
+		found    bool
+	}{
+		{"4k3/8/8/8/8/8/8/4KQ2 w - - 0 1", tbWin, true},
+		{"4k3/8/8/8/8/8/8/4KQ2 b - - 0 1", tbLoss, true},
+		// With the colours swapped, the table is read as if they weren't.
+		{"4kq2/8/8/8/8/8/8/4K3 b - - 0 1", tbWin, true},
+		{"4kq2/8/8/8/8/8/8/4K3 w - - 0 1", tbLoss, true},
+		// Taking the queen draws, whatever the table says.
+		{"8/8/8/8/8/8/7k/K5Q1 b - - 0 1", tbDraw, true},
+		{"4k3/8/8/8/8/8/8/R3KQ2 w - - 0 1", 0, false},
+		{"4k3/8/8/8/8/8/8/4KR2 w - - 0 1", 0, false},
+		{"r3k3/8/8/8/8/8/8/4KQ2 w q - 0 1", 0, false},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		bp := newBitboardPosition(p)
+		wdl, found := tb.probeWDL(&bp)
+		if wdl != test.expected || found != test.found {
+			t.Errorf("Expected WDL of %s to be %d (%t), but got: %d (%t)", test.fen, test.expected, test.found, wdl, found)
+		}
+	}
+}
+
+// getTestTablebase returns the tables in testdata/syzygy, which are made by TestTablebaseFixtures.
+func getTestTablebase(t *testing.T) *tablebase {
+	tb, err := newTablebase(filepath.Join("testdata", "syzygy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tb
+}
+
+func TestTablebaseProbeRealTables(t *testing.T) {
+	tb := getTestTablebase(t)
+	tests := []struct {
+		fen string
+		wdl int
+		dtz int
+	}{
+		{"k7/8/1K6/8/8/8/8/6Q1 w - - 0 1", tbWin, 1},
+		{"4k3/8/8/8/8/8/8/4KQ2 b - - 0 1", tbLoss, 0},
+		{"8/8/8/8/8/8/2k5/R3K3 w - - 0 1", tbWin, 0},
+		{"k7/8/8/8/8/8/P7/K7 w - - 0 1", tbDraw, 0},
+		{"8/8/8/8/8/8/4P3/4K2k w - - 0 1", tbWin, 1},
+		// Tables with four pieces, for both sides and symmetric.
+		{"8/8/8/3k4/8/8/r7/Q3K3 w - - 0 1", tbWin, 1},
+		{"7Q/2k5/8/8/8/8/7r/4K3 b - - 0 1", tbWin, 1},
+		{"k7/8/1K6/8/8/8/7r/6Q1 w - - 0 1", tbWin, 1},
+		{"k5Q1/8/1K6/8/8/8/7r/8 b - - 0 1", tbLoss, -1},
+		{"8/8/2k5/8/8/8/5r2/1K1Q4 w - - 0 1", tbWin, 0},
+		{"r3k3/8/8/8/8/8/8/R3K3 w - - 0 1", tbWin, 1},
+		{"r3k3/8/8/8/8/8/8/R3K3 b - - 0 1", tbWin, 1},
+		{"8/r7/4k3/8/8/3K4/8/7R w - - 0 1", tbDraw, 0},
+		{"8/r7/4k3/8/8/3K4/8/7R b - - 0 1", tbDraw, 0},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		bp := newBitboardPosition(p)
+		wdl, found := tb.probeWDL(&bp)
+		if !found || wdl != test.wdl {
+			t.Errorf("Expected WDL of %s to be %d, but got: %d (%t)", test.fen, test.wdl, wdl, found)
+		}
+
+		dtz, found := tb.probeDTZ(&bp)
+		if !found || (dtz > 0) != (test.wdl > 0) || (dtz < 0) != (test.wdl < 0) || test.dtz != 0 && dtz != test.dtz {
+			t.Errorf("Expected DTZ of %s to match WDL %d, and be %d if given, but got: %d (%t)", test.fen, test.wdl, test.dtz, dtz, found)
+		}
+	}
+
+	// The engine plays the mate straight from the tablebases.
+	e := newEngine(1)
+	e.tablebase = tb
+	p, _ := parseFEN("k7/8/1K6/8/8/8/8/6Q1 w - - 0 1")
+	if result := e.search(p, searchLimits{depth: 1}); !result.tablebase || result.bestMove.String() != "g1g8" {
+		t.Errorf("Expected the engine to play g1g8 from the tablebases, but got: %v", result.pv)
+	}
+}
+
+// TestTablebaseFourPieces checks the results of positions with four pieces, which take too long to
+// solve in every test run, by the rules: a position's result and DTZ follow from those of the
+// positions its moves lead to.
+func TestTablebaseFourPieces(t *testing.T) {
+	tb := getTestTablebase(t)
+	samples := 2000
+	if testing.Short() {
+		samples = 200
+	}
+
+	rng := xorshift(0x9e3779b97f4a7c15)
+	var buffer, replies [maxMoves]bbMove
+	for _, name := range []string{"KQvKR", "KRvKR"} {
+		s := &tbSolution{name: name, pieces: getTBPieces(name)}
+		for checked := 0; checked < samples; {
+			state := int(rng.next() % (2 << 24))
+			bp, legal := s.getPosition(state)
+			if !legal {
+				continue
+			}
+			checked++
+
+			wdl, wdlFound := tb.probeWDL(&bp)
+			dtz, dtzFound := tb.probeDTZ(&bp)
+			if !wdlFound || !dtzFound {
+				t.Fatalf("Expected %s position %d to be in the tablebase", name, state)
+			}
+
+			// A win's DTZ is that of its quickest winning move, and a loss's that of its slowest
+			// move, counting 1 for a zeroing move or mate, and one more than the DTZ after it for
+			// any other.
+			moves := bp.generateMoves(buffer[:0])
+			expectedWDL, expectedDTZ := tbDraw, 0
+			if len(moves) == 0 && bp.isKingInCheck() {
+				expectedWDL, expectedDTZ = tbLoss, -1
+			} else if len(moves) > 0 {
+				expectedWDL = tbLoss
+			}
+			for _, m := range moves {
+				zeroing := bp.isCapture(m)
+				u := bp.makeMove(m)
+				nextWDL, _ := tb.probeWDL(&bp)
+				nextDTZ, _ := tb.probeDTZ(&bp)
+				mate := bp.isKingInCheck() && len(bp.generateMoves(replies[:0])) == 0
+				bp.unmakeMove(m, u)
+
+				moveDTZ := 1 - nextDTZ
+				if nextDTZ > 0 {
+					moveDTZ = -1 - nextDTZ
+				}
+				if zeroing || mate {
+					moveDTZ = getZeroingDTZ(-nextWDL)
+				}
+
+				if -nextWDL > expectedWDL || -nextWDL == expectedWDL && moveDTZ < expectedDTZ {
+					expectedWDL, expectedDTZ = -nextWDL, moveDTZ
+				}
+			}
+			if expectedWDL == tbDraw {
+				expectedDTZ = 0
+			}
+
+			if wdl != expectedWDL || dtz != expectedDTZ {
+				t.Errorf("Expected WDL %d and DTZ %d for %s position %d from its moves, but got: %d and %d", expectedWDL, expectedDTZ, name, state, wdl, dtz)
+			}
+		}
+	}
+}
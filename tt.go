@@ -0,0 +1,127 @@
+package main
+
+import (
+	"unsafe"
+)
+
+// defaultHashSize is the size of the transposition table, in MB, unless set otherwise.
+const defaultHashSize = 16
+
+// ttBound says what a score stored in the transposition table is known to be: exact, or only a
+// lower bound, if the search failed high, or an upper bound, if it failed low.
+type ttBound uint8
+
+const (
+	ttExact ttBound = iota + 1
+	ttLowerBound
+	ttUpperBound
+)
+
+// ttEntry is what a search found for a position: the score, to what depth and how exactly, and the
+// best move, if there was one. The age is that of the search that stored it. The entry is empty if
+// it has no bound.
+type ttEntry struct {
+	hash  uint64
+	move  bbMove
+	score int32
+	depth int8
+	bound ttBound
+	age   uint8
+}
+
+// transpositionTable remembers what's been found for positions already searched, by hash, so that
+// the same position reached by a different order of moves, or searched again to a greater depth,
+// doesn't have to be searched again from scratch. It's a fixed size, each hash having one entry it
+// can be stored in. A table with no entries stores nothing.
+type transpositionTable struct {
+	entries []ttEntry
+	mask    uint64
+	age     uint8
+}
+
+// newTranspositionTable creates a table taking up to the given number of MB. The number of entries
+// is rounded down to a power of two, so that a hash can be masked to find its entry.
+func newTranspositionTable(sizeMB int) *transpositionTable {
+	count := uint64(sizeMB) * 1024 * 1024 / uint64(unsafe.Sizeof(ttEntry{}))
+	if count == 0 {
+		return &transpositionTable{}
+	}
+
+	for count&(count-1) != 0 {
+		count &= count - 1
+	}
+
+	return &transpositionTable{entries: make([]ttEntry, count), mask: count - 1}
+}
+
+// newSearch ages the entries in the table, so that those left from earlier searches are the first
+// to be replaced.
+func (tt *transpositionTable) newSearch() {
+	tt.age++
+}
+
+func (tt *transpositionTable) clear() {
+	for i := range tt.entries {
+		tt.entries[i] = ttEntry{}
+	}
+	tt.age = 0
+}
+
+// probe returns the entry for the position with the given hash, if there is one.
+func (tt *transpositionTable) probe(hash uint64) (ttEntry, bool) {
+	if len(tt.entries) == 0 {
+		return ttEntry{}, false
+	}
+
+	entry := tt.entries[hash&tt.mask]
+	return entry, entry.bound != 0 && entry.hash == hash
+}
+
+// store records what was found for the position with the given hash, at the given ply from the
+// root of the search. The entry it would go in is replaced unless it holds a different position,
+// searched deeper, by the same search, as that's likely the more useful to keep.
+func (tt *transpositionTable) store(hash uint64, depth int, ply int, score int, bound ttBound, m bbMove) {
+	if len(tt.entries) == 0 {
+		return
+	}
+
+	entry := &tt.entries[hash&tt.mask]
+	if entry.bound != 0 && entry.hash != hash && entry.age == tt.age && int(entry.depth) > depth {
+		return
+	}
+
+	// Keep the best move from an earlier search of the position if this one didn't find one.
+	if m == 0 && entry.hash == hash {
+		m = entry.move
+	}
+
+	*entry = ttEntry{hash: hash, move: m, score: int32(getTTScore(score, ply)), depth: int8(depth), bound: bound, age: tt.age}
+}
+
+// getTTScore converts a mate score from a search's root to how far the mate is from the position
+// the score is stored for, which is what it needs to be when the same position is found at a
+// different ply.
+func getTTScore(score int, ply int) int {
+	if isMateScore(score) {
+		if score > 0 {
+			return score + ply
+		}
+		return score - ply
+	}
+
+	return score
+}
+
+// getScore returns the entry's score as seen from the root of a search, the position being the
+// given ply from it.
+func (entry ttEntry) getScore(ply int) int {
+	score := int(entry.score)
+	if isMateScore(score) {
+		if score > 0 {
+			return score - ply
+		}
+		return score + ply
+	}
+
+	return score
+}
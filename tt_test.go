@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewTranspositionTable(t *testing.T) {
+	tt := newTranspositionTable(1)
+	count := len(tt.entries)
+	if count == 0 || count&(count-1) != 0 || tt.mask != uint64(count-1) {
+		t.Errorf("Expected a power of two entries with a mask to match, but got: %d entries, mask %x", count, tt.mask)
+	}
+
+	tt = newTranspositionTable(0)
+	tt.store(1, 1, 0, 100, ttExact, 0)
+	if _, found := tt.probe(1); found {
+		t.Errorf("Expected an empty table to store nothing")
+	}
+}
+
+func TestTranspositionTableStore(t *testing.T) {
+	tt := newTranspositionTable(1)
+	hash := uint64(0x1234)
+	m := newBBMove(12, 28)
+
+	if _, found := tt.probe(hash); found {
+		t.Fatalf("Expected no entry before storing one")
+	}
+
+	tt.store(hash, 3, 0, 50, ttLowerBound, m)
+	entry, found := tt.probe(hash)
+	if !found || entry.move != m || entry.depth != 3 || entry.bound != ttLowerBound || entry.getScore(0) != 50 {
+		t.Errorf("Expected to find the stored entry, but got: %+v", entry)
+	}
+
+	// A different position with the same entry, searched deeper in this search, isn't replaced.
+	other := hash + tt.mask + 1
+	tt.store(other, 2, 0, 10, ttExact, 0)
+	if _, found := tt.probe(other); found {
+		t.Errorf("Expected a shallower search not to replace a deeper one")
+	}
+
+	// But it is in the next search.
+	tt.newSearch()
+	tt.store(other, 2, 0, 10, ttExact, 0)
+	if _, found := tt.probe(other); !found {
+		t.Errorf("Expected an entry from an earlier search to be replaced")
+	}
+
+	// The best move is kept if a later search of the position doesn't find one.
+	tt.store(hash, 4, 0, -20, ttUpperBound, m)
+	tt.store(hash, 5, 0, -30, ttUpperBound, 0)
+	if entry, _ := tt.probe(hash); entry.move != m {
+		t.Errorf("Expected the best move to be kept, but got: %s", entry.move)
+	}
+
+	tt.clear()
+	if _, found := tt.probe(hash); found {
+		t.Errorf("Expected no entries after clearing the table")
+	}
+}
+
+func TestTranspositionTableMateScores(t *testing.T) {
+	tt := newTranspositionTable(1)
+
+	// Mate a ply after a position 3 plies from the root is still a ply after it when the position
+	// is found 2 plies from the root instead.
+	tests := []struct {
+		score    int
+		expected int
+	}{
+		{mateScore - 4, mateScore - 3},
+		{-mateScore + 5, -mateScore + 4},
+		{120, 120},
+	}
+
+	for _, test := range tests {
+		tt.store(1, 1, 3, test.score, ttExact, 0)
+		entry, _ := tt.probe(1)
+		if res := entry.getScore(2); res != test.expected {
+			t.Errorf("Expected score %d stored at ply 3 to be %d at ply 2, but got: %d", test.score, test.expected, res)
+		}
+	}
+}
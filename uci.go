@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	engineName   = "GoChess"
+	engineAuthor = "Andy Butland"
+
+	// With only the time left on the clock to go on, the engine plans for the game to last this
+	// many more moves.
+	defaultMovesToGo = 30
+)
+
+// uciOption is an option the engine offers to a GUI, which sets it with setoption. A "check"
+// option is on or off, which is given to set as 1 or 0.
+type uciOption struct {
+	name         string
+	kind         string
+	defaultValue int
+	min          int
+	max          int
+	set          func(u *uciSession, value int)
+}
+
+var uciOptions = []uciOption{
+	{
+		name: "Hash", kind: "spin", defaultValue: defaultHashSize, min: 1, max: 4096,
+		set: func(u *uciSession, value int) { u.engine.tt = newTranspositionTable(value) },
+	},
+	{
+		name: "Move Overhead", kind: "spin", defaultValue: 50, min: 0, max: 5000,
+		set: func(u *uciSession, value int) { u.moveOverhead = time.Duration(value) * time.Millisecond },
+	},
+	{
+		name: "UCI_Chess960", kind: "check", defaultValue: 0, min: 0, max: 1,
+		set: func(u *uciSession, value int) { u.chess960 = value == 1 },
+	},
+	{
+		name: "Auto Queen", kind: "check", defaultValue: 0, min: 0, max: 1,
+		set: func(u *uciSession, value int) { u.autoQueen = value == 1 },
+	},
+}
+
+// uciSession is the state of a conversation with a GUI using the Universal Chess Interface.
+// Searches run in the background, so that the GUI can stop them, and write to the output as they
+// go, so writing is synchronised.
+type uciSession struct {
+	out          io.Writer
+	outMutex     sync.Mutex
+	position     position
+	engine       *engine
+	searching    sync.WaitGroup
+	stopInfinite chan struct{}
+	moveOverhead time.Duration
+
+	// Whether the GUI is playing Chess960, where castling is written as the king taking its own
+	// rook.
+	chess960 bool
+
+	// Whether a pawn's move to the last rank given without a promotion piece promotes it to a
+	// queen, rather than being rejected.
+	autoQueen bool
+}
+
+func newUCISession(out io.Writer) *uciSession {
+	u := &uciSession{out: out, position: newPosition(), engine: &engine{}}
+	for _, option := range uciOptions {
+		option.set(u, option.defaultValue)
+	}
+	return u
+}
+
+// runUCI speaks UCI with a GUI over in and out until told to quit, or in is closed. The engine's
+// transposition table starts at the given size in MB, until the GUI sets the Hash option. The
+// engine plays from the book and tablebases, if it's given them.
+func runUCI(in io.Reader, out io.Writer, hashSize int, book *polyglotBook, tb *tablebase) {
+	u := newUCISession(out)
+	if hashSize != defaultHashSize {
+		u.engine.tt = newTranspositionTable(hashSize)
+	}
+	u.engine.book = book
+	u.engine.tablebase = tb
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if !u.handleCommand(scanner.Text()) {
+			break
+		}
+	}
+
+	u.stopSearch()
+}
+
+func (u *uciSession) send(format string, args ...interface{}) {
+	u.outMutex.Lock()
+	defer u.outMutex.Unlock()
+	fmt.Fprintf(u.out, format+"\n", args...)
+}
+
+// handleCommand acts on a command from the GUI, returning false if it's time to quit. Commands
+// that aren't understood are ignored, as the protocol requires.
+func (u *uciSession) handleCommand(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+
+	switch fields[0] {
+	case "uci":
+		u.send("id name %s", engineName)
+		u.send("id author %s", engineAuthor)
+		for _, option := range uciOptions {
+			if option.kind == "check" {
+				u.send("option name %s type check default %t", option.name, option.defaultValue == 1)
+				continue
+			}
+
+			u.send("option name %s type %s default %d min %d max %d", option.name, option.kind, option.defaultValue, option.min, option.max)
+		}
+		u.send("uciok")
+	case "isready":
+		u.send("readyok")
+	case "ucinewgame":
+		u.stopSearch()
+		u.position = newPosition()
+		u.engine.tt.clear()
+	case "position":
+		u.stopSearch()
+		if err := u.setPosition(fields[1:]); err != nil {
+			u.send("info string %s", err)
+		}
+	case "go":
+		u.stopSearch()
+		u.startSearch(fields[1:])
+	case "stop":
+		u.stopSearch()
+	case "setoption":
+		// Options such as the transposition table's size are used by the search, so it's stopped
+		// before one is changed.
+		u.stopSearch()
+		if err := u.setOption(fields[1:]); err != nil {
+			u.send("info string %s", err)
+		}
+	case "quit":
+		return false
+	}
+
+	return true
+}
+
+// setPosition sets up the position from the arguments of a position command: "startpos" or
+// "fen" followed by a FEN, then optionally "moves" followed by moves given in long algebraic
+// notation, e.g. e2e4 or e7e8q.
+func (u *uciSession) setPosition(args []string) error {
+	var p position
+	var err error
+	i := 0
+	switch {
+	case len(args) > 0 && args[0] == "startpos":
+		p = newPosition()
+		i = 1
+	case len(args) > 0 && args[0] == "fen":
+		for i = 1; i < len(args) && args[i] != "moves"; i++ {
+		}
+		p, err = parseFEN(strings.Join(args[1:i], " "))
+		if err != nil {
+			return err
+		}
+		if p.variant != standardChess {
+			return fmt.Errorf("The engine only plays standard chess, not %s.", strings.ToLower(p.variant.String()))
+		}
+	default:
+		return errors.New("Position not recognised (expected startpos or fen).")
+	}
+
+	if i < len(args) && args[i] == "moves" {
+		for _, entry := range args[i+1:] {
+			m, err := getUCIMove(p, entry)
+			if err != nil && u.autoQueen && len(entry) == 4 {
+				if queened, queenErr := getUCIMove(p, entry+"q"); queenErr == nil {
+					m, err = queened, nil
+				}
+			}
+			if err != nil {
+				return err
+			}
+			p.makeMove(m)
+		}
+	}
+
+	u.position = p
+	return nil
+}
+
+// getUCIMove returns the legal move in the position that a move in long algebraic notation
+// describes.
+func getUCIMove(p position, entry string) (move, error) {
+	if !isSquaresMoveInput(entry) || strings.Contains(entry, "-") {
+		return move{}, fmt.Errorf("Move '%s' not recognised.", entry)
+	}
+
+	fromSquare, _ := getSquareFromNotation(entry[0:2])
+	toSquare, _ := getSquareFromNotation(entry[2:4])
+	return findLegalMove(p, fromSquare, toSquare, strings.ToUpper(entry[4:]))
+}
+
+// setOption sets an option from the arguments of a setoption command: "name", the option's
+// name, which may contain spaces, then "value" and its value.
+func (u *uciSession) setOption(args []string) error {
+	var name, value []string
+	current := &name
+	for _, arg := range args {
+		switch arg {
+		case "name":
+			current = &name
+		case "value":
+			current = &value
+		default:
+			*current = append(*current, arg)
+		}
+	}
+
+	for _, option := range uciOptions {
+		if !strings.EqualFold(option.name, strings.Join(name, " ")) {
+			continue
+		}
+
+		if option.kind == "check" {
+			switch strings.ToLower(strings.Join(value, " ")) {
+			case "true":
+				option.set(u, 1)
+			case "false":
+				option.set(u, 0)
+			default:
+				return fmt.Errorf("Value for option %s must be true or false.", option.name)
+			}
+			return nil
+		}
+
+		n, err := strconv.Atoi(strings.Join(value, " "))
+		if err != nil || n < option.min || n > option.max {
+			return fmt.Errorf("Value for option %s must be a number from %d to %d.", option.name, option.min, option.max)
+		}
+
+		option.set(u, n)
+		return nil
+	}
+
+	return fmt.Errorf("Option '%s' not recognised.", strings.Join(name, " "))
+}
+
+// startSearch starts searching the position in the background, with limits from the arguments of
+// a go command. When the search finishes, it sends the best move found.
+func (u *uciSession) startSearch(args []string) {
+	limits, infinite := u.getSearchLimits(args)
+	p := u.position
+	e := u.engine
+	e.clearStop()
+	e.onInfo = func(info searchInfo) {
+		u.send("%s", getUCIInfo(info, u.chess960))
+	}
+
+	stopInfinite := make(chan struct{})
+	u.stopInfinite = stopInfinite
+	u.searching.Add(1)
+	go func() {
+		defer u.searching.Done()
+
+		bestMove := "0000"
+		if len(generateLegalMoves(p)) > 0 {
+			result := e.search(p, limits)
+			bestMove = getUCIMoveString(result.bestMove, u.chess960)
+
+			// A move from the tablebases is found without searching, but its score is still worth
+			// giving.
+			if result.tablebase {
+				u.send("%s", getUCIInfo(result, u.chess960))
+			}
+		}
+
+		// An infinite search mustn't give its move until it's told to stop, even if it has
+		// finished searching.
+		if infinite {
+			<-stopInfinite
+		}
+
+		u.send("bestmove %s", bestMove)
+	}()
+}
+
+// stopSearch stops any search in progress, and waits for it to send its best move.
+func (u *uciSession) stopSearch() {
+	u.engine.stop()
+	if u.stopInfinite != nil {
+		close(u.stopInfinite)
+		u.stopInfinite = nil
+	}
+
+	u.searching.Wait()
+}
+
+// getSearchLimits works out the limits of a search from the arguments of a go command, returning
+// whether it's an infinite search, which has none.
+func (u *uciSession) getSearchLimits(args []string) (searchLimits, bool) {
+	values := map[string]int{}
+	infinite := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "infinite":
+			infinite = true
+		case "depth", "movetime", "wtime", "btime", "winc", "binc", "movestogo":
+			if i+1 < len(args) {
+				values[args[i]], _ = strconv.Atoi(args[i+1])
+				i++
+			}
+		}
+	}
+
+	limits := searchLimits{depth: values["depth"], moveTime: time.Duration(values["movetime"]) * time.Millisecond}
+	if infinite {
+		return searchLimits{}, true
+	}
+
+	timeLeft, increment := values["wtime"], values["winc"]
+	if u.position.sideToMove == "B" {
+		timeLeft, increment = values["btime"], values["binc"]
+	}
+
+	if limits.moveTime == 0 && timeLeft > 0 {
+		limits.moveTime = getMoveTime(time.Duration(timeLeft)*time.Millisecond, time.Duration(increment)*time.Millisecond, values["movestogo"], u.moveOverhead)
+	}
+
+	return limits, false
+}
+
+// getMoveTime shares out the time left on the clock between the moves still to play, keeping back
+// enough to cover the delay in getting each move to the GUI.
+func getMoveTime(timeLeft time.Duration, increment time.Duration, movesToGo int, overhead time.Duration) time.Duration {
+	if movesToGo <= 0 {
+		movesToGo = defaultMovesToGo
+	}
+
+	moveTime := timeLeft/time.Duration(movesToGo) + increment*3/4
+	if maxTime := timeLeft - overhead; moveTime > maxTime {
+		moveTime = maxTime
+	}
+
+	if moveTime < time.Millisecond {
+		moveTime = time.Millisecond
+	}
+
+	return moveTime
+}
+
+// getUCIMoveString returns the move in long algebraic form, with castling written as the king
+// taking its own rook if the GUI is playing Chess960.
+func getUCIMoveString(m move, chess960 bool) string {
+	if chess960 && m.isCastling {
+		return getNotationForSquare(m.fromSquare) + getNotationForSquare(m.rookSquare)
+	}
+
+	return m.String()
+}
+
+// getUCIInfo describes the result of searching to a depth as a UCI info line.
+func getUCIInfo(info searchInfo, chess960 bool) string {
+	var score string
+	if isMateScore(info.score) {
+		score = fmt.Sprintf("mate %d", getMateMoves(info.score))
+	} else {
+		score = fmt.Sprintf("cp %d", info.score)
+	}
+
+	ms := info.elapsed.Milliseconds()
+	nps := 0
+	if ms > 0 {
+		nps = int(int64(info.nodes) * 1000 / ms)
+	}
+
+	var pv []string
+	for _, m := range info.pv {
+		pv = append(pv, getUCIMoveString(m, chess960))
+	}
+
+	return fmt.Sprintf("info depth %d score %s nodes %d nps %d time %d pv %s", info.depth, score, info.nodes, nps, ms, strings.Join(pv, " "))
+}
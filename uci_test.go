@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunUCI(t *testing.T) {
+	input := strings.Join([]string{
+		"uci",
+		"isready",
+		"setoption name Move Overhead value 100",
+		"setoption name Hash value 1",
+		"ucinewgame",
+		"position startpos moves e2e4 e7e5 g1f3",
+		"go depth 1",
+		"quit",
+	}, "\n")
+
+	var out bytes.Buffer
+	runUCI(strings.NewReader(input), &out, defaultHashSize, nil, nil)
+
+	expected := "id name GoChess\nid author Andy Butland\n" +
+		"option name Hash type spin default 16 min 1 max 4096\n" +
+		"option name Move Overhead type spin default 50 min 0 max 5000\n" +
+		"option name UCI_Chess960 type check default false\n" +
+		"option name Auto Queen type check default false\nuciok\nreadyok\n" +
+		"info depth 1 score cp 0 nodes 49 nps"
+	if !strings.HasPrefix(out.String(), expected) || !strings.HasSuffix(out.String(), "bestmove b8c6\n") {
+		t.Errorf("Expected UCI output to start:\n%s\nand end with bestmove b8c6, but got:\n%s", expected, out.String())
+	}
+}
+
+func TestUCISearch(t *testing.T) {
+	var out bytes.Buffer
+	u := newUCISession(&out)
+	u.handleCommand("position fen 7k/8/8/8/8/8/R7/1R4K1 w - - 0 1")
+	u.handleCommand("go depth 4")
+	u.searching.Wait()
+
+	for _, expected := range []string{"info depth 4 score mate 2 ", " pv b1b7 h8g8 a2a8\n", "bestmove b1b7\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected UCI output to contain '%s', but got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestUCIChess960(t *testing.T) {
+	var out bytes.Buffer
+	u := newUCISession(&out)
+	u.handleCommand("setoption name UCI_Chess960 value true")
+	u.handleCommand("position fen 6k1/8/8/8/8/8/5PPP/4K2R w K - 0 1 moves e1h1 g8h8")
+	if fen := u.position.toFEN(); fen != "7k/8/8/8/8/8/5PPP/5RK1 w - - 2 2" {
+		t.Errorf("Expected castling given as the king taking its rook to be played, but got: %s", fen)
+	}
+
+	// Castling is written as the king taking its own rook.
+	p, _ := parseFEN("7k/8/8/8/8/8/5PPP/4K2R w K - 0 1")
+	m, _ := getUCIMove(p, "e1g1")
+	if res := getUCIMoveString(m, true); res != "e1h1" {
+		t.Errorf("Expected castling to be written as e1h1 in Chess960, but got: %s", res)
+	}
+	if res := getUCIMoveString(m, false); res != "e1g1" {
+		t.Errorf("Expected castling to be written as e1g1 in standard chess, but got: %s", res)
+	}
+
+	u.handleCommand("setoption name UCI_Chess960 value maybe")
+	if !strings.Contains(out.String(), "info string Value for option UCI_Chess960 must be true or false.") {
+		t.Errorf("Expected an error setting UCI_Chess960 to maybe, but got:\n%s", out.String())
+	}
+}
+
+func TestUCIStopInfiniteSearch(t *testing.T) {
+	var out bytes.Buffer
+	u := newUCISession(&out)
+	u.handleCommand("position startpos")
+	u.handleCommand("go infinite")
+	time.Sleep(50 * time.Millisecond)
+	u.handleCommand("stop")
+
+	if !strings.Contains(out.String(), "bestmove ") {
+		t.Errorf("Expected stopping an infinite search to give the best move, but got:\n%s", out.String())
+	}
+}
+
+func TestUCISetOptionDuringSearch(t *testing.T) {
+	var out bytes.Buffer
+	u := newUCISession(&out)
+	u.handleCommand("position startpos")
+	u.handleCommand("go infinite")
+	time.Sleep(50 * time.Millisecond)
+	u.handleCommand("setoption name Hash value 1")
+
+	if !strings.Contains(out.String(), "bestmove ") {
+		t.Errorf("Expected setting an option to stop the search first, but got:\n%s", out.String())
+	}
+	if expected := newTranspositionTable(1); len(u.engine.tt.entries) != len(expected.entries) {
+		t.Errorf("Expected the transposition table to have %d entries, but got: %d", len(expected.entries), len(u.engine.tt.entries))
+	}
+}
+
+func TestUCISetPosition(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"position startpos", StartingFEN},
+		{"position startpos moves e2e4 c7c5", "rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2"},
+		{"position fen 4k3/1P6/8/8/8/8/8/4K3 w - - 0 1 moves b7b8n", "1N2k3/8/8/8/8/8/8/4K3 b - - 0 1"},
+	}
+
+	for _, test := range tests {
+		u := newUCISession(&bytes.Buffer{})
+		if err := u.setPosition(strings.Fields(test.command)[1:]); err != nil {
+			t.Errorf("Unexpected error setting position with '%s': %s", test.command, err)
+			continue
+		}
+
+		if u.position.toFEN() != test.expected {
+			t.Errorf("Expected '%s' to set position %s, but got: %s", test.command, test.expected, u.position.toFEN())
+		}
+	}
+
+	u := newUCISession(&bytes.Buffer{})
+	for _, command := range []string{"position", "position startpos moves e2e5", "position fen 8/8 w - - 0 1",
+		"position fen 4k3/1P6/8/8/8/8/8/4K3 w - - 0 1 moves b7b8"} {
+		if err := u.setPosition(strings.Fields(command)[1:]); err == nil {
+			t.Errorf("Expected error setting position with '%s' but got none", command)
+		}
+	}
+
+	// With Auto Queen set, a promotion without its piece is to a queen.
+	u.setOption(strings.Fields("name Auto Queen value true"))
+	if err := u.setPosition(strings.Fields("fen 4k3/1P6/8/8/8/8/8/4K3 w - - 0 1 moves b7b8")); err != nil {
+		t.Errorf("Expected b7b8 to promote to a queen with Auto Queen set, but got: %s", err)
+	} else if expected := "1Q2k3/8/8/8/8/8/8/4K3 b - - 0 1"; u.position.toFEN() != expected {
+		t.Errorf("Expected b7b8 to promote to a queen with Auto Queen set, giving %s, but got: %s", expected, u.position.toFEN())
+	}
+}
+
+func TestGetMoveTime(t *testing.T) {
+	tests := []struct {
+		timeLeft  time.Duration
+		increment time.Duration
+		movesToGo int
+		expected  time.Duration
+	}{
+		{60 * time.Second, 0, 0, 2 * time.Second},
+		{60 * time.Second, 0, 20, 3 * time.Second},
+		{60 * time.Second, 2 * time.Second, 0, 3500 * time.Millisecond},
+		{100 * time.Millisecond, time.Second, 0, 50 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		res := getMoveTime(test.timeLeft, test.increment, test.movesToGo, 50*time.Millisecond)
+		if res != test.expected {
+			t.Errorf("Expected move time of %v with %v left, %v increment and %d moves to go, but got: %v", test.expected, test.timeLeft, test.increment, test.movesToGo, res)
+		}
+	}
+}
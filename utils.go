@@ -23,3 +23,11 @@ func maxOf(vars ...int) int {
 
 	return max
 }
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+
+	return i
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// variant is the set of rules a game is played by. Chess960 is played by the rules of standard
+// chess, from a different starting position, so it isn't a variant here (see position.chess960).
+type variant int
+
+const (
+	standardChess variant = iota
+	crazyhouse
+	atomicChess
+	threeCheck
+	kingOfTheHill
+	antichess
+	horde
+	racingKings
+)
+
+// variantNames are the names of the variants, as given with -variant and in PGN's Variant tag.
+var variantNames = []string{"Standard", "Crazyhouse", "Atomic", "Three-check", "King of the Hill", "Antichess", "Horde", "Racing Kings"}
+
+// variantStartingFENs are the positions of the variants that don't start from standard chess's.
+var variantStartingFENs = map[variant]string{
+	horde:       "rnbqkbnr/pppppppp/8/1PP2PP1/PPPPPPPP/PPPPPPPP/PPPPPPPP/PPPPPPPP w kq - 0 1",
+	racingKings: "8/8/8/8/8/8/krbnNBRK/qrbnNBRQ w - - 0 1",
+}
+
+// threeCheckChecks is the number of checks that wins in three-check.
+const threeCheckChecks = 3
+
+// hillSquares are the centre squares a king wins by reaching in King of the Hill.
+var hillSquares = []square{{file: "D", rank: 4}, {file: "E", rank: 4}, {file: "D", rank: 5}, {file: "E", rank: 5}}
+
+func (v variant) String() string {
+	return variantNames[v]
+}
+
+// parseVariant reads a variant by its name, in any case, with or without its spaces and hyphens,
+// e.g. "kingofthehill" or "threecheck".
+func parseVariant(name string) (variant, error) {
+	for v, variantName := range variantNames {
+		if strings.EqualFold(stripVariantName(name), stripVariantName(variantName)) {
+			return variant(v), nil
+		}
+	}
+
+	return standardChess, fmt.Errorf("Variant '%s' not recognised (must be one of %s).", name, strings.ToLower(strings.Join(variantNames, ", ")))
+}
+
+func stripVariantName(name string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(name)
+}
+
+// getVariantWin returns the side that has won by the variant's own rules, rather than by
+// checkmate, and how, or an empty string if neither has. In antichess, a side wins by having no
+// moves left, whether it has lost all its pieces or is stalemated.
+func (p position) getVariantWin() (string, string) {
+	if p.variant == antichess && len(generateLegalMoves(p)) == 0 {
+		if p.board.hasPieces(p.sideToMove) {
+			return p.sideToMove, fmt.Sprintf("%s is stalemated", p.sideToMove)
+		}
+
+		return p.sideToMove, fmt.Sprintf("%s has lost all its pieces", p.sideToMove)
+	}
+
+	return p.getVariantGoalWin()
+}
+
+// getVariantGoalWin returns the side that has won by reaching the variant's goal, which ends the
+// game while there are still moves that could be made, and how, or an empty string if neither
+// has. In atomic, blowing up the other side's king wins, in three-check, giving a third check, in
+// King of the Hill, getting the king to one of the four centre squares, and in Racing Kings, to
+// the eighth rank. In horde, black wins by taking all of white's pieces.
+func (p position) getVariantGoalWin() (string, string) {
+	switch p.variant {
+	case atomicChess:
+		for _, color := range []string{"W", "B"} {
+			if _, err := p.board.getSquareForPiece(color, "K"); err != nil {
+				return switchColor(color), fmt.Sprintf("The %s king has exploded", color)
+			}
+		}
+	case threeCheck:
+		for _, color := range []string{"W", "B"} {
+			if *p.getChecks(color) >= threeCheckChecks {
+				return color, fmt.Sprintf("The %s king has been checked %d times", switchColor(color), threeCheckChecks)
+			}
+		}
+	case kingOfTheHill:
+		for _, color := range []string{"W", "B"} {
+			kingSquare, _ := p.board.getSquareForPiece(color, "K")
+			for _, sq := range hillSquares {
+				if areSquaresEqual(kingSquare, sq) {
+					return color, fmt.Sprintf("The %s king has reached the centre", color)
+				}
+			}
+		}
+	case horde:
+		if !p.board.hasPieces("W") {
+			return "B", "W has lost all its pieces"
+		}
+	case racingKings:
+		return p.getRacingKingsWin()
+	}
+
+	return "", ""
+}
+
+// getVariantDrawReason returns why the game is drawn by the variant's own rules, or an empty
+// string if it isn't. In Racing Kings, it's a draw if black's king reaches the eighth rank on the
+// move straight after white's does.
+func (p position) getVariantDrawReason() string {
+	if p.variant == racingKings && p.hasKingOnLastRank("W") && p.hasKingOnLastRank("B") {
+		return "Both kings have reached the eighth rank"
+	}
+
+	return ""
+}
+
+// newVariantPosition returns the position the variant's games start from. There's no castling in
+// antichess.
+func newVariantPosition(v variant) position {
+	if fen, ok := variantStartingFENs[v]; ok {
+		p, _ := parseVariantFEN(fen, v)
+		return p
+	}
+
+	p := newPosition()
+	p.variant = v
+	if v == antichess {
+		p.castlingRights = castlingRights{}
+		p.hash = p.getHash()
+	}
+	return p
+}
+
+// getKingCounts returns the number of kings each side has, by colour index, in the variant's
+// positions, or -1 if it may have any number. In horde, white has none, and in antichess, kings
+// are ordinary pieces, so either side may have any number.
+func (v variant) getKingCounts() [2]int {
+	switch v {
+	case horde:
+		return [2]int{0, 1}
+	case antichess:
+		return [2]int{-1, -1}
+	}
+
+	return [2]int{1, 1}
+}
+
+// getPromotionPieceNames returns the pieces a pawn can be promoted to in the variant: a queen,
+// rook, bishop or knight, or in antichess, a king too.
+func (v variant) getPromotionPieceNames() []string {
+	if v == antichess {
+		return append(promotionPieceNames[:len(promotionPieceNames):len(promotionPieceNames)], "K")
+	}
+
+	return promotionPieceNames
+}
+
+// listPieceNames writes piece names as a list for messages, e.g. "Q, R, B or N".
+func listPieceNames(names []string) string {
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// getChecks returns the number of checks the side has given in three-check.
+func (p *position) getChecks(color string) *int {
+	if color == "W" {
+		return &p.checks[white]
+	}
+
+	return &p.checks[black]
+}
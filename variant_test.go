@@ -0,0 +1,347 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVariant(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected variant
+	}{
+		{"standard", standardChess},
+		{"Crazyhouse", crazyhouse},
+		{"ATOMIC", atomicChess},
+		{"Three-check", threeCheck},
+		{"threecheck", threeCheck},
+		{"King of the Hill", kingOfTheHill},
+		{"kingOfTheHill", kingOfTheHill},
+	}
+
+	for _, test := range tests {
+		if v, err := parseVariant(test.name); err != nil || v != test.expected {
+			t.Errorf("Expected variant '%s' to be %s, but got: %s (%v)", test.name, test.expected, v, err)
+		}
+	}
+
+	if _, err := parseVariant("suicide"); err == nil {
+		t.Errorf("Expected an error for variant 'suicide', but got none")
+	}
+}
+
+func TestVariantPerftMatchesStandard(t *testing.T) {
+	// Neither side can win by the variants' own rules in the first four plies, so the move counts
+	// are standard chess's.
+	for _, v := range []variant{threeCheck, kingOfTheHill} {
+		p := newVariantPosition(v)
+		for i, expected := range []int{20, 400, 8902, 197281} {
+			if testing.Short() && expected > perftShortMaxNodes {
+				continue
+			}
+
+			if res := perft(p, i+1); res != expected {
+				t.Errorf("Expected %s perft(%d) to be %d, but got: %d", v, i+1, expected, res)
+			}
+		}
+	}
+}
+
+func TestThreeCheck(t *testing.T) {
+	tests := []struct {
+		fen      string
+		san      string
+		expected string
+		winner   string
+	}{
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 3+3 0 1", "Ra8+", "R3k3/8/8/8/8/8/8/4K3 b - - 2+3 1 1", ""},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 1+3 0 1", "Ra8#", "R3k3/8/8/8/8/8/8/4K3 b - - 0+3 1 1", "W"},
+		{"4k3/8/8/8/8/8/8/R3K3 w - - 1+3 0 1", "Ra7", "4k3/R7/8/8/8/8/8/4K3 b - - 1+3 1 1", ""},
+		{"4k3/8/8/8/8/8/r7/4K3 b - - 3+1 0 1", "Ra1#", "4k3/8/8/8/8/8/8/r3K3 w - - 3+0 1 2", "B"},
+	}
+
+	for _, test := range tests {
+		p, err := parseFEN(test.fen)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		m, err := resolveSAN(p, test.san)
+		if err != nil {
+			t.Errorf("Expected %s to be legal in %s, but got: %s", test.san, test.fen, err)
+			continue
+		}
+
+		if san := getSAN(p, m); san != test.san {
+			t.Errorf("Expected the move in %s to be written as %s, but got: %s", test.fen, test.san, san)
+		}
+
+		start := p
+		u := p.makeMove(m)
+		if p.toFEN() != test.expected || p.hash != p.getHash() {
+			t.Errorf("Expected %s in %s to give %s, but got: %s", test.san, test.fen, test.expected, p.toFEN())
+		}
+
+		if winner, _ := p.getVariantWin(); winner != test.winner {
+			t.Errorf("Expected the winner after %s in %s to be '%s', but got: '%s'", test.san, test.fen, test.winner, winner)
+		}
+
+		if test.winner != "" && len(generateLegalMoves(p)) != 0 {
+			t.Errorf("Expected no legal moves once the game is won after %s in %s", test.san, test.fen)
+		}
+
+		p.unmakeMove(m, u)
+		if p != start {
+			t.Errorf("Expected taking back %s to restore %s, but got: %s", test.san, test.fen, p.toFEN())
+		}
+	}
+}
+
+func TestThreeCheckHashIncludesChecks(t *testing.T) {
+	p1, _ := parseFEN("4k3/8/8/8/8/8/8/R3K3 w - - 3+3 0 1")
+	p2, _ := parseFEN("4k3/8/8/8/8/8/8/R3K3 w - - 2+3 0 1")
+	if p1.hash == p2.hash {
+		t.Errorf("Expected positions with different checks given to have different hashes")
+	}
+
+	p3, _ := parseFEN("4k3/8/8/8/8/8/8/R3K3 w - - 0 1 +1+0")
+	if p2 != p3 {
+		t.Errorf("Expected checks given to be read the same as checks left, but got: %s", p3.toFEN())
+	}
+}
+
+func TestKingOfTheHill(t *testing.T) {
+	tests := []struct {
+		fen    string
+		san    string
+		winner string
+	}{
+		{"4k3/8/8/8/8/4K3/8/8 w - - 0 1", "Ke4#", "W"},
+		{"4k3/8/8/8/8/4K3/8/8 w - - 0 1", "Kf4", ""},
+		{"8/8/2k5/8/8/8/8/4K3 b - - 0 1", "Kd5#", "B"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		p.variant = kingOfTheHill
+		m, err := resolveSAN(p, test.san)
+		if err != nil {
+			t.Errorf("Expected %s to be legal in %s, but got: %s", test.san, test.fen, err)
+			continue
+		}
+
+		if san := getSAN(p, m); san != test.san {
+			t.Errorf("Expected the move in %s to be written as %s, but got: %s", test.fen, test.san, san)
+		}
+
+		p.makeMove(m)
+		if winner, reason := p.getVariantWin(); winner != test.winner {
+			t.Errorf("Expected the winner after %s in %s to be '%s', but got: '%s' (%s)", test.san, test.fen, test.winner, winner, reason)
+		}
+	}
+}
+
+func TestVariantInsufficientMaterial(t *testing.T) {
+	tests := []struct {
+		fen      string
+		v        variant
+		expected bool
+	}{
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", threeCheck, true},
+		{"4k3/8/8/8/8/8/8/3NK3 w - - 0 1", threeCheck, false},
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", kingOfTheHill, false},
+	}
+
+	for _, test := range tests {
+		p, _ := parseFEN(test.fen)
+		p.variant = test.v
+		if res := p.hasInsufficientMaterial(); res != test.expected {
+			t.Errorf("Expected insufficient material in %s in %s to be %t, but got: %t", test.v, test.fen, test.expected, res)
+		}
+	}
+}
+
+func TestVariantPGN(t *testing.T) {
+	tests := []struct {
+		v     variant
+		moves []string
+		tag   string
+	}{
+		{threeCheck, []string{"e4", "e5", "Bc4", "Nc6", "Bxf7+", "Kxf7", "Qh5+"}, "Three-check"},
+		{kingOfTheHill, []string{"e4", "e5", "Ke2", "Ke7", "Ke3", "Ke6", "Kf3"}, "King of the Hill"},
+		{horde, []string{"b6", "axb6", "c6", "Nf6"}, "Horde"},
+		{racingKings, []string{"Kg3", "Kb3"}, "Racing Kings"},
+	}
+
+	for _, test := range tests {
+		g := newGame(newVariantPosition(test.v))
+		for _, san := range test.moves {
+			m, err := getMoveFromInput(g.position, san)
+			if err != nil {
+				t.Fatalf("Unexpected error playing %s in %s: %s", san, test.v, err)
+			}
+			g.makeMove(m)
+		}
+
+		pg := g.toPGN()
+		if _, ok := pg.tags["FEN"]; ok || pg.tags["Variant"] != test.tag {
+			t.Errorf("Expected a %s game with no FEN, but got:\n%s", test.v, pg)
+		}
+
+		games, err := parsePGN(pg.String())
+		if err != nil || len(games) != 1 {
+			t.Fatalf("Unexpected error reading PGN: %v", err)
+		}
+
+		if p := games[0].getPositionAfter(len(games[0].moves)); p.toFEN() != g.position.toFEN() || p.variant != test.v {
+			t.Errorf("Expected the %s game read from PGN to reach %s, but got: %s", test.v, g.position.toFEN(), p.toFEN())
+		}
+	}
+}
+
+func TestHordeAndRacingKingsPerft(t *testing.T) {
+	tests := []struct {
+		v      variant
+		counts []int
+	}{
+		{horde, []int{8, 128, 1274, 23310}},
+		{racingKings, []int{21, 421, 11264, 296242}},
+	}
+
+	for _, test := range tests {
+		p := newVariantPosition(test.v)
+		for i, expected := range test.counts {
+			if testing.Short() && expected > perftShortMaxNodes {
+				continue
+			}
+
+			if res := perft(p, i+1); res != expected {
+				t.Errorf("Expected %s perft(%d) to be %d, but got: %d", test.v, i+1, expected, res)
+			}
+		}
+	}
+}
+
+func TestHorde(t *testing.T) {
+	tests := []struct {
+		fen      string
+		san      string
+		expected string
+		winner   string
+	}{
+		// Test: a pawn on the first rank can move two squares, but can't be taken en passant
+		{"4k3/8/8/8/8/8/1p6/P7 w - - 0 1", "a3", "4k3/8/8/8/8/P7/1p6/8 b - - 0 1", ""},
+		{"4k3/8/8/8/8/1p6/8/P7 w - - 0 1", "a3", "4k3/8/8/8/8/Pp6/8/8 b - - 0 1", ""},
+		{"4k3/8/8/8/8/8/8/P7 w - - 0 1", "a2", "4k3/8/8/8/8/8/P7/8 b - - 0 1", ""},
+		// Test: taking white's last piece wins for black
+		{"8/8/8/8/8/8/1k6/P7 b - - 0 1", "Kxa1#", "8/8/8/8/8/8/8/k7 w - - 0 2", "B"},
+		// Test: white, with no king, can't be in check, but can checkmate
+		{"7k/P5pp/8/8/8/8/8/7r w - - 0 1", "a8=Q#", "Q6k/6pp/8/8/8/8/8/7r b - - 0 1", "W"},
+	}
+
+	for _, test := range tests {
+		p, err := parseVariantFEN(test.fen, horde)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing FEN %s: %s", test.fen, err)
+		}
+
+		m, err := resolveSAN(p, test.san)
+		if err != nil {
+			t.Errorf("Expected %s to be legal in %s, but got: %s", test.san, test.fen, err)
+			continue
+		}
+
+		if san := getSAN(p, m); san != test.san {
+			t.Errorf("Expected the move in %s to be written as %s, but got: %s", test.fen, test.san, san)
+		}
+
+		p.makeMove(m)
+		if p.toFEN() != test.expected || p.hash != p.getHash() {
+			t.Errorf("Expected %s in %s to give %s, but got: %s", test.san, test.fen, test.expected, p.toFEN())
+		}
+
+		winner, _ := p.getVariantWin()
+		if p.isCheckMate() {
+			winner = switchColor(p.sideToMove)
+		}
+		if winner != test.winner {
+			t.Errorf("Expected the winner after %s in %s to be '%s', but got: '%s'", test.san, test.fen, test.winner, winner)
+		}
+	}
+}
+
+func TestRacingKings(t *testing.T) {
+	tests := []struct {
+		fen    string
+		san    string
+		winner string
+		draw   bool
+	}{
+		// Test: black reaching the eighth rank first wins at once
+		{"8/k7/8/8/8/8/8/7K b - - 0 1", "Ka8#", "B", false},
+		// Test: white reaching it first wins if black can't follow
+		{"8/6K1/8/8/8/8/8/k7 w - - 0 1", "Kg8#", "W", false},
+		{"8/k5K1/8/8/8/8/8/8 w - - 0 1", "Kg8", "", false},
+		// Test: black following white to the eighth rank draws
+		{"6K1/k7/8/8/8/8/8/8 b - - 0 1", "Ka8", "", true},
+	}
+
+	for _, test := range tests {
+		p, _ := parseVariantFEN(test.fen, racingKings)
+		m, err := resolveSAN(p, test.san)
+		if err != nil {
+			t.Errorf("Expected %s to be legal in %s, but got: %s", test.san, test.fen, err)
+			continue
+		}
+
+		if san := getSAN(p, m); san != test.san {
+			t.Errorf("Expected the move in %s to be written as %s, but got: %s", test.fen, test.san, san)
+		}
+
+		p.makeMove(m)
+		if winner, reason := p.getVariantWin(); winner != test.winner {
+			t.Errorf("Expected the winner after %s in %s to be '%s', but got: '%s' (%s)", test.san, test.fen, test.winner, winner, reason)
+		}
+
+		if draw := p.getVariantDrawReason() != ""; draw != test.draw {
+			t.Errorf("Expected a draw after %s in %s to be %t, but got: %t", test.san, test.fen, test.draw, draw)
+		}
+	}
+}
+
+func TestRacingKingsChecksNotAllowed(t *testing.T) {
+	tests := []struct {
+		fen         string
+		move        string
+		description string
+	}{
+		{"8/8/8/8/8/k7/8/1R5K w - - 0 1", "b1a1", "a move giving check"},
+		{"8/8/8/8/8/k7/8/1R5K w - - 0 1", "b1b3", "a move giving check by capturing"},
+		{"8/8/8/8/8/k7/8/1r5K b - - 0 1", "a3a2", "a king moving into check"},
+	}
+
+	for _, test := range tests {
+		p, _ := parseVariantFEN(test.fen, racingKings)
+		if m, err := getUCIMove(p, test.move); err == nil {
+			t.Errorf("Expected %s to be illegal in Racing Kings, but got: %+v", test.description, m)
+		}
+	}
+}
+
+func TestHordeAndRacingKingsFEN(t *testing.T) {
+	for _, v := range []variant{horde, racingKings} {
+		fen := variantStartingFENs[v]
+		p, err := parseVariantFEN(fen, v)
+		if err != nil || p.toFEN() != fen {
+			t.Errorf("Expected the %s starting position to round-trip to %s, but got: %s (%v)", v, fen, p.toFEN(), err)
+		}
+	}
+
+	if _, err := parseFEN(variantStartingFENs[horde]); err == nil {
+		t.Errorf("Expected an error for the horde starting position in standard chess, but got none")
+	}
+
+	if _, err := parseVariantFEN(StartingFEN, horde); err == nil || !strings.Contains(err.Error(), "must be 0 white and 1 black in horde") {
+		t.Errorf("Expected an error for a white king in horde, but got: %v", err)
+	}
+}
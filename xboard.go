@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// xboardSession is the state of a conversation with a GUI using the Chess Engine Communication
+// Protocol, as used by XBoard and WinBoard. The engine plays one side of the game, or neither in
+// force mode, and thinks in the background, so that the GUI can tell it to move now.
+type xboardSession struct {
+	out         io.Writer
+	outMutex    sync.Mutex
+	game        *game
+	engine      *engine
+	engineColor string
+	thinking    sync.WaitGroup
+	cancelled   bool
+
+	// Whether a pawn's move to the last rank given without a promotion piece promotes it to a
+	// queen, rather than being rejected. It's set with the Auto Queen option.
+	autoQueen bool
+
+	// Time controls: a fixed depth (sd) or time (st) per move, or a clock (level) with a number of
+	// moves to make in each period, the time for each period and an increment per move.
+	depth           int
+	moveTime        time.Duration
+	movesPerSession int
+	baseTime        time.Duration
+	increment       time.Duration
+	timeLeft        time.Duration
+}
+
+func newXBoardSession(out io.Writer) *xboardSession {
+	x := &xboardSession{out: out, engine: newEngine(defaultHashSize)}
+	x.newGame(newPosition())
+	return x
+}
+
+// runXBoard speaks CECP with a GUI over in and out until told to quit, or in is closed. The engine's
+// transposition table starts at the given size in MB, until the GUI sends the memory command.
+// The engine plays from the book and tablebases, if it's given them.
+func runXBoard(in io.Reader, out io.Writer, hashSize int, book *polyglotBook, tb *tablebase) {
+	x := newXBoardSession(out)
+	if hashSize != defaultHashSize {
+		x.engine.tt = newTranspositionTable(hashSize)
+	}
+	x.engine.book = book
+	x.engine.tablebase = tb
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if !x.handleCommand(scanner.Text()) {
+			break
+		}
+	}
+
+	x.stopThinking(false)
+}
+
+func (x *xboardSession) send(format string, args ...interface{}) {
+	x.outMutex.Lock()
+	defer x.outMutex.Unlock()
+	fmt.Fprintf(x.out, format+"\n", args...)
+}
+
+// newGame starts a game from the position, with the engine playing black, as the protocol's new
+// command does.
+func (x *xboardSession) newGame(startPosition position) {
+	x.game = newGame(startPosition)
+	x.engineColor = "B"
+}
+
+// handleCommand acts on a command from the GUI, returning false if it's time to quit.
+func (x *xboardSession) handleCommand(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return true
+	}
+
+	command, args := fields[0], fields[1:]
+
+	// Commands that don't affect the game can be handled while the engine is thinking. Any
+	// others stop it first, without it making the move it was thinking about.
+	switch command {
+	case "xboard", "accepted", "rejected", "post", "nopost", "hard", "easy", "random", "computer":
+		return true
+	case "protover":
+		x.send("feature myname=\"%s\" usermove=1 setboard=1 ping=1 playother=1 memory=1 colors=0 sigint=0 sigterm=0 analyze=0 option=\"Auto Queen -check 0\" done=1", engineName)
+		return true
+	case "option":
+		// Options are set as name=value, where a check option's value is 1 or 0.
+		name, value, _ := strings.Cut(strings.Join(args, " "), "=")
+		if name != "Auto Queen" || (value != "0" && value != "1") {
+			x.send("Error (option not recognised): %s", line)
+			return true
+		}
+		x.autoQueen = value == "1"
+		return true
+	case "ping":
+		x.send("pong %s", strings.Join(args, " "))
+		return true
+	case "time", "otim":
+		// Clock times are given in centiseconds.
+		if command == "time" && len(args) > 0 {
+			centiseconds, _ := strconv.Atoi(args[0])
+			x.timeLeft = time.Duration(centiseconds) * 10 * time.Millisecond
+		}
+		return true
+	case "?":
+		x.stopThinking(true)
+		return true
+	case "quit":
+		return false
+	}
+
+	x.stopThinking(false)
+
+	switch command {
+	case "new":
+		x.newGame(newPosition())
+		x.engine.tt.clear()
+		x.depth = 0
+	case "force", "result":
+		x.engineColor = ""
+	case "go":
+		x.engineColor = x.game.position.sideToMove
+	case "playother":
+		x.engineColor = switchColor(x.game.position.sideToMove)
+	case "setboard":
+		p, err := parseFEN(strings.Join(args, " "))
+		if err == nil && p.variant != standardChess {
+			err = fmt.Errorf("The engine only plays standard chess, not %s.", strings.ToLower(p.variant.String()))
+		}
+		if err != nil {
+			x.send("tellusererror Illegal position: %s", err)
+			return true
+		}
+		x.game = newGame(p)
+	case "usermove":
+		if len(args) == 0 {
+			x.send("Error (no move given): usermove")
+			return true
+		}
+
+		m, err := getMoveFromInput(x.game.position, args[0])
+		if err == errNoPromotionPiece && x.autoQueen {
+			m.promotion, err = "Q", nil
+		}
+		if err != nil {
+			x.send("Illegal move (%s): %s", strings.TrimSuffix(err.Error(), "."), args[0])
+			return true
+		}
+
+		x.game.makeMove(m)
+		x.checkGameOver()
+	case "undo":
+		x.game.undoMove()
+	case "remove":
+		x.game.undoMove()
+		x.game.undoMove()
+	case "level":
+		if err := x.setLevel(args); err != nil {
+			x.send("Error (%s): %s", err, line)
+		}
+	case "st":
+		seconds, err := strconv.Atoi(strings.Join(args, ""))
+		if err != nil {
+			x.send("Error (time per move not recognised): %s", line)
+			return true
+		}
+		x.moveTime = time.Duration(seconds) * time.Second
+	case "memory":
+		// The memory the engine may use, in MB, all of which goes to the transposition table.
+		size, err := strconv.Atoi(strings.Join(args, ""))
+		if err != nil || size < 1 {
+			x.send("Error (memory size not recognised): %s", line)
+			return true
+		}
+		x.engine.tt = newTranspositionTable(size)
+	case "sd":
+		depth, err := strconv.Atoi(strings.Join(args, ""))
+		if err != nil {
+			x.send("Error (depth not recognised): %s", line)
+			return true
+		}
+		x.depth = depth
+	default:
+		x.send("Error (unknown command): %s", command)
+	}
+
+	if x.game.position.sideToMove == x.engineColor {
+		x.think()
+	}
+
+	return true
+}
+
+// setLevel sets a clock time control from the arguments of a level command: the number of moves
+// in each period (0 if the whole game is one period), the time for a period in minutes, or
+// minutes:seconds, and the increment in seconds.
+func (x *xboardSession) setLevel(args []string) error {
+	if len(args) != 3 {
+		return errors.New("expected moves, time and increment")
+	}
+
+	movesPerSession, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errors.New("moves per period not recognised")
+	}
+
+	var minutes, seconds int
+	parts := strings.SplitN(args[1], ":", 2)
+	minutes, err = strconv.Atoi(parts[0])
+	if err == nil && len(parts) == 2 {
+		seconds, err = strconv.Atoi(parts[1])
+	}
+	if err != nil {
+		return errors.New("time not recognised")
+	}
+
+	increment, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return errors.New("increment not recognised")
+	}
+
+	x.movesPerSession = movesPerSession
+	x.baseTime = time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+	x.increment = time.Duration(increment * float64(time.Second))
+	x.timeLeft = x.baseTime
+	x.moveTime = 0
+	return nil
+}
+
+func (x *xboardSession) getSearchLimits() searchLimits {
+	limits := searchLimits{depth: x.depth, moveTime: x.moveTime}
+	if limits.moveTime == 0 && x.timeLeft > 0 {
+		movesToGo := 0
+		if x.movesPerSession > 0 {
+			movesToGo = x.movesPerSession - (x.game.position.fullmoveNumber-1)%x.movesPerSession
+		}
+		limits.moveTime = getMoveTime(x.timeLeft, x.increment, movesToGo, 0)
+	}
+
+	if limits.depth == 0 && limits.moveTime == 0 {
+		limits.moveTime = 5 * time.Second
+	}
+
+	return limits
+}
+
+// think searches for the engine's move in the background, and plays it unless it's cancelled.
+func (x *xboardSession) think() {
+	p := x.game.position
+	if len(generateLegalMoves(p)) == 0 {
+		return
+	}
+
+	limits := x.getSearchLimits()
+	e := x.engine
+	e.clearStop()
+	x.cancelled = false
+	x.thinking.Add(1)
+	go func() {
+		defer x.thinking.Done()
+		result := e.search(p, limits)
+
+		x.outMutex.Lock()
+		cancelled := x.cancelled
+		x.outMutex.Unlock()
+		if cancelled {
+			return
+		}
+
+		x.game.makeMove(result.bestMove)
+		x.send("move %s", result.bestMove)
+		x.checkGameOver()
+	}()
+}
+
+// stopThinking stops the engine thinking, if it is, and waits for it to finish. The move it was
+// thinking about is played only if playMove is set.
+func (x *xboardSession) stopThinking(playMove bool) {
+	x.outMutex.Lock()
+	x.cancelled = !playMove
+	x.outMutex.Unlock()
+
+	x.engine.stop()
+	x.thinking.Wait()
+}
+
+// checkGameOver sends the result if the game has ended, after which the engine stops playing.
+func (x *xboardSession) checkGameOver() {
+	p := x.game.position
+	if p.isCheckMate() {
+		winner := switchColor(p.sideToMove)
+		name := getColorName(winner)
+		x.send("%s {%s mates}", getResultForWinner(winner), strings.ToUpper(name[:1])+name[1:])
+	} else if drawReason := x.game.getDrawReason(); drawReason != "" {
+		x.send("1/2-1/2 {%s}", drawReason)
+	} else {
+		return
+	}
+
+	x.engineColor = ""
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestXBoardSession(t *testing.T) {
+	var out bytes.Buffer
+	x := newXBoardSession(&out)
+	for _, command := range []string{"xboard", "protover 2", "new", "sd 1", "usermove e2e4"} {
+		x.handleCommand(command)
+	}
+	x.thinking.Wait()
+
+	if !strings.Contains(out.String(), "feature myname=\"GoChess\" usermove=1 setboard=1") {
+		t.Errorf("Expected features to be sent in reply to protover, but got:\n%s", out.String())
+	}
+
+	if !strings.Contains(out.String(), "\nmove ") || len(x.game.moves) != 2 {
+		t.Errorf("Expected engine to reply to e2e4 as black, but got:\n%s", out.String())
+	}
+
+	// In force mode the engine just records moves, and undo takes them back.
+	out.Reset()
+	x.handleCommand("force")
+	x.handleCommand("usermove g1f3")
+	x.handleCommand("undo")
+	x.handleCommand("usermove d2d5")
+	x.thinking.Wait()
+	if len(x.game.moves) != 2 || out.String() != "Illegal move (Not a legal move (the pawn on d2 can't move to d5)): d2d5\n" {
+		t.Errorf("Expected the engine to make no moves in force mode and reject an illegal move, but got %d moves and:\n%s", len(x.game.moves), out.String())
+	}
+}
+
+func TestXBoardAutoQueen(t *testing.T) {
+	var out bytes.Buffer
+	x := newXBoardSession(&out)
+	for _, command := range []string{"force", "setboard 4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "usermove b7b8"} {
+		x.handleCommand(command)
+	}
+
+	if out.String() != "Illegal move (Not a legal move (no promotion piece given)): b7b8\n" {
+		t.Errorf("Expected a promotion without its piece to be rejected, but got:\n%s", out.String())
+	}
+
+	out.Reset()
+	x.handleCommand("option Auto Queen=1")
+	x.handleCommand("usermove b7b8")
+	if expected := "1Q2k3/8/8/8/8/8/8/4K3 b - - 0 1"; out.String() != "" || x.game.position.toFEN() != expected {
+		t.Errorf("Expected b7b8 to promote to a queen with Auto Queen set, giving %s, but got: %s\n%s", expected, x.game.position.toFEN(), out.String())
+	}
+
+	// The same goes for a promotion written in SAN.
+	x.handleCommand("setboard 4k3/1P6/8/8/8/8/8/4K3 w - - 0 1")
+	x.handleCommand("usermove b8")
+	if expected := "1Q2k3/8/8/8/8/8/8/4K3 b - - 0 1"; out.String() != "" || x.game.position.toFEN() != expected {
+		t.Errorf("Expected b8 to promote to a queen with Auto Queen set, giving %s, but got: %s\n%s", expected, x.game.position.toFEN(), out.String())
+	}
+
+	x.handleCommand("option Auto Queen=yes")
+	if !strings.HasPrefix(out.String(), "Error (option not recognised)") || !x.autoQueen {
+		t.Errorf("Expected an option with a value that isn't 0 or 1 to be rejected, but got:\n%s", out.String())
+	}
+}
+
+func TestXBoardGameOver(t *testing.T) {
+	var out bytes.Buffer
+	x := newXBoardSession(&out)
+	for _, command := range []string{"setboard 7k/8/8/8/8/8/R7/1R4K1 w - - 0 1", "sd 4", "go"} {
+		x.handleCommand(command)
+	}
+	x.thinking.Wait()
+	x.handleCommand("usermove h8g8")
+	x.thinking.Wait()
+
+	expected := "move b1b7\nmove a2a8\n1-0 {White mates}\n"
+	if out.String() != expected {
+		t.Errorf("Expected engine to mate and send the result:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
+
+func TestXBoardSetLevel(t *testing.T) {
+	x := newXBoardSession(&bytes.Buffer{})
+	if err := x.setLevel([]string{"40", "5:30", "2"}); err != nil {
+		t.Fatalf("Unexpected error setting level: %s", err)
+	}
+
+	limits := x.getSearchLimits()
+	if x.baseTime.Seconds() != 330 || x.increment.Seconds() != 2 || limits.moveTime.Seconds() != 9.75 {
+		t.Errorf("Expected 5:30 for 40 moves with 2 seconds increment to allow 9.75s for the first move, but got: %v", limits.moveTime)
+	}
+
+	for _, args := range [][]string{{"40", "5"}, {"x", "5", "0"}, {"40", "5:xx", "0"}, {"40", "5", "x"}} {
+		if err := x.setLevel(args); err == nil {
+			t.Errorf("Expected error setting level %v but got none", args)
+		}
+	}
+}
+
+func TestXBoardMemory(t *testing.T) {
+	var out bytes.Buffer
+	x := newXBoardSession(&out)
+	x.handleCommand("memory 1")
+	if expected := len(newTranspositionTable(1).entries); len(x.engine.tt.entries) != expected {
+		t.Errorf("Expected memory 1 to give a table with %d entries, but got: %d", expected, len(x.engine.tt.entries))
+	}
+
+	x.handleCommand("memory 0")
+	if out.String() != "Error (memory size not recognised): memory 0\n" {
+		t.Errorf("Expected an error for a memory size of 0, but got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import "strings"
+
+// Zobrist keys: a random number for each colour and type of piece on each square, for each set of
+// castling rights, for each file a pawn can be taken en passant on, and for black being to move.
+// A position's hash is the keys for what's in it XORed together, so a move changes the hash by
+// XORing in and out the keys for only what the move changes. Positions that count as repeated have
+// the same hash, so the en passant file is only included if the capture can be made. In crazyhouse,
+// there's a key for each piece a side can hold in its pocket: the first, second and so on of each
+// type. A pocket can hold at most 16 pawns, which all the other pieces captured could be. In
+// three-check, there's a key for each check a side can give before the one that wins.
+var (
+	zobristPieces      [2][6][64]uint64
+	zobristCastling    [16]uint64
+	zobristEnPassant   [8]uint64
+	zobristBlackToMove uint64
+	zobristPockets     [2][len(pocketPieceNames)][16]uint64
+	zobristChecks      [2][threeCheckChecks]uint64
+)
+
+func init() {
+	// A fixed seed gives the same hashes every time, which makes searches repeatable.
+	rng := xorshift(0x2545f4914f6cdd1d)
+	for color := range zobristPieces {
+		for pieceType := range zobristPieces[color] {
+			for sq := range zobristPieces[color][pieceType] {
+				zobristPieces[color][pieceType][sq] = rng.next()
+			}
+		}
+	}
+
+	for i := range zobristCastling {
+		zobristCastling[i] = rng.next()
+	}
+
+	for i := range zobristEnPassant {
+		zobristEnPassant[i] = rng.next()
+	}
+
+	zobristBlackToMove = rng.next()
+
+	for color := range zobristPockets {
+		for pieceType := range zobristPockets[color] {
+			for i := range zobristPockets[color][pieceType] {
+				zobristPockets[color][pieceType][i] = rng.next()
+			}
+		}
+	}
+
+	for color := range zobristChecks {
+		for i := range zobristChecks[color] {
+			zobristChecks[color][i] = rng.next()
+		}
+	}
+}
+
+// getHash works out the position's hash from scratch. Once worked out, makeMove keeps it up to
+// date as moves are made.
+func (p position) getHash() uint64 {
+	var hash uint64
+	for i := 0; i < BoardSize; i++ {
+		for j := 0; j < BoardSize; j++ {
+			if !p.board.isRowColEmpty(i, j) {
+				hash ^= getZobristPieceKey(p.board[i][j], getSquareForRowCol(i, j))
+			}
+		}
+	}
+
+	hash ^= zobristCastling[p.castlingRights.getBits()]
+	if p.canTakeEnPassant() {
+		hash ^= zobristEnPassant[fromFileStr(p.enPassantSquare.file)]
+	}
+
+	if p.sideToMove == "B" {
+		hash ^= zobristBlackToMove
+	}
+
+	for _, color := range []string{"W", "B"} {
+		pk := p.getPocket(color)
+		for _, name := range pocketPieceNames {
+			for i := 0; i < pk.count(string(name)); i++ {
+				hash ^= getZobristPocketKey(color, string(name), i)
+			}
+		}
+
+		for i := 0; i < *p.getChecks(color); i++ {
+			hash ^= getZobristCheckKey(color, i)
+		}
+	}
+
+	return hash
+}
+
+// getZobristPocketKey returns the key for the i-th piece of a type, counting from 0, in the side's
+// pocket.
+func getZobristPocketKey(color string, name string, i int) uint64 {
+	pocketColor := white
+	if color == "B" {
+		pocketColor = black
+	}
+
+	return zobristPockets[pocketColor][strings.Index(pocketPieceNames, name)][i]
+}
+
+func getZobristCheckKey(color string, i int) uint64 {
+	checkColor := white
+	if color == "B" {
+		checkColor = black
+	}
+
+	return zobristChecks[checkColor][i]
+}
+
+func getZobristPieceKey(gp gamePiece, sq square) uint64 {
+	color := white
+	if gp.color == "B" {
+		color = black
+	}
+
+	return zobristPieces[color][strings.Index(pieceTypeNames, gp.getName())][getSquareIndex(sq)]
+}
+
+// getBits returns the castling rights as the bits a bitboardPosition holds them as.
+func (cr castlingRights) getBits() uint8 {
+	var bits uint8
+	for i, hasRight := range []bool{cr.whiteKingside, cr.whiteQueenside, cr.blackKingside, cr.blackQueenside} {
+		if hasRight {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits
+}
+
+// canTakeEnPassant returns whether the side to move can legally take a pawn en passant. Only the
+// pawns either side of the pawn that moved two squares can do so, so only their moves are checked.
+func (p position) canTakeEnPassant() bool {
+	if isNoSquare(p.enPassantSquare) {
+		return false
+	}
+
+	rank := p.enPassantSquare.rank - 1
+	if p.sideToMove == "B" {
+		rank = p.enPassantSquare.rank + 1
+	}
+
+	kingSquare, _ := p.board.getSquareForPiece(p.sideToMove, "K")
+	file := fromFileStr(p.enPassantSquare.file)
+	for _, f := range []int{file - 1, file + 1} {
+		if f < 0 || f >= BoardSize {
+			continue
+		}
+
+		fromSquare := square{file: toFileStr(f), rank: rank}
+		if !hasPiece(p.board, fromSquare, "P", p.sideToMove) {
+			continue
+		}
+
+		m := newMove(p, fromSquare, p.enPassantSquare)
+		if p.isLegal(m, kingSquare) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getHash works out the bitboard position's hash from scratch, as position's getHash does.
+func (bp *bitboardPosition) getHash() uint64 {
+	var hash uint64
+	for sq, pc := range bp.squares {
+		if pc != 0 {
+			hash ^= zobristPieces[pc.color()][pc.pieceType()][sq]
+		}
+	}
+
+	hash ^= zobristCastling[bp.castlingRights]
+	if bp.enPassant >= 0 {
+		hash ^= zobristEnPassant[bp.enPassant%8]
+	}
+
+	if bp.sideToMove == black {
+		hash ^= zobristBlackToMove
+	}
+
+	return hash
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestHashRandomGames plays random games, checking at every move that the hashes kept up to date
+// by makeMove match those worked out from scratch, for both kinds of position.
+func TestHashRandomGames(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	games := 50
+	if testing.Short() {
+		games = 10
+	}
+
+	for i := 0; i < games; i++ {
+		p := newPosition()
+		bp := newBitboardPosition(p)
+		for ply := 0; ply < 200; ply++ {
+			if expected := p.getHash(); p.hash != expected {
+				t.Fatalf("Expected hash of %s to be %x, but got: %x", p.toFEN(), expected, p.hash)
+			}
+
+			if expected := bp.getHash(); bp.hash != expected {
+				t.Fatalf("Expected bitboard hash of %s to be %x, but got: %x", p.toFEN(), expected, bp.hash)
+			}
+
+			if bp.hash != p.hash {
+				t.Fatalf("Expected bitboard hash of %s to be the same as the position's, %x, but got: %x", p.toFEN(), p.hash, bp.hash)
+			}
+
+			moves := generateLegalMoves(p)
+			if len(moves) == 0 {
+				break
+			}
+
+			m := moves[rng.Intn(len(moves))]
+			hash := p.hash
+			u := p.makeMove(m)
+			p.unmakeMove(m, u)
+			if p.hash != hash {
+				t.Fatalf("Expected unmaking %s to restore the hash %x, but got: %x", m, hash, p.hash)
+			}
+
+			p.makeMove(m)
+			bp.makeMove(getBBMove(m))
+		}
+	}
+}
+
+func TestHashTranspositions(t *testing.T) {
+	p1, p2 := newPosition(), newPosition()
+	playMoves(t, &p1, "Nf3", "Nf6", "Nc3", "Nc6")
+	playMoves(t, &p2, "Nc3", "Nc6", "Nf3", "Nf6")
+	if p1.hash != p2.hash {
+		t.Errorf("Expected the same position reached by different moves to have the same hash, but got: %x and %x", p1.hash, p2.hash)
+	}
+
+	// The kings going back to where they started doesn't give back the right to castle.
+	p1, _ = parseFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	p2 = p1
+	playMoves(t, &p2, "Ke2", "Ke7", "Ke1", "Ke8")
+	if p1.hash == p2.hash {
+		t.Errorf("Expected positions with different castling rights to have different hashes")
+	}
+}